@@ -14,8 +14,47 @@ const (
 	EnvironmentNotReadyReason string = "EnvironmentNotReady"
 )
 
+// Reasons used by both the original controller and the level-triggered controller.
+const (
+	// TargetClusterNotAllowedReason signals that a Pipeline refers to a cluster in another namespace that it is not
+	// allowed to refer to.
+	TargetClusterNotAllowedReason string = "TargetClusterNotAllowed"
+)
+
+// Reasons used by both the level-triggered controller and the promotion webhook.
+const (
+	// FrozenReason signals that promotions to an environment are held back until its current freeze window ends.
+	FrozenReason string = "Frozen"
+	// SuspendedReason signals that promotions to an environment, or to all environments of a Pipeline, are suspended.
+	SuspendedReason string = "Suspended"
+)
+
 // Reasons used by the level-triggered controller.
 const (
 	// TargetNotReadableReason signals that an app object pointed to by a Pipeline cannot be read, either because it is not found, or it's on a cluster that cannot be reached.
 	TargetNotReadableReason string = "TargetNotReadable"
+	// TargetClusterUnreachableReason signals that a cluster pointed to by a Pipeline cannot be reached, or its cache of
+	// targets did not sync.
+	TargetClusterUnreachableReason string = "TargetClusterUnreachable"
+	// ServiceAccountRequiredReason signals that a Pipeline does not name a service account to impersonate, though the
+	// controller is configured to require one.
+	ServiceAccountRequiredReason string = "ServiceAccountRequired"
+	// InvalidDependenciesReason signals that the environments of a Pipeline have dependencies that are unknown or form a cycle.
+	InvalidDependenciesReason string = "InvalidDependencies"
+	// WaitingApprovalReason signals that a revision will not be promoted to an environment until it has been approved.
+	WaitingApprovalReason string = "WaitingApproval"
+	// SoakingReason signals that a revision is being held in an environment until it has been ready for the minimum soak duration.
+	SoakingReason string = "Soaking"
+	// RolledBackReason signals that an environment was rolled back to its last known-good revision, and the revision it was
+	// rolled back from will not be promoted to it again.
+	RolledBackReason string = "RolledBack"
+	// AllTargetsReadyReason signals that all the targets of an environment are ready.
+	AllTargetsReadyReason string = "AllTargetsReady"
+	// TargetsNotReadyReason signals that one or more targets of an environment are not ready, or cannot be read.
+	TargetsNotReadyReason string = "TargetsNotReady"
+	// RevisionsConvergedReason signals that all the targets of an environment run the same revision.
+	RevisionsConvergedReason string = "RevisionsConverged"
+	// RevisionsDivergedReason signals that the targets of an environment run different revisions, or that one or more of
+	// them has no revision.
+	RevisionsDivergedReason string = "RevisionsDiverged"
 )
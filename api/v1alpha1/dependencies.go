@@ -0,0 +1,99 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GetDependencies returns the names of the environments the named environment depends on. An environment that doesn't
+// give `dependsOn` depends on the environment before it in the list, and the first environment depends on nothing.
+func (ps PipelineSpec) GetDependencies(env string) []string {
+	for idx, e := range ps.Environments {
+		if e.Name != env {
+			continue
+		}
+		if len(e.DependsOn) > 0 {
+			return e.DependsOn
+		}
+		if idx == 0 {
+			return nil
+		}
+		return []string{ps.Environments[idx-1].Name}
+	}
+
+	return nil
+}
+
+// GetDependents returns the environments that depend directly on the named environment, in the order in which they are
+// declared.
+func (ps PipelineSpec) GetDependents(env string) []Environment {
+	var res []Environment
+	for _, e := range ps.Environments {
+		for _, dep := range ps.GetDependencies(e.Name) {
+			if dep == env {
+				res = append(res, e)
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// ValidateDependencies checks that environment names are unique, that each environment only depends on other environments
+// in the pipeline, and that the dependencies don't form a cycle.
+func (ps PipelineSpec) ValidateDependencies() error {
+	known := map[string]bool{}
+	for _, e := range ps.Environments {
+		if known[e.Name] {
+			return fmt.Errorf("environment %s is defined more than once", e.Name)
+		}
+		known[e.Name] = true
+	}
+
+	for _, e := range ps.Environments {
+		for _, dep := range e.DependsOn {
+			if dep == e.Name {
+				return fmt.Errorf("environment %s depends on itself", e.Name)
+			}
+			if !known[dep] {
+				return fmt.Errorf("environment %s depends on unknown environment %s", e.Name, dep)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+
+	var visit func(env string, path []string) error
+	visit = func(env string, path []string) error {
+		path = append(path[:len(path):len(path)], env)
+		switch state[env] {
+		case visiting:
+			return fmt.Errorf("environments form a dependency cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[env] = visiting
+		for _, dep := range ps.GetDependencies(env) {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[env] = visited
+
+		return nil
+	}
+
+	for _, e := range ps.Environments {
+		if err := visit(e.Name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/weaveworks/pipeline-controller/api/v1beta1"
+)
+
+var _ conversion.Convertible = &Pipeline{}
+
+// ConvertTo converts this Pipeline to the hub version, v1beta1.
+func (p *Pipeline) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.Pipeline)
+	if !ok {
+		return fmt.Errorf("cannot convert a %s Pipeline to %T", GroupVersion.Version, dstRaw)
+	}
+
+	dst.ObjectMeta = p.ObjectMeta
+	dst.Spec = v1beta1.PipelineSpec{
+		Environments:      convertSlice(p.Spec.Environments, environmentToHub),
+		AppRef:            v1beta1.LocalAppReference(p.Spec.AppRef),
+		Promotion:         promotionToHub(p.Spec.Promotion),
+		TargetStatusRules: convertSlice(p.Spec.TargetStatusRules, func(r TargetStatusRule) v1beta1.TargetStatusRule { return v1beta1.TargetStatusRule(r) }),
+		Suspend:           p.Spec.Suspend,
+
+		ServiceAccountName: p.Spec.ServiceAccountName,
+	}
+	dst.Status = v1beta1.PipelineStatus{
+		ObservedGeneration: p.Status.ObservedGeneration,
+		Conditions:         p.Status.Conditions,
+		Environments:       convertMap(p.Status.Environments, environmentStatusToHub),
+
+		FirstEnvironmentRevision: p.Status.FirstEnvironmentRevision,
+		LastEnvironmentRevision:  p.Status.LastEnvironmentRevision,
+	}
+
+	return nil
+}
+
+// ConvertFrom converts the hub version, v1beta1, of a Pipeline to this version.
+func (p *Pipeline) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.Pipeline)
+	if !ok {
+		return fmt.Errorf("cannot convert %T to a %s Pipeline", srcRaw, GroupVersion.Version)
+	}
+
+	p.ObjectMeta = src.ObjectMeta
+	p.Spec = PipelineSpec{
+		Environments:      convertSlice(src.Spec.Environments, environmentFromHub),
+		AppRef:            LocalAppReference(src.Spec.AppRef),
+		Promotion:         promotionFromHub(src.Spec.Promotion),
+		TargetStatusRules: convertSlice(src.Spec.TargetStatusRules, func(r v1beta1.TargetStatusRule) TargetStatusRule { return TargetStatusRule(r) }),
+		Suspend:           src.Spec.Suspend,
+
+		ServiceAccountName: src.Spec.ServiceAccountName,
+	}
+	p.Status = PipelineStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+		Conditions:         src.Status.Conditions,
+		Environments:       convertMap(src.Status.Environments, environmentStatusFromHub),
+
+		FirstEnvironmentRevision: src.Status.FirstEnvironmentRevision,
+		LastEnvironmentRevision:  src.Status.LastEnvironmentRevision,
+	}
+
+	return nil
+}
+
+func environmentToHub(env Environment) v1beta1.Environment {
+	return v1beta1.Environment{
+		Name: env.Name,
+		Targets: convertSlice(env.Targets, func(t Target) v1beta1.Target {
+			return v1beta1.Target{
+				Namespace:  t.Namespace,
+				ClusterRef: (*v1beta1.CrossNamespaceClusterReference)(t.ClusterRef),
+				AppRef:     (*v1beta1.TargetAppReference)(t.AppRef),
+			}
+		}),
+		Promotion:       promotionToHub(env.Promotion),
+		MinSoakDuration: env.MinSoakDuration,
+		DependsOn:       env.DependsOn,
+		FreezeWindows:   convertSlice(env.FreezeWindows, func(w FreezeWindow) v1beta1.FreezeWindow { return v1beta1.FreezeWindow(w) }),
+		Suspend:         env.Suspend,
+	}
+}
+
+func environmentFromHub(env v1beta1.Environment) Environment {
+	return Environment{
+		Name: env.Name,
+		Targets: convertSlice(env.Targets, func(t v1beta1.Target) Target {
+			return Target{
+				Namespace:  t.Namespace,
+				ClusterRef: (*CrossNamespaceClusterReference)(t.ClusterRef),
+				AppRef:     (*TargetAppReference)(t.AppRef),
+			}
+		}),
+		Promotion:       promotionFromHub(env.Promotion),
+		MinSoakDuration: env.MinSoakDuration,
+		DependsOn:       env.DependsOn,
+		FreezeWindows:   convertSlice(env.FreezeWindows, func(w v1beta1.FreezeWindow) FreezeWindow { return FreezeWindow(w) }),
+		Suspend:         env.Suspend,
+	}
+}
+
+// promotionToHub converts a promotion to v1beta1, where the webhook secret is given in the promotion rather than in its
+// strategy.
+func promotionToHub(promotion *Promotion) *v1beta1.Promotion {
+	if promotion == nil {
+		return nil
+	}
+
+	res := &v1beta1.Promotion{
+		Manual:           promotion.Manual,
+		MinSoakDuration:  promotion.MinSoakDuration,
+		FreezeWindows:    convertSlice(promotion.FreezeWindows, func(w FreezeWindow) v1beta1.FreezeWindow { return v1beta1.FreezeWindow(w) }),
+		Rollback:         (*v1beta1.RollbackPolicy)(promotion.Rollback),
+		WebhookSecretRef: promotion.Strategy.SecretRef,
+	}
+	if pr := promotion.Strategy.PullRequest; pr != nil {
+		res.Strategy.PullRequest = &v1beta1.PullRequestPromotion{
+			Type:       v1beta1.GitProviderType(pr.Type),
+			URL:        pr.URL,
+			BaseBranch: pr.BaseBranch,
+			SecretRef:  pr.SecretRef,
+		}
+	}
+	if promotion.Strategy.Notification != nil {
+		res.Strategy.Notification = &v1beta1.NotificationPromotion{}
+	}
+
+	return res
+}
+
+func promotionFromHub(promotion *v1beta1.Promotion) *Promotion {
+	if promotion == nil {
+		return nil
+	}
+
+	res := &Promotion{
+		Manual:          promotion.Manual,
+		MinSoakDuration: promotion.MinSoakDuration,
+		FreezeWindows:   convertSlice(promotion.FreezeWindows, func(w v1beta1.FreezeWindow) FreezeWindow { return FreezeWindow(w) }),
+		Rollback:        (*RollbackPolicy)(promotion.Rollback),
+		Strategy: Strategy{
+			SecretRef: promotion.WebhookSecretRef,
+		},
+	}
+	if pr := promotion.Strategy.PullRequest; pr != nil {
+		res.Strategy.PullRequest = &PullRequestPromotion{
+			Type:       GitProviderType(pr.Type),
+			URL:        pr.URL,
+			BaseBranch: pr.BaseBranch,
+			SecretRef:  pr.SecretRef,
+		}
+	}
+	if promotion.Strategy.Notification != nil {
+		res.Strategy.Notification = &NotificationPromotion{}
+	}
+
+	return res
+}
+
+func environmentStatusToHub(status EnvironmentStatus) v1beta1.EnvironmentStatus {
+	return v1beta1.EnvironmentStatus{
+		WaitingApproval:  v1beta1.WaitingApproval(status.WaitingApproval),
+		ApprovedRevision: status.ApprovedRevision,
+		Targets: convertSlice(status.Targets, func(t TargetStatus) v1beta1.TargetStatus {
+			return v1beta1.TargetStatus{
+				ClusterAppRef: v1beta1.ClusterAppReference{
+					LocalAppReference: v1beta1.LocalAppReference(t.ClusterAppRef.LocalAppReference),
+					ClusterRef:        (*v1beta1.CrossNamespaceClusterReference)(t.ClusterAppRef.ClusterRef),
+				},
+				Ready:      t.Ready,
+				Revision:   t.Revision,
+				Error:      t.Error,
+				ReadySince: t.ReadySince,
+			}
+		}),
+		LastReportedRevision: status.LastReportedRevision,
+		PromotionHistory: convertSlice(status.PromotionHistory, func(r PromotionRecord) v1beta1.PromotionRecord {
+			return v1beta1.PromotionRecord{
+				SourceEnvironment: r.SourceEnvironment,
+				TargetEnvironment: r.TargetEnvironment,
+				Revision:          r.Revision,
+				Strategy:          r.Strategy,
+				Outcome:           v1beta1.PromotionOutcome(r.Outcome),
+				Rollback:          r.Rollback,
+				Error:             r.Error,
+				Location:          r.Location,
+				StartedAt:         r.StartedAt,
+				CompletedAt:       r.CompletedAt,
+			}
+		}),
+		InFlightPromotion:  (*v1beta1.InFlightPromotion)(status.InFlightPromotion),
+		KnownGoodRevision:  status.KnownGoodRevision,
+		UnhealthySince:     status.UnhealthySince,
+		RolledBackRevision: status.RolledBackRevision,
+		Revision:           status.Revision,
+		ReadyTargets:       status.ReadyTargets,
+		TotalTargets:       status.TotalTargets,
+		LastPromotionTime:  status.LastPromotionTime,
+		Conditions:         status.Conditions,
+	}
+}
+
+func environmentStatusFromHub(status v1beta1.EnvironmentStatus) EnvironmentStatus {
+	return EnvironmentStatus{
+		WaitingApproval:  WaitingApproval(status.WaitingApproval),
+		ApprovedRevision: status.ApprovedRevision,
+		Targets: convertSlice(status.Targets, func(t v1beta1.TargetStatus) TargetStatus {
+			return TargetStatus{
+				ClusterAppRef: ClusterAppReference{
+					LocalAppReference: LocalAppReference(t.ClusterAppRef.LocalAppReference),
+					ClusterRef:        (*CrossNamespaceClusterReference)(t.ClusterAppRef.ClusterRef),
+				},
+				Ready:      t.Ready,
+				Revision:   t.Revision,
+				Error:      t.Error,
+				ReadySince: t.ReadySince,
+			}
+		}),
+		LastReportedRevision: status.LastReportedRevision,
+		PromotionHistory: convertSlice(status.PromotionHistory, func(r v1beta1.PromotionRecord) PromotionRecord {
+			return PromotionRecord{
+				SourceEnvironment: r.SourceEnvironment,
+				TargetEnvironment: r.TargetEnvironment,
+				Revision:          r.Revision,
+				Strategy:          r.Strategy,
+				Outcome:           PromotionOutcome(r.Outcome),
+				Rollback:          r.Rollback,
+				Error:             r.Error,
+				Location:          r.Location,
+				StartedAt:         r.StartedAt,
+				CompletedAt:       r.CompletedAt,
+			}
+		}),
+		InFlightPromotion:  (*InFlightPromotion)(status.InFlightPromotion),
+		KnownGoodRevision:  status.KnownGoodRevision,
+		UnhealthySince:     status.UnhealthySince,
+		RolledBackRevision: status.RolledBackRevision,
+		Revision:           status.Revision,
+		ReadyTargets:       status.ReadyTargets,
+		TotalTargets:       status.TotalTargets,
+		LastPromotionTime:  status.LastPromotionTime,
+		Conditions:         status.Conditions,
+	}
+}
+
+// convertSlice applies f to each item of in. A nil slice stays nil, so that conversions round-trip exactly.
+func convertSlice[S, D any](in []S, f func(S) D) []D {
+	if in == nil {
+		return nil
+	}
+
+	out := make([]D, len(in))
+	for i := range in {
+		out[i] = f(in[i])
+	}
+
+	return out
+}
+
+// convertMap applies f to each value of in, keeping nil values as they are.
+func convertMap[S, D any](in map[string]*S, f func(S) D) map[string]*D {
+	if in == nil {
+		return nil
+	}
+
+	out := make(map[string]*D, len(in))
+	for k, v := range in {
+		if v == nil {
+			out[k] = nil
+			continue
+		}
+		d := f(*v)
+		out[k] = &d
+	}
+
+	return out
+}
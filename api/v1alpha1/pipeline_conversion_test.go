@@ -0,0 +1,139 @@
+package v1alpha1_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/api/v1beta1"
+)
+
+func testPipeline() *v1alpha1.Pipeline {
+	now := metav1.NewTime(time.Date(2023, 11, 6, 8, 0, 0, 0, time.UTC))
+
+	return &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", Generation: 3},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{APIVersion: "helm.toolkit.fluxcd.io/v2beta1", Kind: "HelmRelease", Name: "podinfo"},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: "dev"}},
+				},
+				{
+					Name: "prod",
+					Targets: []v1alpha1.Target{{
+						Namespace:  "prod",
+						ClusterRef: &v1alpha1.CrossNamespaceClusterReference{Kind: "GitopsCluster", Name: "prod"},
+						AppRef:     &v1alpha1.TargetAppReference{Name: "podinfo-prod"},
+					}},
+					Promotion: &v1alpha1.Promotion{
+						Manual:   true,
+						Strategy: v1alpha1.Strategy{Notification: &v1alpha1.NotificationPromotion{}},
+					},
+					MinSoakDuration: &metav1.Duration{Duration: time.Hour},
+					DependsOn:       []string{"dev"},
+					FreezeWindows:   []v1alpha1.FreezeWindow{{Schedule: "0 18 * * 5", Duration: metav1.Duration{Duration: 62 * time.Hour}}},
+					Suspend:         true,
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Rollback: &v1alpha1.RollbackPolicy{Timeout: metav1.Duration{Duration: 10 * time.Minute}},
+				Strategy: v1alpha1.Strategy{
+					PullRequest: &v1alpha1.PullRequestPromotion{
+						Type:       v1alpha1.Github,
+						URL:        "https://github.com/example/podinfo",
+						BaseBranch: "main",
+						SecretRef:  meta.LocalObjectReference{Name: "git-credentials"},
+					},
+					SecretRef: &meta.LocalObjectReference{Name: "hmac"},
+				},
+			},
+			TargetStatusRules:  []v1alpha1.TargetStatusRule{{APIVersion: "apps/v1", Kind: "Deployment", Revision: "{.metadata.annotations.revision}"}},
+			ServiceAccountName: "pipelines",
+		},
+		Status: v1alpha1.PipelineStatus{
+			ObservedGeneration: 3,
+			Conditions:         []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "ReconciliationSucceeded", LastTransitionTime: now}},
+			Environments: map[string]*v1alpha1.EnvironmentStatus{
+				"dev": {
+					Targets: []v1alpha1.TargetStatus{{
+						ClusterAppRef: v1alpha1.ClusterAppReference{LocalAppReference: v1alpha1.LocalAppReference{APIVersion: "helm.toolkit.fluxcd.io/v2beta1", Kind: "HelmRelease", Name: "podinfo"}},
+						Ready:         true,
+						Revision:      "1.0.0",
+						ReadySince:    &now,
+					}},
+					KnownGoodRevision: "1.0.0",
+					Revision:          "1.0.0",
+					ReadyTargets:      1,
+					TotalTargets:      1,
+					LastPromotionTime: &now,
+					Conditions:        []metav1.Condition{{Type: "Converged", Status: metav1.ConditionTrue, Reason: "RevisionsConverged", LastTransitionTime: now}},
+				},
+				"prod": {
+					WaitingApproval: v1alpha1.WaitingApproval{Revision: "1.0.0"},
+					PromotionHistory: []v1alpha1.PromotionRecord{{
+						SourceEnvironment: "dev",
+						TargetEnvironment: "prod",
+						Revision:          "0.9.0",
+						Strategy:          "notification",
+						Outcome:           v1alpha1.PromotionSucceeded,
+						StartedAt:         now,
+						CompletedAt:       now,
+					}},
+					InFlightPromotion: &v1alpha1.InFlightPromotion{Revision: "0.9.0", StartedAt: now},
+					UnhealthySince:    &now,
+				},
+			},
+			FirstEnvironmentRevision: "1.0.0",
+		},
+	}
+}
+
+func TestConvertTo(t *testing.T) {
+	var hub v1beta1.Pipeline
+	if err := testPipeline().ConvertTo(&hub); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	promotion := hub.Spec.Promotion
+	if promotion.WebhookSecretRef == nil || promotion.WebhookSecretRef.Name != "hmac" {
+		t.Errorf("expected the strategy's secretRef to become the promotion's webhookSecretRef, got %v", promotion.WebhookSecretRef)
+	}
+	if promotion.Strategy.PullRequest == nil || promotion.Strategy.PullRequest.URL != "https://github.com/example/podinfo" {
+		t.Errorf("expected the pull request strategy to be converted, got %v", promotion.Strategy.PullRequest)
+	}
+	if got := hub.Spec.Environments[1].Targets[0].AppRef; got == nil || got.Name != "podinfo-prod" {
+		t.Errorf("expected the target's appRef to be converted, got %v", got)
+	}
+	if got := hub.Status.Environments["prod"].PromotionHistory[0].Outcome; got != v1beta1.PromotionSucceeded {
+		t.Errorf("expected the promotion history to be converted, got outcome %q", got)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	for name, pipeline := range map[string]*v1alpha1.Pipeline{
+		"full":  testPipeline(),
+		"empty": {ObjectMeta: metav1.ObjectMeta{Name: "empty"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var hub v1beta1.Pipeline
+			if err := pipeline.ConvertTo(&hub); err != nil {
+				t.Fatalf("unexpected error converting to the hub: %v", err)
+			}
+
+			var res v1alpha1.Pipeline
+			if err := res.ConvertFrom(&hub); err != nil {
+				t.Fatalf("unexpected error converting from the hub: %v", err)
+			}
+
+			if !reflect.DeepEqual(pipeline, &res) {
+				t.Errorf("round trip changed the pipeline:\nwant %+v\n got %+v", pipeline, &res)
+			}
+		})
+	}
+}
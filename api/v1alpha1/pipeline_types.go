@@ -11,17 +11,34 @@ import (
 const (
 	// PipelineKind is the string representation of a Pipeline.
 	PipelineKind = "Pipeline"
+	// CleanupFinalizer is added to Pipelines with promotions that leave things behind outside the cluster, e.g. branches
+	// and pull requests, so that these are removed before the Pipeline is deleted.
+	CleanupFinalizer = "pipelines.weave.works/cleanup"
+	// SkipCleanupAnnotation opts a Pipeline out of cleanup on deletion when set to "true".
+	SkipCleanupAnnotation = "pipelines.weave.works/skip-cleanup"
+	// NamespacedCacheAnnotation is set on a GitopsCluster to "true" or "false" to choose whether targets in that cluster
+	// are watched with a cache per namespace, which only needs namespaced RBAC, or with a cluster-wide cache. Without it,
+	// the controller's default is used.
+	NamespacedCacheAnnotation = "pipelines.weave.works/namespaced-cache"
+	// AllowedNamespacesAnnotation is set on a cluster object (a GitopsCluster, a Cluster API Cluster or a kubeconfig
+	// Secret) to a comma-separated list of the namespaces whose Pipelines may refer to it, or to "*" for all namespaces.
+	AllowedNamespacesAnnotation = "pipelines.weave.works/allowed-namespaces"
 	// MaxConditionMessageLength denotes the maximum length of the `.status.conditions.message` field.
 	MaxConditionMessageLength = 20000
 	// DefaultRequeueInterval is used when immediate re-queueing of a reconcile request isn't necessary, e.g. when it's expected to be
 	// triggered by a watched resource before.
 	DefaultRequeueInterval = 30 * time.Minute
+	// MaxPromotionHistory is the maximum number of entries kept in an environment's promotion history.
+	MaxPromotionHistory = 10
 )
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="App Kind",type="string",JSONPath=".spec.appRef.kind",description=""
 // +kubebuilder:printcolumn:name="App Name",type="string",JSONPath=".spec.appRef.name",description=""
+// +kubebuilder:printcolumn:name="First Env Revision",type="string",JSONPath=".status.firstEnvironmentRevision",description=""
+// +kubebuilder:printcolumn:name="Last Env Revision",type="string",JSONPath=".status.lastEnvironmentRevision",description=""
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
@@ -54,6 +71,38 @@ type PipelineSpec struct {
 	// of this pipeline.
 	// +optional
 	Promotion *Promotion `json:"promotion,omitempty"`
+	// TargetStatusRules tells how to get the readiness and revision of app objects, by kind. These take precedence over
+	// the rules configured for the controller and the built-in rules.
+	// +optional
+	TargetStatusRules []TargetStatusRule `json:"targetStatusRules,omitempty"`
+	// Suspend tells the controller and the promotion webhook not to promote to any environment of this pipeline. The
+	// status of the targets is still updated.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// ServiceAccountName is the name of a service account in the pipeline's namespace, which limits what the controller
+	// reads for this pipeline to what the service account may read: the clusters of its targets and their kubeconfig
+	// Secrets, the targets in the local cluster, and the Secrets with credentials for promotions. If not given, the
+	// controller reads these with its own service account, unless it's configured to require a service account. It is
+	// only supported by the level-triggered controller.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+// TargetStatusRule tells how to get the readiness and revision from app objects of a certain kind.
+type TargetStatusRule struct {
+	// APIVersion of the app objects this rule applies to.
+	// +required
+	APIVersion string `json:"apiVersion"`
+	// Kind of the app objects this rule applies to.
+	// +required
+	Kind string `json:"kind"`
+	// Ready is a JSONPath expression which evaluates to "True" when the app object is ready, e.g.
+	// `{.status.conditions[?(@.type=="Ready")].status}`. This is the default, if not given.
+	// +optional
+	Ready string `json:"ready,omitempty"`
+	// Revision is a JSONPath expression giving the revision of the app object. If not given, it's `{.status.lastAppliedRevision}`.
+	// +optional
+	Revision string `json:"revision,omitempty"`
 }
 
 // GetPromotion returns the environment promotion if set, otherwise returns the default promotion..
@@ -67,17 +116,102 @@ func (ps PipelineSpec) GetPromotion(env string) *Promotion {
 	return ps.Promotion
 }
 
+// GetMinSoakDuration returns how long a revision needs to have been ready on all targets of the environment `from` before
+// it can be promoted to the environment `to`. The source environment's `minSoakDuration` takes precedence over the one given
+// in the promotion to the target environment.
+func (ps PipelineSpec) GetMinSoakDuration(from, to string) time.Duration {
+	for _, e := range ps.Environments {
+		if e.Name == from && e.MinSoakDuration != nil {
+			return e.MinSoakDuration.Duration
+		}
+	}
+
+	if promotion := ps.GetPromotion(to); promotion != nil && promotion.MinSoakDuration != nil {
+		return promotion.MinSoakDuration.Duration
+	}
+
+	return 0
+}
+
+// IsSuspended returns true if promotions to the environment given are suspended, either for the whole pipeline or for
+// the environment itself.
+func (ps PipelineSpec) IsSuspended(env string) bool {
+	if ps.Suspend {
+		return true
+	}
+
+	for _, e := range ps.Environments {
+		if e.Name == env {
+			return e.Suspend
+		}
+	}
+
+	return false
+}
+
+// GetFreezeWindows returns the freeze windows that apply to promotions to the environment given, which are those of the
+// environment together with those of its promotion.
+func (ps PipelineSpec) GetFreezeWindows(env string) []FreezeWindow {
+	var windows []FreezeWindow
+	for _, e := range ps.Environments {
+		if e.Name == env {
+			windows = append(windows, e.FreezeWindows...)
+		}
+	}
+
+	if promotion := ps.GetPromotion(env); promotion != nil {
+		windows = append(windows, promotion.FreezeWindows...)
+	}
+
+	return windows
+}
+
 // Promotion define promotion configuration for the pipeline.
 type Promotion struct {
 	// Manual option to allow promotion between to require manual approval before proceeding.
 	// +optional
 	Manual bool `json:"manual,omitempty"`
+	// MinSoakDuration is how long a revision must have been ready on all targets of the previous environment before it is
+	// promoted. It is overridden by the previous environment's `minSoakDuration`.
+	// +optional
+	MinSoakDuration *metav1.Duration `json:"minSoakDuration,omitempty"`
+	// FreezeWindows are recurring periods of time during which this promotion is not made. These apply in addition to the
+	// freeze windows of the environment being promoted to.
+	// +optional
+	FreezeWindows []FreezeWindow `json:"freezeWindows,omitempty"`
+	// Rollback, if given, makes the controller promote the last known-good revision to the environment again when its
+	// targets stay unhealthy after receiving a new revision. This is only supported by the level-triggered controller.
+	// +optional
+	Rollback *RollbackPolicy `json:"rollback,omitempty"`
 	// Strategy defines which strategy the promotion should use.
 	Strategy Strategy `json:"strategy"`
 }
 
+// FreezeWindow is a recurring period of time during which promotions are not made, e.g. a change freeze over the weekend.
+type FreezeWindow struct {
+	// Schedule is a cron expression giving the start of each freeze, e.g. "0 18 * * 5" for 6pm every Friday.
+	// +required
+	Schedule string `json:"schedule"`
+	// Duration is how long each freeze lasts, e.g. "62h" for the weekend. It must not be longer than the shortest interval
+	// between the starts given by the schedule.
+	// +required
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone is the IANA name of the time zone the schedule is given in, e.g. "Europe/London". Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// RollbackPolicy defines when an environment is rolled back to its last known-good revision.
+type RollbackPolicy struct {
+	// Timeout is how long the targets of an environment can be unhealthy, after receiving a revision other than the last
+	// known-good revision, before the environment is rolled back.
+	// +required
+	Timeout metav1.Duration `json:"timeout"`
+}
+
 // Strategy defines all the available promotion strategies. All of the fields in here are mutually exclusive, i.e. you can only select one
-// promotion strategy per Pipeline. Failure to do so will result in undefined behaviour.
+// promotion strategy per Pipeline. This is enforced by the validating webhook, if installed; otherwise, selecting more than one
+// results in undefined behaviour.
 type Strategy struct {
 	// PullRequest defines a promotion through a Pull Request.
 	// +optional
@@ -90,6 +224,19 @@ type Strategy struct {
 	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
 }
 
+// Type returns the name of the selected strategy as it appears in the `.spec.promotion.strategy` field, or an empty string
+// if no strategy is selected.
+func (s Strategy) Type() string {
+	switch {
+	case s.PullRequest != nil:
+		return "pull-request"
+	case s.Notification != nil:
+		return "notification"
+	default:
+		return ""
+	}
+}
+
 type GitProviderType string
 
 const (
@@ -106,7 +253,7 @@ func (g GitProviderType) String() string {
 type PullRequestPromotion struct {
 	// Indicates the git provider type to manage pull requests.
 	// +required
-	// +kubebuilder:validation:Enum=github;gitlab;bitbucket-server
+	// +kubebuilder:validation:Enum=github;gitlab;bitbucket-server;azure-devops
 	Type GitProviderType `json:"type"`
 	// The git repository HTTPS URL used to patch the manifests for promotion.
 	// +required
@@ -140,6 +287,16 @@ type PipelineStatus struct {
 	// Environments holds environment statuses.
 	// +optional
 	Environments map[string]*EnvironmentStatus `json:"environments"`
+
+	// FirstEnvironmentRevision is the revision run by all the targets of the first environment, if they all run the
+	// same revision. It is only set by the level-triggered controller.
+	// +optional
+	FirstEnvironmentRevision string `json:"firstEnvironmentRevision,omitempty"`
+
+	// LastEnvironmentRevision is the revision run by all the targets of the last environment, if they all run the same
+	// revision. It is only set by the level-triggered controller.
+	// +optional
+	LastEnvironmentRevision string `json:"lastEnvironmentRevision,omitempty"`
 }
 
 // GetWaitingApproval returns the waiting approval of an environment.
@@ -166,26 +323,167 @@ func (p *PipelineStatus) ResetWaitingApproval(env string) {
 	p.setWaitingApproval(env, WaitingApproval{})
 }
 
+// SetApprovedRevision records that the revision given has been approved for promotion to an environment, and resets the
+// environment's waiting approval.
+func (p *PipelineStatus) SetApprovedRevision(env, revision string) {
+	envStatus := p.environment(env)
+	envStatus.ApprovedRevision = revision
+	envStatus.WaitingApproval = WaitingApproval{}
+}
+
 func (p *PipelineStatus) setWaitingApproval(env string, waitingApproval WaitingApproval) {
+	p.environment(env).WaitingApproval = waitingApproval
+}
+
+// AddPromotionRecord prepends the given record to the promotion history of the record's target environment, dropping the
+// oldest records so that at most MaxPromotionHistory entries are kept. A successful promotion also sets the environment's
+// last promotion time.
+func (p *PipelineStatus) AddPromotionRecord(record PromotionRecord) {
+	envStatus := p.environment(record.TargetEnvironment)
+	if record.Outcome == PromotionSucceeded {
+		completedAt := record.CompletedAt
+		envStatus.LastPromotionTime = &completedAt
+	}
+
+	history := append([]PromotionRecord{record}, envStatus.PromotionHistory...)
+	if len(history) > MaxPromotionHistory {
+		history = history[:MaxPromotionHistory]
+	}
+	envStatus.PromotionHistory = history
+}
+
+// SetLastReportedRevision records the revision an environment has reported to the promotion webhook.
+func (p *PipelineStatus) SetLastReportedRevision(env string, revision string) {
+	p.environment(env).LastReportedRevision = revision
+}
+
+// environment returns the status of the given environment, creating it if necessary.
+func (p *PipelineStatus) environment(env string) *EnvironmentStatus {
 	if p.Environments == nil {
 		p.Environments = make(map[string]*EnvironmentStatus)
 	}
 
 	val, ok := p.Environments[env]
-	if !ok {
-		p.Environments[env] = &EnvironmentStatus{
-			WaitingApproval: waitingApproval,
-		}
-
-		return
+	if !ok || val == nil {
+		val = &EnvironmentStatus{}
+		p.Environments[env] = val
 	}
 
-	val.WaitingApproval = waitingApproval
+	return val
 }
 
 type EnvironmentStatus struct {
+	// WaitingApproval holds the revision waiting for approval before it is promoted to this environment, if any.
+	// +optional
 	WaitingApproval WaitingApproval `json:"waitingApproval,omitempty"`
-	Targets         []TargetStatus  `json:"targets,omitempty"`
+	// ApprovedRevision is the revision most recently approved for promotion to this environment. It is only used by the
+	// level-triggered controller, which promotes to an environment with a manual promotion once the revision is approved.
+	// +optional
+	ApprovedRevision string `json:"approvedRevision,omitempty"`
+	// Targets holds the status of each of the targets of this environment.
+	// +optional
+	Targets []TargetStatus `json:"targets,omitempty"`
+	// LastReportedRevision is the revision most recently reported by this environment to the promotion webhook. It is used to
+	// decide whether all the dependencies of an environment run the same revision.
+	// +optional
+	LastReportedRevision string `json:"lastReportedRevision,omitempty"`
+	// PromotionHistory holds the most recent promotion attempts into this environment, newest first.
+	// +optional
+	PromotionHistory []PromotionRecord `json:"promotionHistory,omitempty"`
+	// InFlightPromotion is set while a promotion into this environment has been started, but the environment is not yet
+	// running the promoted revision.
+	// +optional
+	InFlightPromotion *InFlightPromotion `json:"inFlightPromotion,omitempty"`
+	// KnownGoodRevision is the revision most recently seen running and ready on all targets of this environment.
+	// +optional
+	KnownGoodRevision string `json:"knownGoodRevision,omitempty"`
+	// UnhealthySince is the time at which one or more targets of this environment were first seen to be not ready. It is
+	// unset while all targets are ready.
+	// +optional
+	UnhealthySince *metav1.Time `json:"unhealthySince,omitempty"`
+	// RolledBackRevision is the revision this environment was most recently rolled back from. It is not promoted to the
+	// environment again, and is cleared once there is a newer revision to promote.
+	// +optional
+	RolledBackRevision string `json:"rolledBackRevision,omitempty"`
+	// Revision is the revision run by all the targets of this environment, if they all run the same revision. It is only
+	// set by the level-triggered controller.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// ReadyTargets is the number of targets of this environment that are ready. It is only set by the level-triggered
+	// controller.
+	// +optional
+	ReadyTargets int32 `json:"readyTargets,omitempty"`
+	// TotalTargets is the number of targets of this environment. It is only set by the level-triggered controller.
+	// +optional
+	TotalTargets int32 `json:"totalTargets,omitempty"`
+	// LastPromotionTime is the time a revision was last successfully promoted to this environment.
+	// +optional
+	LastPromotionTime *metav1.Time `json:"lastPromotionTime,omitempty"`
+	// Conditions holds the conditions of this environment: `Ready` tells whether all its targets are ready, `Converged`
+	// whether they all run the same revision, and `PromotionPending` whether a promotion to it is being held back. They
+	// are only set by the level-triggered controller.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// InFlightPromotion describes a promotion that has been started by running the promotion strategy, and is waiting for the
+// environment to run the promoted revision.
+type InFlightPromotion struct {
+	// Revision is the revision being promoted.
+	// +required
+	Revision string `json:"revision"`
+	// StartedAt is the time the promotion strategy was last run for this revision.
+	// +required
+	StartedAt metav1.Time `json:"startedAt"`
+	// Location is the location returned by the promotion strategy, if any, e.g. the URL of a pull request.
+	// +optional
+	Location string `json:"location,omitempty"`
+}
+
+// PromotionOutcome is the result of a promotion attempt.
+type PromotionOutcome string
+
+const (
+	// PromotionSucceeded means the promotion strategy completed without error.
+	PromotionSucceeded PromotionOutcome = "Succeeded"
+	// PromotionFailed means the promotion strategy returned an error.
+	PromotionFailed PromotionOutcome = "Failed"
+)
+
+// PromotionRecord describes a single attempt at promoting a revision from one environment to another.
+type PromotionRecord struct {
+	// SourceEnvironment is the environment the revision was promoted from. If the target environment depends on more than
+	// one environment, this is a comma-separated list of them.
+	// +optional
+	SourceEnvironment string `json:"sourceEnvironment,omitempty"`
+	// TargetEnvironment is the environment the revision was promoted to.
+	// +required
+	TargetEnvironment string `json:"targetEnvironment"`
+	// Revision is the revision that was promoted.
+	// +required
+	Revision string `json:"revision"`
+	// Strategy is the type of the promotion strategy used, e.g. "pull-request" or "notification".
+	// +optional
+	Strategy string `json:"strategy,omitempty"`
+	// Outcome tells whether the promotion succeeded or failed.
+	// +kubebuilder:validation:Enum=Succeeded;Failed
+	// +required
+	Outcome PromotionOutcome `json:"outcome"`
+	// Rollback is true if this was a rollback to the environment's last known-good revision.
+	// +optional
+	Rollback bool `json:"rollback,omitempty"`
+	// Error is set if the promotion failed.
+	// +optional
+	Error string `json:"error,omitempty"`
+	// Location is the location returned by the promotion strategy, if any, e.g. the URL of a pull request.
+	// +optional
+	Location string `json:"location,omitempty"`
+	// StartedAt is the time the promotion was started.
+	// +required
+	StartedAt metav1.Time `json:"startedAt"`
+	// CompletedAt is the time the promotion finished.
+	// +required
+	CompletedAt metav1.Time `json:"completedAt"`
 }
 
 // WaitingApproval holds the environment revision that's currently waiting approval.
@@ -212,6 +510,10 @@ type TargetStatus struct {
 	Revision string `json:"revision,omitempty"`
 	// Error is set if the application object is not present or not ready, and empty otherwise.
 	Error string `json:"error,omitempty"`
+	// ReadySince is the time at which the application object was first seen to be ready with its current revision. It is
+	// only set if Ready is true.
+	// +optional
+	ReadySince *metav1.Time `json:"readySince,omitempty"`
 }
 
 type Environment struct {
@@ -226,6 +528,21 @@ type Environment struct {
 	// Promotion defines details about how the promotion is done on this environment.
 	// +optional
 	Promotion *Promotion `json:"promotion,omitempty"`
+	// MinSoakDuration is how long a revision must have been ready on all targets of this environment before it is promoted
+	// to the next environment.
+	// +optional
+	MinSoakDuration *metav1.Duration `json:"minSoakDuration,omitempty"`
+	// DependsOn names the environments that must all be running a revision before it is promoted to this environment. If
+	// not given, the environment depends on the one before it in the list; the first environment depends on nothing.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// FreezeWindows are recurring periods of time during which nothing is promoted to this environment.
+	// +optional
+	FreezeWindows []FreezeWindow `json:"freezeWindows,omitempty"`
+	// Suspend tells the controller and the promotion webhook not to promote to this environment. The status of its
+	// targets is still updated.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
 }
 
 type Target struct {
@@ -237,6 +554,28 @@ type Target struct {
 	// to point to a Namespace on the cluster that the Pipeline resources resides on (i.e. a local target).
 	// +optional
 	ClusterRef *CrossNamespaceClusterReference `json:"clusterRef,omitempty"`
+	// AppRef overrides the pipeline's `.spec.appRef` for this target, e.g. when the app is named differently in this
+	// environment. Any field left empty is taken from the pipeline's `.spec.appRef`.
+	// +optional
+	AppRef *TargetAppReference `json:"appRef,omitempty"`
+}
+
+// ResolveAppRef returns the reference to the app for this target, which is the given pipeline-wide reference with any fields
+// overridden by the target's `appRef`.
+func (t Target) ResolveAppRef(ref LocalAppReference) LocalAppReference {
+	if t.AppRef == nil {
+		return ref
+	}
+	if t.AppRef.APIVersion != "" {
+		ref.APIVersion = t.AppRef.APIVersion
+	}
+	if t.AppRef.Kind != "" {
+		ref.Kind = t.AppRef.Kind
+	}
+	if t.AppRef.Name != "" {
+		ref.Name = t.AppRef.Name
+	}
+	return ref
 }
 
 func (t Target) String() string {
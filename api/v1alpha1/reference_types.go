@@ -19,6 +19,29 @@ type LocalAppReference struct {
 	Name string `json:"name"`
 }
 
+// TargetAppReference overrides some or all of a pipeline's `.spec.appRef` for a single target. Fields left empty are
+// taken from the pipeline's `.spec.appRef`.
+type TargetAppReference struct {
+	// API version of the referent.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the referent.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the referent.
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// The kinds of object a CrossNamespaceClusterReference can refer to.
+const (
+	GitopsClusterKind = "GitopsCluster"
+	CAPIClusterKind   = "Cluster"
+	SecretClusterKind = "Secret"
+)
+
 // CrossNamespaceClusterReference contains enough information to let you locate the
 // typed Kubernetes resource object at cluster level.
 type CrossNamespaceClusterReference struct {
@@ -26,8 +49,10 @@ type CrossNamespaceClusterReference struct {
 	// +optional
 	APIVersion string `json:"apiVersion,omitempty"`
 
-	// Kind of the referent.
-	// +kubebuilder:validation:Enum=GitopsCluster
+	// Kind of the referent: a Weave GitOps GitopsCluster, a Cluster API Cluster, or a Secret holding a kubeconfig under
+	// the key `kubeconfig` or `value`. Cluster API Clusters and Secrets are only supported by the level-triggered
+	// controller.
+	// +kubebuilder:validation:Enum=GitopsCluster;Cluster;Secret
 	// +required
 	Kind string `json:"kind"`
 
@@ -62,6 +62,21 @@ func (in *Environment) DeepCopyInto(out *Environment) {
 		*out = new(Promotion)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.MinSoakDuration != nil {
+		in, out := &in.MinSoakDuration, &out.MinSoakDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FreezeWindows != nil {
+		in, out := &in.FreezeWindows, &out.FreezeWindows
+		*out = make([]FreezeWindow, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Environment.
@@ -85,6 +100,33 @@ func (in *EnvironmentStatus) DeepCopyInto(out *EnvironmentStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.PromotionHistory != nil {
+		in, out := &in.PromotionHistory, &out.PromotionHistory
+		*out = make([]PromotionRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InFlightPromotion != nil {
+		in, out := &in.InFlightPromotion, &out.InFlightPromotion
+		*out = new(InFlightPromotion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnhealthySince != nil {
+		in, out := &in.UnhealthySince, &out.UnhealthySince
+		*out = (*in).DeepCopy()
+	}
+	if in.LastPromotionTime != nil {
+		in, out := &in.LastPromotionTime, &out.LastPromotionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvironmentStatus.
@@ -97,6 +139,38 @@ func (in *EnvironmentStatus) DeepCopy() *EnvironmentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FreezeWindow) DeepCopyInto(out *FreezeWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FreezeWindow.
+func (in *FreezeWindow) DeepCopy() *FreezeWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(FreezeWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InFlightPromotion) DeepCopyInto(out *InFlightPromotion) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InFlightPromotion.
+func (in *InFlightPromotion) DeepCopy() *InFlightPromotion {
+	if in == nil {
+		return nil
+	}
+	out := new(InFlightPromotion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LocalAppReference) DeepCopyInto(out *LocalAppReference) {
 	*out = *in
@@ -202,6 +276,11 @@ func (in *PipelineSpec) DeepCopyInto(out *PipelineSpec) {
 		*out = new(Promotion)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.TargetStatusRules != nil {
+		in, out := &in.TargetStatusRules, &out.TargetStatusRules
+		*out = make([]TargetStatusRule, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PipelineSpec.
@@ -254,6 +333,21 @@ func (in *PipelineStatus) DeepCopy() *PipelineStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Promotion) DeepCopyInto(out *Promotion) {
 	*out = *in
+	if in.MinSoakDuration != nil {
+		in, out := &in.MinSoakDuration, &out.MinSoakDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.FreezeWindows != nil {
+		in, out := &in.FreezeWindows, &out.FreezeWindows
+		*out = make([]FreezeWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		*out = new(RollbackPolicy)
+		**out = **in
+	}
 	in.Strategy.DeepCopyInto(&out.Strategy)
 }
 
@@ -267,6 +361,23 @@ func (in *Promotion) DeepCopy() *Promotion {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotionRecord) DeepCopyInto(out *PromotionRecord) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+	in.CompletedAt.DeepCopyInto(&out.CompletedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionRecord.
+func (in *PromotionRecord) DeepCopy() *PromotionRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotionRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PullRequestPromotion) DeepCopyInto(out *PullRequestPromotion) {
 	*out = *in
@@ -283,6 +394,22 @@ func (in *PullRequestPromotion) DeepCopy() *PullRequestPromotion {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollbackPolicy) DeepCopyInto(out *RollbackPolicy) {
+	*out = *in
+	out.Timeout = in.Timeout
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollbackPolicy.
+func (in *RollbackPolicy) DeepCopy() *RollbackPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RollbackPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Strategy) DeepCopyInto(out *Strategy) {
 	*out = *in
@@ -321,6 +448,11 @@ func (in *Target) DeepCopyInto(out *Target) {
 		*out = new(CrossNamespaceClusterReference)
 		**out = **in
 	}
+	if in.AppRef != nil {
+		in, out := &in.AppRef, &out.AppRef
+		*out = new(TargetAppReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Target.
@@ -333,10 +465,29 @@ func (in *Target) DeepCopy() *Target {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetAppReference) DeepCopyInto(out *TargetAppReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetAppReference.
+func (in *TargetAppReference) DeepCopy() *TargetAppReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetAppReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetStatus) DeepCopyInto(out *TargetStatus) {
 	*out = *in
 	in.ClusterAppRef.DeepCopyInto(&out.ClusterAppRef)
+	if in.ReadySince != nil {
+		in, out := &in.ReadySince, &out.ReadySince
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetStatus.
@@ -349,6 +500,21 @@ func (in *TargetStatus) DeepCopy() *TargetStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetStatusRule) DeepCopyInto(out *TargetStatusRule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetStatusRule.
+func (in *TargetStatusRule) DeepCopy() *TargetStatusRule {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetStatusRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WaitingApproval) DeepCopyInto(out *WaitingApproval) {
 	*out = *in
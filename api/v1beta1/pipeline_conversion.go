@@ -0,0 +1,4 @@
+package v1beta1
+
+// Hub marks this type as the conversion hub; the other versions of Pipeline are converted to and from it.
+func (*Pipeline) Hub() {}
@@ -2,20 +2,23 @@ package leveltriggered
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
-	clusterctrlv1alpha1 "github.com/weaveworks/cluster-controller/api/v1alpha1"
-	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/workqueue"
-	capicfg "sigs.k8s.io/cluster-api/util/kubeconfig"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -23,6 +26,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/metrics"
+	"github.com/weaveworks/pipeline-controller/internal/sharding"
 )
 
 // caches holds all the values needed for keeping track of client caches, used for 1. querying clusters for arbitrary app objects; and,
@@ -35,6 +40,21 @@ type caches struct {
 	targetScheme *runtime.Scheme
 	cachesMap    map[clusterAndGVK]cacheAndCancel
 	cachesMu     *sync.Mutex
+	// when true, targets are watched with a cache per namespace rather than per cluster, unless a cluster's
+	// annotation says otherwise.
+	namespacedByDefault bool
+	// how long a cache is given to sync before it's recreated.
+	syncTimeout time.Duration
+	// applied to every target cache, to trim objects and restrict which are cached.
+	transform     toolscache.TransformFunc
+	labelSelector labels.Selector
+	fieldSelector fields.Selector
+
+	connectivity *connectivity
+	// how to get and connect to each kind of cluster a target can refer to.
+	clusterResolvers map[string]ClusterResolver
+	// the pipelines this controller is responsible for; only their targets are indexed, and so cached.
+	shard sharding.Shard
 
 	// these are constructed when this object is set up with a manager
 	baseLogger         logr.Logger
@@ -50,6 +70,10 @@ func newCaches(events chan event.GenericEvent, targetScheme *runtime.Scheme) *ca
 		events:       events,
 		cachesMap:    make(map[clusterAndGVK]cacheAndCancel),
 		cachesMu:     &sync.Mutex{},
+		syncTimeout:  DefaultCacheSyncTimeout,
+		connectivity: newConnectivity(),
+
+		clusterResolvers: defaultClusterResolvers(),
 	}
 }
 
@@ -69,12 +93,12 @@ func (c *caches) setupWithManager(mgr ctrl.Manager) error {
 	}
 
 	// Index the Pipelines by the cache they require for their targets.
-	if err := mgr.GetCache().IndexField(context.TODO(), &v1alpha1.Pipeline{}, cacheIndex, indexTargetCache); err != nil {
+	if err := mgr.GetCache().IndexField(context.TODO(), &v1alpha1.Pipeline{}, cacheIndex, inShard(c.shard, indexTargetCache)); err != nil {
 		return fmt.Errorf("failed setting index fields: %w", err)
 	}
 
 	// Index the Pipelines by the application references they point at.
-	if err := mgr.GetCache().IndexField(context.TODO(), &v1alpha1.Pipeline{}, applicationKey, indexApplication /* <- both from indexing.go */); err != nil {
+	if err := mgr.GetCache().IndexField(context.TODO(), &v1alpha1.Pipeline{}, applicationKey, inShard(c.shard, indexApplication) /* <- all from indexing.go */); err != nil {
 		return fmt.Errorf("failed setting index fields: %w", err)
 	}
 
@@ -90,32 +114,62 @@ func (c *caches) getCacheKeys() (res []clusterAndGVK) {
 	return res
 }
 
-// clusterAndGVK is used as the key for caches
+// clusterAndGVK is used as the key for caches. TargetNamespace is empty for a cache that watches the whole cluster,
+// and otherwise names the only namespace the cache watches.
 type clusterAndGVK struct {
 	client.ObjectKey
 	schema.GroupVersionKind
+	TargetNamespace string
 }
 
 func (key clusterAndGVK) String() string {
-	return key.ObjectKey.String() + ":" + key.GroupVersionKind.String()
+	if key.TargetNamespace == "" {
+		return key.ObjectKey.String() + ":" + key.GroupVersionKind.String()
+	}
+	return key.ObjectKey.String() + ":" + key.TargetNamespace + ":" + key.GroupVersionKind.String()
+}
+
+// isNamespaced says whether targets in the cluster given are watched with a cache per namespace. A nil cluster
+// represents the local cluster, which always follows the default.
+func (c *caches) isNamespaced(clusterObject client.Object) bool {
+	if clusterObject == nil {
+		return c.namespacedByDefault
+	}
+	if v, ok := clusterObject.GetAnnotations()[v1alpha1.NamespacedCacheAnnotation]; ok {
+		if namespaced, err := strconv.ParseBool(v); err == nil {
+			return namespaced
+		}
+	}
+	return c.namespacedByDefault
 }
 
 type cacheAndCancel struct {
-	cache  cache.Cache
-	cancel context.CancelFunc
+	cache cache.Cache
+	// informer is the cache's informer for the type it was created for.
+	informer cache.Informer
+	cancel   context.CancelFunc
+	// created is when the cache was created, to tell whether it has had long enough to sync.
+	created time.Time
+	// configHash is a hash of the kubeconfig the cache was built with, or empty for the local cluster.
+	configHash string
+	// access records whether the API server refuses what the cache asks for.
+	access *cacheAccess
 }
 
 // watchTargetAndGetReader ensures that the type (GroupVersionKind) of the target in the cluster given is being watched, and
 // returns a client.Reader.
-// A nil for the `clusterObject` argument indicates the local cluster. It returns an error if there was a problem, and otherwise
+// A nil for the `cluster` argument indicates the local cluster. It returns an error if there was a problem, and otherwise
 // a client.Reader and a bool which is true if the type was already watched and syncing.
 //
 // NB: the target object should be the object that is used as the `client.Object` argument for client.Get(...); the cache has different
 // stores for {typed values, partial values, unstructured values}, and we want to install the watcher in the same one as we will later query.
-func (c *caches) watchTargetAndGetReader(ctx context.Context, clusterObject *clusterctrlv1alpha1.GitopsCluster, target client.Object) (client.Reader, bool, error) {
-	var clusterKey client.ObjectKey
-	if clusterObject != nil {
-		clusterKey = client.ObjectKeyFromObject(clusterObject)
+func (c *caches) watchTargetAndGetReader(ctx context.Context, cluster *remoteCluster, target client.Object) (client.Reader, bool, error) {
+	var (
+		clusterKey    client.ObjectKey
+		clusterObject client.Object
+	)
+	if cluster != nil {
+		clusterKey, clusterObject = cluster.key, cluster.object
 	}
 
 	targetGVK, err := apiutil.GVKForObject(target, c.targetScheme)
@@ -126,132 +180,163 @@ func (c *caches) watchTargetAndGetReader(ctx context.Context, clusterObject *clu
 		ObjectKey:        clusterKey,
 		GroupVersionKind: targetGVK,
 	}
+	if c.isNamespaced(clusterObject) {
+		cacheKey.TargetNamespace = target.GetNamespace()
+	}
 
 	logger := c.baseLogger.WithValues("cluster", clusterKey, "type", targetGVK)
+	if cacheKey.TargetNamespace != "" {
+		logger = logger.WithValues("namespace", cacheKey.TargetNamespace)
+	}
 
-	c.cachesMu.Lock()
-	cacheEntry, cacheFound := c.cachesMap[cacheKey]
-	c.cachesMu.Unlock()
 	// To construct a cache, we need a *rest.Config. There's two ways to get one:
 	//  - for the local cluster, we can just get the already prepared one from the Manager;
 	//  - for a remote cluster, we can construct one given a kubeconfig; and the kubeconfig will be stored in a Secret,
-	//    associated with the object representing the cluster.
-	if !cacheFound {
+	//    associated with the object representing the cluster, as found by the resolver for its kind.
+	// The kubeconfig of a remote cluster is read every time (from the manager's cache), so that a cache built with
+	// credentials that have since been rotated can be replaced.
+	var (
+		kubeconfig []byte
+		configHash string
+	)
+	if cluster != nil {
+		if kubeconfig, err = cluster.resolver.Kubeconfig(ctx, cluster.reader, cluster.object); err != nil {
+			return nil, false, err
+		}
+		configHash = fmt.Sprintf("%x", sha256.Sum256(kubeconfig))
+	}
+
+	c.cachesMu.Lock()
+	cacheEntry, cacheFound := c.cachesMap[cacheKey]
+	c.cachesMu.Unlock()
+	if !cacheFound || cacheEntry.configHash != configHash || c.hasExpired(cacheEntry) {
 		logger.Info("creating cache for cluster and type")
 		var cfg *rest.Config
 
-		if clusterObject == nil {
-			cfg = c.localClusterConfig
+		if cluster == nil {
+			cfg = rest.CopyConfig(c.localClusterConfig)
 		} else {
-			var kubeconfig []byte
-			var err error
-			switch {
-			case clusterObject.Spec.CAPIClusterRef != nil:
-				var capiKey client.ObjectKey
-				capiKey.Name = clusterObject.Spec.CAPIClusterRef.Name
-				capiKey.Namespace = clusterObject.GetNamespace()
-				kubeconfig, err = capicfg.FromSecret(ctx, c.reader, capiKey)
-				if err != nil {
-					return nil, false, err
-				}
-			case clusterObject.Spec.SecretRef != nil:
-				var secretKey client.ObjectKey
-				secretKey.Name = clusterObject.Spec.SecretRef.Name
-				secretKey.Namespace = clusterObject.GetNamespace()
-
-				var sec corev1.Secret
-				if err := c.reader.Get(ctx, secretKey, &sec); err != nil {
-					return nil, false, err
-				}
-				var ok bool
-				kubeconfig, ok = sec.Data["kubeconfig"]
-				if !ok {
-					return nil, false, fmt.Errorf("referenced Secret does not have data key %s", "kubeconfig")
-				}
-			default:
-				return nil, false, fmt.Errorf("GitopsCluster object has neither .secretRef nor .capiClusterRef populated, unable to get remote cluster config")
-			}
 			cfg, err = clientcmd.RESTConfigFromKubeConfig(kubeconfig)
 			if err != nil {
 				return nil, false, err
 			}
 		}
+		access := &cacheAccess{}
+		cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return connectivityRoundTripper{next: rt, onSuccess: func() { c.recordSuccess(clusterKey, cacheKey, access, logger) }}
+		})
 
-		// having done all that, did we really need it?
-		c.cachesMu.Lock()
-		if cacheEntry, cacheFound = c.cachesMap[cacheKey]; !cacheFound {
-			ca, err := cache.New(cfg, cache.Options{
-				Scheme: c.targetScheme,
-			})
-			if err != nil {
-				c.cachesMu.Unlock()
+		opts := cache.Options{
+			Scheme:               c.targetScheme,
+			DefaultTransform:     c.transform,
+			DefaultLabelSelector: c.labelSelector,
+			DefaultFieldSelector: c.fieldSelector,
+		}
+		if cacheKey.TargetNamespace != "" {
+			// this restricts the cache to list and watch in the namespace, which is all the RBAC needed.
+			opts.Namespaces = []string{cacheKey.TargetNamespace}
+		}
+		ca, err := cache.New(cfg, opts)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// The informer is set up before the cache is started, since the watch error handler can't be set once it's
+		// running, and because getting the informer from a started cache waits for it to sync, which may never happen.
+		// This talks to the cluster to find out about the type, so it's the first thing to fail if the cluster is unreachable.
+		inf, err := ca.GetInformer(ctx, target) // NB not InformerForKind(...), because that uses the typed value cache specifically (see the method comment).
+		if err != nil {
+			c.connectivity.recordError(clusterKey, err)
+			return nil, false, &clusterUnreachableError{err: err}
+		}
+		if sharedInf, ok := inf.(toolscache.SharedIndexInformer); ok {
+			if err := sharedInf.SetWatchErrorHandler(c.watchErrorHandler(clusterKey, cacheKey, access, logger)); err != nil {
 				return nil, false, err
 			}
+		}
+		if err := c.addEventHandler(inf, clusterKey, logger); err != nil {
+			return nil, false, err
+		}
 
+		// having done all that, did we really need it?
+		c.cachesMu.Lock()
+		cacheEntry, cacheFound = c.cachesMap[cacheKey]
+		if cacheFound && (cacheEntry.configHash != configHash || c.hasExpired(cacheEntry)) {
+			logger.Info("replacing cache, because the credentials for the cluster have changed or it has not synced in time")
+			cacheEntry.cancel()
+			delete(c.cachesMap, cacheKey)
+			cacheFound = false
+		}
+		if !cacheFound {
 			cancel := c.runner.run(func(ctx context.Context) {
+				go c.expireIfNotSynced(ctx, clusterKey, cacheKey, ca, inf, access, logger)
 				if err := ca.Start(ctx); err != nil {
 					logger.Error(err, "cache exited with error")
 				}
 			})
 			cacheEntry = cacheAndCancel{
-				cache:  ca,
-				cancel: cancel,
+				cache:      ca,
+				informer:   inf,
+				cancel:     cancel,
+				configHash: configHash,
+				created:    time.Now(),
+				access:     access,
 			}
 			c.cachesMap[cacheKey] = cacheEntry
+			metrics.SetTargetCaches(len(c.cachesMap))
 		}
 		c.cachesMu.Unlock()
 		// Add it to the queue for GC consideration
 		c.cachesGC.register(cacheKey)
 	}
 
-	// Now we have a cache; make sure the object type in question is being watched, so we can query it and get updates.
-
-	// The informer is retrieved whether we created the cache or not, because we want to know if it's synced and thus ready to be queried.
-	typeCache := cacheEntry.cache
-	inf, err := typeCache.GetInformer(ctx, target) // NB not InformerForKind(...), because that uses the typed value cache specifically (see the method comment).
-	if err != nil {
-		return nil, false, err
+	if err := cacheEntry.access.get(); err != nil {
+		return nil, false, &cacheAccessError{err: err}
 	}
+	return cacheEntry.cache, cacheEntry.informer.HasSynced(), nil
+}
 
-	if !cacheFound { // meaning: we created the cache, this time around, so we'll need to install the event handler.
-		enqueuePipelinesForTarget := func(obj interface{}) {
-			eventObj, ok := obj.(client.Object)
-			if !ok {
-				logger.Info("value to look up in index was not a client.Object", "object", obj)
-				return
-			}
-			pipelines, err := c.pipelinesForApplication(clusterKey, eventObj)
-			if err != nil {
-				logger.Error(err, "failed to look up pipelines in index of applications")
-				return
-			}
-			// TODO is passing pointers here dangerous? (do they get copied, I think they might do). Alternative is to pass the whole list in the channel.
-			for i := range pipelines {
-				c.events <- event.GenericEvent{Object: &pipelines[i]}
-			}
-		}
+// hasExpired says whether the cache given has been given longer than the sync timeout to sync, without syncing. Such
+// caches are removed once they expire; this covers the time between expiring and being removed.
+func (c *caches) hasExpired(entry cacheAndCancel) bool {
+	return !entry.informer.HasSynced() && time.Since(entry.created) > c.syncTimeout
+}
 
-		_, err := inf.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				enqueuePipelinesForTarget(obj)
-			},
-			DeleteFunc: func(obj interface{}) {
-				enqueuePipelinesForTarget(obj)
-			},
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				// We're just looking up the name in the index so it'll be the same for the old as for the new object.
-				// However, this might change elsewhere, so to be defensive, run both. The queue will deduplicate,
-				// though it means we do a bit more lookup work.
-				enqueuePipelinesForTarget(oldObj)
-				enqueuePipelinesForTarget(newObj)
-			},
-		})
+// addEventHandler makes the informer given queue the pipelines using each object it sees for reconciliation.
+func (c *caches) addEventHandler(inf cache.Informer, clusterKey client.ObjectKey, logger logr.Logger) error {
+	enqueuePipelinesForTarget := func(obj interface{}) {
+		eventObj, ok := obj.(client.Object)
+		if !ok {
+			logger.Info("value to look up in index was not a client.Object", "object", obj)
+			return
+		}
+		pipelines, err := c.pipelinesForApplication(clusterKey, eventObj)
 		if err != nil {
-			return nil, false, err
+			logger.Error(err, "failed to look up pipelines in index of applications")
+			return
+		}
+		// TODO is passing pointers here dangerous? (do they get copied, I think they might do). Alternative is to pass the whole list in the channel.
+		for i := range pipelines {
+			c.events <- event.GenericEvent{Object: &pipelines[i]}
 		}
 	}
 
-	return typeCache, inf.HasSynced(), nil
+	_, err := inf.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			enqueuePipelinesForTarget(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			enqueuePipelinesForTarget(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// We're just looking up the name in the index so it'll be the same for the old as for the new object.
+			// However, this might change elsewhere, so to be defensive, run both. The queue will deduplicate,
+			// though it means we do a bit more lookup work.
+			enqueuePipelinesForTarget(oldObj)
+			enqueuePipelinesForTarget(newObj)
+		},
+	})
+	return err
 }
 
 // == target indexing ==
@@ -297,8 +382,9 @@ func (c *caches) pipelinesForApplication(clusterName client.ObjectKey, obj clien
 // cacheIndex names the index for keeping track of which pipelines use which caches.
 const cacheIndex = "cache"
 
-// This gives a string representation of a key into the caches map, so it can be used for indexing.
-// It has the signature of `targetIndexerFunc` so it can be used with `indexTargets(...)`.
+// These give a string representation of a key into the caches map, so it can be used for indexing; clusterCacheKey
+// for a cluster-wide cache, and clusterNamespaceCacheKey for a cache of the target's namespace.
+// They have the signature of `targetIndexerFunc` so they can be used with `indexTargets(...)`.
 // isCacheUsed below relies on this implementation using clusterAndGVK.String(), so that
 // the index keys it uses match what's actually indexed.
 func clusterCacheKey(clusterKey client.ObjectKey, gvk schema.GroupVersionKind, _targetKey client.ObjectKey) string {
@@ -308,10 +394,21 @@ func clusterCacheKey(clusterKey client.ObjectKey, gvk schema.GroupVersionKind, _
 	}).String()
 }
 
-// indexTargetCache is an IndexerFunc that returns a key representing the cache a target will come from. This is coupled to
-// the scheme for keeping track of caches, as embodied in the `caches` map in the reconciler the method `watchTargetAndGetReader`;
-// changing how those work, for instance caching by {cluster, namespace, type} instead,  will likely need a change here.
-var indexTargetCache = indexTargets(clusterCacheKey)
+func clusterNamespaceCacheKey(clusterKey client.ObjectKey, gvk schema.GroupVersionKind, targetKey client.ObjectKey) string {
+	return (clusterAndGVK{
+		ObjectKey:        clusterKey,
+		GroupVersionKind: gvk,
+		TargetNamespace:  targetKey.Namespace,
+	}).String()
+}
+
+// indexTargetCache is an IndexerFunc that returns keys representing the cache a target will come from. This is coupled to
+// the scheme for keeping track of caches, as embodied in the `caches` map in the reconciler the method `watchTargetAndGetReader`.
+// Whether a cluster's caches are per namespace depends on the cluster object, which isn't available here, so each target
+// is indexed under both the cluster-wide and the namespaced key; isCacheUsed sorts out which one applies.
+func indexTargetCache(o client.Object) []string {
+	return append(indexTargets(clusterCacheKey)(o), indexTargets(clusterNamespaceCacheKey)(o)...)
+}
 
 // isCacheUsed looks up the given cache key, and returns true if a pipeline uses that cache, and false otherwise; or,
 // an error if the query didn't succeed.
@@ -322,7 +419,25 @@ func (c *caches) isCacheUsed(key clusterAndGVK) (bool, error) {
 	}); err != nil {
 		return false, err
 	}
-	return len(list.Items) > 0, nil
+	if len(list.Items) == 0 {
+		return false, nil
+	}
+
+	// targets are indexed under both kinds of key, so a cache of the kind the cluster no longer uses (e.g., because
+	// its annotation was changed) would otherwise appear to be in use.
+	var clusterObject client.Object
+	if key.ObjectKey != (client.ObjectKey{}) {
+		kind, objKey := splitClusterKey(key.ObjectKey)
+		cluster, err := c.getCluster(context.TODO(), c.reader, kind, objKey)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return true, nil // leave the cache be; the pipelines' targets can't be reached until the cluster exists anyway.
+			}
+			return false, err
+		}
+		clusterObject = cluster.object
+	}
+	return c.isNamespaced(clusterObject) == (key.TargetNamespace != ""), nil
 }
 
 // removeCache stops the cache identified by `key` running.
@@ -330,11 +445,40 @@ func (c *caches) removeCache(key clusterAndGVK) {
 	c.cachesMu.Lock()
 	defer c.cachesMu.Unlock()
 	if entry, ok := c.cachesMap[key]; ok {
-		entry.cancel()
-		delete(c.cachesMap, key)
+		c.removeEntry(key, entry)
+	}
+}
+
+// removeCacheIfSame stops the cache identified by `key` running, if it is still the cache given rather than a
+// replacement.
+func (c *caches) removeCacheIfSame(key clusterAndGVK, ca cache.Cache) {
+	c.cachesMu.Lock()
+	defer c.cachesMu.Unlock()
+	if entry, ok := c.cachesMap[key]; ok && entry.cache == ca {
+		c.removeEntry(key, entry)
 	}
 }
 
+// removeEntry stops the cache entry given and removes it from the map, forgetting the connectivity of its cluster if
+// there are no other caches for it. The caller must hold cachesMu.
+func (c *caches) removeEntry(key clusterAndGVK, entry cacheAndCancel) {
+	entry.cancel()
+	delete(c.cachesMap, key)
+	metrics.SetTargetCaches(len(c.cachesMap))
+	for k := range c.cachesMap {
+		if k.ObjectKey == key.ObjectKey {
+			return
+		}
+	}
+	c.connectivity.forget(key.ObjectKey)
+}
+
+// clusterError returns the error that makes the cluster given unreachable, or nil if it's reachable as far as is known.
+// The zero key represents the local cluster.
+func (c *caches) clusterError(cluster client.ObjectKey) error {
+	return c.connectivity.err(cluster)
+}
+
 type cachesInterface interface {
 	isCacheUsed(clusterAndGVK) (bool, error)
 	removeCache(clusterAndGVK)
@@ -374,10 +518,14 @@ func (gc *gc) loop() {
 		if !ok {
 			gc.queue.Forget(item)
 			gc.queue.Done(item)
+			continue
 		}
 
 		if ok, err := gc.caches.isCacheUsed(key); err != nil {
+			// e.g., the cluster's kind is no longer served; try again later rather than dropping the key.
 			gc.log.Error(err, "calling isCacheUsed", "key", key)
+			gc.queue.Done(key)
+			gc.queue.AddRateLimited(key)
 		} else if ok {
 			// still used, requeue for consideration
 			gc.queue.Done(key)
@@ -387,6 +535,7 @@ func (gc *gc) loop() {
 			gc.queue.Forget(key)
 			gc.queue.Done(key)
 			gc.caches.removeCache(key)
+			metrics.RecordTargetCacheGCRemoval()
 		}
 	}
 }
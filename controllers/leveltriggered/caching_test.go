@@ -0,0 +1,153 @@
+package leveltriggered
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	clusterctrlv1alpha1 "github.com/weaveworks/cluster-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/sharding"
+)
+
+func TestIndexTargetCache(t *testing.T) {
+	g := NewWithT(t)
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "pipelines"},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       "app",
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name: "prod",
+					Targets: []v1alpha1.Target{
+						{
+							Namespace:  "tenant-a",
+							ClusterRef: &v1alpha1.CrossNamespaceClusterReference{Kind: "GitopsCluster", Name: "prod"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	gvk := schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Version: "v2beta1", Kind: "HelmRelease"}
+	clusterKey := client.ObjectKey{Namespace: "pipelines", Name: "prod"}
+
+	g.Expect(indexTargetCache(pipeline)).To(ConsistOf(
+		clusterAndGVK{ObjectKey: clusterKey, GroupVersionKind: gvk}.String(),
+		clusterAndGVK{ObjectKey: clusterKey, GroupVersionKind: gvk, TargetNamespace: "tenant-a"}.String(),
+	))
+}
+
+func TestInShard(t *testing.T) {
+	g := NewWithT(t)
+
+	index := func(client.Object) []string { return []string{"key"} }
+	shard, err := sharding.New("shard=a", "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	inA := &v1alpha1.Pipeline{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "pipelines", Labels: map[string]string{"shard": "a"}}}
+	inB := &v1alpha1.Pipeline{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "pipelines", Labels: map[string]string{"shard": "b"}}}
+
+	g.Expect(inShard(shard, index)(inA)).To(ConsistOf("key"))
+	g.Expect(inShard(shard, index)(inB)).To(BeEmpty())
+	g.Expect(inShard(sharding.Shard{}, index)(inB)).To(ConsistOf("key"), "everything is in the shard when not sharding")
+}
+
+func TestIsNamespaced(t *testing.T) {
+	cluster := func(annotations map[string]string) client.Object {
+		return &clusterctrlv1alpha1.GitopsCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "pipelines", Annotations: annotations},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		byDefault  bool
+		cluster    client.Object
+		namespaced bool
+	}{
+		{name: "local cluster follows the default", byDefault: true, namespaced: true},
+		{name: "cluster without annotation follows the default", cluster: cluster(nil)},
+		{
+			name:       "annotation opts a cluster in",
+			cluster:    cluster(map[string]string{v1alpha1.NamespacedCacheAnnotation: "true"}),
+			namespaced: true,
+		},
+		{
+			name:      "annotation opts a cluster out",
+			byDefault: true,
+			cluster:   cluster(map[string]string{v1alpha1.NamespacedCacheAnnotation: "false"}),
+		},
+		{
+			name:       "invalid annotation is ignored",
+			byDefault:  true,
+			cluster:    cluster(map[string]string{v1alpha1.NamespacedCacheAnnotation: "yes please"}),
+			namespaced: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			c := &caches{namespacedByDefault: tt.byDefault}
+			g.Expect(c.isNamespaced(tt.cluster)).To(Equal(tt.namespaced))
+		})
+	}
+}
+
+// failingCaches fails to say whether a cache is used a number of times, then says it isn't.
+type failingCaches struct {
+	mu       sync.Mutex
+	failures int
+	removed  chan clusterAndGVK
+}
+
+func (c *failingCaches) isCacheUsed(clusterAndGVK) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return false, errors.New("no matches for kind \"Cluster\"")
+	}
+	return false, nil
+}
+
+func (c *failingCaches) removeCache(key clusterAndGVK) {
+	c.removed <- key
+}
+
+func TestGCRetriesAfterError(t *testing.T) {
+	g := NewWithT(t)
+
+	caches := &failingCaches{failures: 2, removed: make(chan clusterAndGVK, 1)}
+	collector := &gc{
+		caches: caches,
+		queue:  workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)),
+		log:    logr.Discard(),
+	}
+	go collector.loop()
+	defer collector.queue.ShutDown()
+
+	key := clusterAndGVK{
+		ObjectKey:        client.ObjectKey{Namespace: "clusters", Name: "leaf"},
+		GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+	}
+	collector.queue.Add("not a key")
+	collector.register(key)
+
+	g.Eventually(caches.removed).Should(Receive(Equal(key)))
+}
@@ -0,0 +1,64 @@
+package leveltriggered
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+// needsCleanup returns true if the pipeline uses a promotion strategy that has to clean up after it, and hasn't opted out
+// of that with the skip cleanup annotation.
+func (r *PipelineReconciler) needsCleanup(pipeline *v1alpha1.Pipeline) bool {
+	return pipeline.GetAnnotations()[v1alpha1.SkipCleanupAnnotation] != "true" && len(r.stratReg.Cleaners(*pipeline)) > 0
+}
+
+// reconcileCleanupFinalizer adds the cleanup finalizer to the pipeline if it needs cleaning up after, and removes it
+// otherwise, e.g. when the pipeline has been annotated to skip cleanup.
+func (r *PipelineReconciler) reconcileCleanupFinalizer(ctx context.Context, pipeline *v1alpha1.Pipeline) error {
+	var changed bool
+	if r.needsCleanup(pipeline) {
+		changed = controllerutil.AddFinalizer(pipeline, v1alpha1.CleanupFinalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(pipeline, v1alpha1.CleanupFinalizer)
+	}
+	if !changed {
+		return nil
+	}
+
+	return r.Update(ctx, pipeline)
+}
+
+// reconcileDelete runs the cleanup of each promotion strategy the pipeline uses, then removes the cleanup finalizer so
+// that the pipeline can be deleted. If a cleanup fails, the finalizer stays and it is tried again.
+func (r *PipelineReconciler) reconcileDelete(ctx context.Context, pipeline *v1alpha1.Pipeline) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(pipeline, v1alpha1.CleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if pipeline.GetAnnotations()[v1alpha1.SkipCleanupAnnotation] != "true" {
+		var errs []error
+		for _, cleaner := range r.stratReg.Cleaners(*pipeline) {
+			if err := cleaner.Cleanup(ctx, *pipeline); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := kerrors.NewAggregate(errs); err != nil {
+			r.emitEventf(
+				pipeline,
+				corev1.EventTypeWarning,
+				"CleanupFailed", "Failed to clean up after pipeline %s/%s: %s",
+				pipeline.GetNamespace(), pipeline.GetName(),
+				err,
+			)
+			return ctrl.Result{}, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(pipeline, v1alpha1.CleanupFinalizer)
+	return ctrl.Result{}, r.Update(ctx, pipeline)
+}
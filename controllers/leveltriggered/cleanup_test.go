@@ -0,0 +1,152 @@
+package leveltriggered
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/testingutils"
+	"github.com/weaveworks/pipeline-controller/server/strategy"
+)
+
+// cleaningStrategy is a promotion strategy that records the pipelines it cleans up after, and fails to clean up while
+// err is set.
+type cleaningStrategy struct {
+	mu      sync.Mutex
+	cleaned []client.ObjectKey
+	err     error
+}
+
+var _ strategy.Cleaner = &cleaningStrategy{}
+
+func (s *cleaningStrategy) Handles(p v1alpha1.Promotion) bool {
+	return p.Strategy.PullRequest != nil
+}
+
+func (s *cleaningStrategy) Promote(context.Context, v1alpha1.Promotion, strategy.Promotion) (*strategy.PromotionResult, error) {
+	return &strategy.PromotionResult{}, nil
+}
+
+func (s *cleaningStrategy) Cleanup(_ context.Context, p v1alpha1.Pipeline) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.cleaned = append(s.cleaned, client.ObjectKeyFromObject(&p))
+	return nil
+}
+
+func (s *cleaningStrategy) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *cleaningStrategy) getCleaned() []client.ObjectKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]client.ObjectKey(nil), s.cleaned...)
+}
+
+func TestCleanupOnDeletion(t *testing.T) {
+	ctx := context.TODO()
+
+	strat := &cleaningStrategy{}
+	previous := pipelineReconciler.stratReg
+	pipelineReconciler.stratReg = strategy.StrategyRegistry{strat}
+	t.Cleanup(func() {
+		pipelineReconciler.stratReg = previous
+	})
+
+	withPullRequestPromotion := func(p *v1alpha1.Pipeline) *v1alpha1.Pipeline {
+		p.Spec.Promotion = &v1alpha1.Promotion{
+			Strategy: v1alpha1.Strategy{
+				PullRequest: &v1alpha1.PullRequestPromotion{
+					Type:       v1alpha1.Github,
+					URL:        "https://github.com/example/podinfo",
+					BaseBranch: "main",
+				},
+			},
+		}
+		return p
+	}
+
+	hasFinalizer := func(key client.ObjectKey) func() []string {
+		return func() []string {
+			var p v1alpha1.Pipeline
+			if err := k8sClient.Get(ctx, key, &p); err != nil {
+				return nil
+			}
+			return p.Finalizers
+		}
+	}
+
+	isDeleted := func(key client.ObjectKey) func() bool {
+		return func() bool {
+			var p v1alpha1.Pipeline
+			return apierrors.IsNotFound(k8sClient.Get(ctx, key, &p))
+		}
+	}
+
+	t.Run("cleans up before the pipeline is deleted", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+		pipeline := withPullRequestPromotion(newPipeline("pipeline-"+rand.String(5), ns.Name, nil))
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+		key := client.ObjectKeyFromObject(pipeline)
+
+		g.Eventually(hasFinalizer(key), defaultTimeout, defaultInterval).Should(ContainElement(v1alpha1.CleanupFinalizer))
+
+		g.Expect(k8sClient.Delete(ctx, pipeline)).To(Succeed())
+		g.Eventually(isDeleted(key), defaultTimeout, defaultInterval).Should(BeTrue())
+		g.Expect(strat.getCleaned()).To(ContainElement(key))
+	})
+
+	t.Run("keeps the pipeline until the cleanup succeeds or is skipped", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+		pipeline := withPullRequestPromotion(newPipeline("pipeline-"+rand.String(5), ns.Name, nil))
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+		key := client.ObjectKeyFromObject(pipeline)
+
+		g.Eventually(hasFinalizer(key), defaultTimeout, defaultInterval).Should(ContainElement(v1alpha1.CleanupFinalizer))
+
+		strat.setErr(errors.New("git provider unavailable"))
+		t.Cleanup(func() { strat.setErr(nil) })
+
+		g.Expect(k8sClient.Delete(ctx, pipeline)).To(Succeed())
+		g.Consistently(isDeleted(key), "2s", defaultInterval).Should(BeFalse())
+
+		p := getPipeline(ctx, g, key)
+		p.Annotations = map[string]string{v1alpha1.SkipCleanupAnnotation: "true"}
+		g.Expect(k8sClient.Update(ctx, p)).To(Succeed())
+
+		g.Eventually(isDeleted(key), defaultTimeout, defaultInterval).Should(BeTrue())
+		g.Expect(strat.getCleaned()).NotTo(ContainElement(key))
+	})
+
+	t.Run("doesn't add the finalizer when cleanup is skipped", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+		pipeline := withPullRequestPromotion(newPipeline("pipeline-"+rand.String(5), ns.Name, nil))
+		pipeline.Annotations = map[string]string{v1alpha1.SkipCleanupAnnotation: "true"}
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+		key := client.ObjectKeyFromObject(pipeline)
+
+		g.Eventually(func() int64 {
+			return getPipeline(ctx, g, key).Status.ObservedGeneration
+		}, defaultTimeout, defaultInterval).Should(Equal(pipeline.Generation))
+		g.Expect(getPipeline(ctx, g, key).Finalizers).NotTo(ContainElement(v1alpha1.CleanupFinalizer))
+	})
+}
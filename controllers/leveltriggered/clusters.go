@@ -0,0 +1,189 @@
+package leveltriggered
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	clusterctrlv1alpha1 "github.com/weaveworks/cluster-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capicfg "sigs.k8s.io/cluster-api/util/kubeconfig"
+	capisecret "sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/pkg/conditions"
+)
+
+// ClusterResolver deals with one kind of object that a target's `clusterRef` can refer to: it says whether such a
+// cluster is ready, and how to connect to it.
+type ClusterResolver interface {
+	// NewObject returns an empty object of the kind of cluster handled, for getting and watching clusters.
+	NewObject() client.Object
+	// NewObjectList returns an empty list of the kind of cluster handled.
+	NewObjectList() client.ObjectList
+	// IsReady says whether the cluster given is ready to have its targets looked at.
+	IsReady(cluster client.Object) bool
+	// Kubeconfig returns the kubeconfig for connecting to the cluster given.
+	Kubeconfig(ctx context.Context, c client.Reader, cluster client.Object) ([]byte, error)
+	// KubeconfigSecretName returns the name of the Secret, in the cluster's namespace, that the kubeconfig for the
+	// cluster given is read from, or an empty string if the kubeconfig doesn't come from another Secret.
+	KubeconfigSecretName(cluster client.Object) string
+}
+
+// defaultClusterResolvers returns the resolvers for the kinds of cluster allowed in a `clusterRef`, by kind.
+func defaultClusterResolvers() map[string]ClusterResolver {
+	return map[string]ClusterResolver{
+		v1alpha1.GitopsClusterKind: gitopsClusterResolver{},
+		v1alpha1.CAPIClusterKind:   capiClusterResolver{},
+		v1alpha1.SecretClusterKind: secretClusterResolver{},
+	}
+}
+
+// remoteCluster is a cluster referred to by a target, along with the resolver for its kind. A nil *remoteCluster
+// represents the local cluster.
+type remoteCluster struct {
+	key      client.ObjectKey
+	object   client.Object
+	resolver ClusterResolver
+	// reader is what the cluster object was read with, and what its kubeconfig is read with.
+	reader client.Reader
+}
+
+// qualifiedClusterKey returns the key that identifies a cluster of the kind given in caches and indexes. GitopsClusters
+// are identified by their namespace and name; for other kinds, the name is qualified with the kind, so that, e.g., a
+// Secret and a GitopsCluster with the same name are not taken to be the same cluster.
+func qualifiedClusterKey(kind string, objKey client.ObjectKey) client.ObjectKey {
+	if kind == v1alpha1.GitopsClusterKind {
+		return objKey
+	}
+	return client.ObjectKey{Namespace: objKey.Namespace, Name: kind + "/" + objKey.Name}
+}
+
+// splitClusterKey is the inverse of qualifiedClusterKey, returning the kind of cluster and the key of its object.
+func splitClusterKey(key client.ObjectKey) (string, client.ObjectKey) {
+	if kind, name, ok := strings.Cut(key.Name, "/"); ok {
+		return kind, client.ObjectKey{Namespace: key.Namespace, Name: name}
+	}
+	return v1alpha1.GitopsClusterKind, key
+}
+
+// getCluster fetches the cluster of the kind and with the key given with the reader given, using the resolver for the
+// kind.
+func (c *caches) getCluster(ctx context.Context, reader client.Reader, kind string, objKey client.ObjectKey) (*remoteCluster, error) {
+	resolver, ok := c.clusterResolvers[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cluster kind %q", kind)
+	}
+	obj := resolver.NewObject()
+	if err := reader.Get(ctx, objKey, obj); err != nil {
+		return nil, err
+	}
+	return &remoteCluster{
+		key:      qualifiedClusterKey(kind, objKey),
+		object:   obj,
+		resolver: resolver,
+		reader:   reader,
+	}, nil
+}
+
+// kubeconfigFromSecret returns the kubeconfig stored in a Secret, under either of the keys `kubeconfig` or `value`
+// (as used by Cluster API).
+func kubeconfigFromSecret(sec *corev1.Secret) ([]byte, error) {
+	for _, key := range []string{"kubeconfig", capisecret.KubeconfigDataName} {
+		if kubeconfig, ok := sec.Data[key]; ok {
+			return kubeconfig, nil
+		}
+	}
+	return nil, fmt.Errorf("referenced Secret does not have data key %s or %s", "kubeconfig", capisecret.KubeconfigDataName)
+}
+
+// gitopsClusterResolver resolves Weave GitOps' GitopsClusters, which refer to either a Secret with a kubeconfig or a
+// Cluster API cluster.
+type gitopsClusterResolver struct{}
+
+func (gitopsClusterResolver) NewObject() client.Object {
+	return &clusterctrlv1alpha1.GitopsCluster{}
+}
+
+func (gitopsClusterResolver) NewObjectList() client.ObjectList {
+	return &clusterctrlv1alpha1.GitopsClusterList{}
+}
+
+func (gitopsClusterResolver) IsReady(cluster client.Object) bool {
+	return conditions.IsReady(cluster.(*clusterctrlv1alpha1.GitopsCluster).Status.Conditions)
+}
+
+func (gitopsClusterResolver) Kubeconfig(ctx context.Context, c client.Reader, cluster client.Object) ([]byte, error) {
+	gc := cluster.(*clusterctrlv1alpha1.GitopsCluster)
+	switch {
+	case gc.Spec.CAPIClusterRef != nil:
+		return capicfg.FromSecret(ctx, c, client.ObjectKey{Namespace: gc.GetNamespace(), Name: gc.Spec.CAPIClusterRef.Name})
+	case gc.Spec.SecretRef != nil:
+		var sec corev1.Secret
+		if err := c.Get(ctx, client.ObjectKey{Namespace: gc.GetNamespace(), Name: gc.Spec.SecretRef.Name}, &sec); err != nil {
+			return nil, err
+		}
+		return kubeconfigFromSecret(&sec)
+	default:
+		return nil, fmt.Errorf("GitopsCluster object has neither .secretRef nor .capiClusterRef populated, unable to get remote cluster config")
+	}
+}
+
+func (gitopsClusterResolver) KubeconfigSecretName(cluster client.Object) string {
+	gc := cluster.(*clusterctrlv1alpha1.GitopsCluster)
+	switch {
+	case gc.Spec.CAPIClusterRef != nil:
+		return capisecret.Name(gc.Spec.CAPIClusterRef.Name, capisecret.Kubeconfig)
+	case gc.Spec.SecretRef != nil:
+		return gc.Spec.SecretRef.Name
+	}
+	return ""
+}
+
+// capiClusterResolver resolves Cluster API Clusters, whose kubeconfig is in a Secret named after the cluster.
+type capiClusterResolver struct{}
+
+func (capiClusterResolver) NewObject() client.Object {
+	return &clusterv1.Cluster{}
+}
+
+func (capiClusterResolver) NewObjectList() client.ObjectList {
+	return &clusterv1.ClusterList{}
+}
+
+func (capiClusterResolver) IsReady(cluster client.Object) bool {
+	return cluster.(*clusterv1.Cluster).Status.ControlPlaneReady
+}
+
+func (capiClusterResolver) Kubeconfig(ctx context.Context, c client.Reader, cluster client.Object) ([]byte, error) {
+	return capicfg.FromSecret(ctx, c, client.ObjectKeyFromObject(cluster))
+}
+
+func (capiClusterResolver) KubeconfigSecretName(cluster client.Object) string {
+	return capisecret.Name(cluster.GetName(), capisecret.Kubeconfig)
+}
+
+// secretClusterResolver resolves Secrets holding a kubeconfig. These are always ready.
+type secretClusterResolver struct{}
+
+func (secretClusterResolver) NewObject() client.Object {
+	return &corev1.Secret{}
+}
+
+func (secretClusterResolver) NewObjectList() client.ObjectList {
+	return &corev1.SecretList{}
+}
+
+func (secretClusterResolver) IsReady(client.Object) bool {
+	return true
+}
+
+func (secretClusterResolver) Kubeconfig(_ context.Context, _ client.Reader, cluster client.Object) ([]byte, error) {
+	return kubeconfigFromSecret(cluster.(*corev1.Secret))
+}
+
+func (secretClusterResolver) KubeconfigSecretName(client.Object) string {
+	return ""
+}
@@ -0,0 +1,134 @@
+package leveltriggered
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	clusterctrlv1alpha1 "github.com/weaveworks/cluster-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+func TestQualifiedClusterKey(t *testing.T) {
+	objKey := client.ObjectKey{Namespace: "clusters", Name: "prod"}
+
+	for _, kind := range []string{v1alpha1.GitopsClusterKind, v1alpha1.CAPIClusterKind, v1alpha1.SecretClusterKind} {
+		t.Run(kind, func(t *testing.T) {
+			g := NewWithT(t)
+			key := qualifiedClusterKey(kind, objKey)
+			gotKind, gotObjKey := splitClusterKey(key)
+			g.Expect(gotKind).To(Equal(kind))
+			g.Expect(gotObjKey).To(Equal(objKey))
+		})
+	}
+
+	g := NewWithT(t)
+	g.Expect(qualifiedClusterKey(v1alpha1.GitopsClusterKind, objKey)).To(Equal(objKey))
+	g.Expect(qualifiedClusterKey(v1alpha1.SecretClusterKind, objKey)).NotTo(Equal(qualifiedClusterKey(v1alpha1.CAPIClusterKind, objKey)))
+}
+
+func TestClusterResolvers(t *testing.T) {
+	const kubeconfig = "apiVersion: v1\nkind: Config\n"
+
+	secret := func(name, key string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters"},
+			Data:       map[string][]byte{key: []byte(kubeconfig)},
+		}
+	}
+
+	s := runtime.NewScheme()
+	g := NewWithT(t)
+	g.Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	g.Expect(clusterctrlv1alpha1.AddToScheme(s)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(s)).To(Succeed())
+
+	reader := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		secret("gitops-kubeconfig", "kubeconfig"),
+		secret("capi-kubeconfig", "value"),
+	).Build()
+
+	tests := []struct {
+		name       string
+		resolver   ClusterResolver
+		cluster    client.Object
+		ready      bool
+		secretName string
+	}{
+		{
+			name:     "GitopsCluster with secretRef",
+			resolver: gitopsClusterResolver{},
+			cluster: &clusterctrlv1alpha1.GitopsCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "gitops", Namespace: "clusters"},
+				Spec: clusterctrlv1alpha1.GitopsClusterSpec{
+					SecretRef: &meta.LocalObjectReference{Name: "gitops-kubeconfig"},
+				},
+				Status: clusterctrlv1alpha1.GitopsClusterStatus{
+					Conditions: []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue}},
+				},
+			},
+			ready:      true,
+			secretName: "gitops-kubeconfig",
+		},
+		{
+			name:     "GitopsCluster with capiClusterRef",
+			resolver: gitopsClusterResolver{},
+			cluster: &clusterctrlv1alpha1.GitopsCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "gitops", Namespace: "clusters"},
+				Spec: clusterctrlv1alpha1.GitopsClusterSpec{
+					CAPIClusterRef: &meta.LocalObjectReference{Name: "capi"},
+				},
+			},
+			secretName: "capi-kubeconfig",
+		},
+		{
+			name:     "CAPI Cluster",
+			resolver: capiClusterResolver{},
+			cluster: &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "capi", Namespace: "clusters"},
+				Status:     clusterv1.ClusterStatus{ControlPlaneReady: true},
+			},
+			ready:      true,
+			secretName: "capi-kubeconfig",
+		},
+		{
+			name:     "Secret with kubeconfig key",
+			resolver: secretClusterResolver{},
+			cluster:  secret("plain", "kubeconfig"),
+			ready:    true,
+		},
+		{
+			name:     "Secret with value key",
+			resolver: secretClusterResolver{},
+			cluster:  secret("plain", "value"),
+			ready:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tt.resolver.IsReady(tt.cluster)).To(Equal(tt.ready))
+			g.Expect(tt.resolver.KubeconfigSecretName(tt.cluster)).To(Equal(tt.secretName))
+
+			got, err := tt.resolver.Kubeconfig(context.TODO(), reader, tt.cluster)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(got)).To(Equal(kubeconfig))
+		})
+	}
+
+	t.Run("Secret without a kubeconfig", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := secretClusterResolver{}.Kubeconfig(context.TODO(), reader, secret("plain", "ca.crt"))
+		g.Expect(err).To(MatchError(ContainSubstring("does not have data key")))
+	})
+}
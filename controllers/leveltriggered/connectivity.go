@@ -0,0 +1,294 @@
+package leveltriggered
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+// DefaultCacheSyncTimeout is how long a target cache is given to sync before it's torn down and recreated, unless
+// overridden with WithCacheSyncTimeout.
+const DefaultCacheSyncTimeout = 2 * time.Minute
+
+// clusterConnectivity records how requests to a cluster have gone lately.
+type clusterConnectivity struct {
+	// lastSuccess is when a request to the cluster last succeeded, or a cache for the cluster synced.
+	lastSuccess time.Time
+	// lastError is the last error seen watching or talking to the cluster, and lastErrorTime when that was.
+	lastError     error
+	lastErrorTime time.Time
+}
+
+// reachable says whether the cluster is reachable, i.e., nothing has gone wrong since the last success.
+func (cc clusterConnectivity) reachable() bool {
+	return cc.lastError == nil || cc.lastSuccess.After(cc.lastErrorTime)
+}
+
+// connectivity keeps track of the connectivity of each cluster there are caches for. The local cluster has the zero key.
+type connectivity struct {
+	mu       sync.Mutex
+	clusters map[client.ObjectKey]clusterConnectivity
+}
+
+func newConnectivity() *connectivity {
+	return &connectivity{
+		clusters: make(map[client.ObjectKey]clusterConnectivity),
+	}
+}
+
+// recordSuccess notes that the cluster was just talked to successfully. It returns true if the cluster was unreachable
+// until now.
+func (c *connectivity) recordSuccess(cluster client.ObjectKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cc := c.clusters[cluster]
+	wasReachable := cc.reachable()
+	cc.lastSuccess = time.Now()
+	c.clusters[cluster] = cc
+	return !wasReachable
+}
+
+// recordError notes that something went wrong talking to the cluster. It returns true if the cluster was reachable
+// until now.
+func (c *connectivity) recordError(cluster client.ObjectKey, err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cc := c.clusters[cluster]
+	wasReachable := cc.reachable()
+	cc.lastError = err
+	cc.lastErrorTime = time.Now()
+	c.clusters[cluster] = cc
+	return wasReachable
+}
+
+// err returns the last error seen for the cluster if it's unreachable, and nil otherwise.
+func (c *connectivity) err(cluster client.ObjectKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cc := c.clusters[cluster]; !cc.reachable() {
+		return cc.lastError
+	}
+	return nil
+}
+
+// get returns what's known about the connectivity of the cluster.
+func (c *connectivity) get(cluster client.ObjectKey) clusterConnectivity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clusters[cluster]
+}
+
+// forget drops what's known about a cluster, e.g., when it has no caches left.
+func (c *connectivity) forget(cluster client.ObjectKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clusters, cluster)
+}
+
+// cacheAccess records whether the API server refuses a cache what it asks for, e.g., because the credentials it uses
+// may not list in the namespace it watches. Unlike connectivity, this is particular to the cache rather than the cluster.
+type cacheAccess struct {
+	mu  sync.Mutex
+	err error
+}
+
+// refuse notes that the cache was refused access. It returns true if it was allowed until now.
+func (a *cacheAccess) refuse(err error) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	wasAllowed := a.err == nil
+	a.err = err
+	return wasAllowed
+}
+
+// allow notes that a request of the cache succeeded. It returns true if it was refused until now.
+func (a *cacheAccess) allow() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	wasRefused := a.err != nil
+	a.err = nil
+	return wasRefused
+}
+
+// get returns the error the cache was last refused with, or nil if it's allowed as far as is known.
+func (a *cacheAccess) get() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// cacheAccessError is returned by watchTargetAndGetReader when the API server refuses the cache what it asks for.
+type cacheAccessError struct {
+	err error
+}
+
+func (e *cacheAccessError) Error() string {
+	return fmt.Sprintf("Target cannot be watched: %s", e.err)
+}
+
+func (e *cacheAccessError) Unwrap() error {
+	return e.err
+}
+
+// watchErrorKind says what an error from watching a cluster says about the cluster.
+type watchErrorKind int
+
+const (
+	// routineWatchError is an error the informer recovers from by itself, e.g., an expired resource version.
+	routineWatchError watchErrorKind = iota
+	// accessWatchError is the API server refusing a request, which is particular to the cache making it.
+	accessWatchError
+	// connectivityWatchError means the cluster couldn't be talked to.
+	connectivityWatchError
+)
+
+// classifyWatchError says what kind of error the one given is. Only errors in reaching the API server, or from the
+// API server failing, count against the connectivity of the cluster.
+func classifyWatchError(err error) watchErrorKind {
+	switch {
+	case errors.Is(err, io.EOF), apierrors.IsResourceExpired(err), apierrors.IsGone(err):
+		return routineWatchError
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return accessWatchError
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if status.Status().Code >= http.StatusInternalServerError {
+			return connectivityWatchError
+		}
+		return routineWatchError
+	}
+
+	// dial, TLS and timeout errors all come as a *url.Error, which is a net.Error.
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return connectivityWatchError
+	}
+	return routineWatchError
+}
+
+// clusterUnreachableError is returned by watchTargetAndGetReader when a cache can't be set up because the cluster
+// can't be reached.
+type clusterUnreachableError struct {
+	err error
+}
+
+func (e *clusterUnreachableError) Error() string {
+	return fmt.Sprintf("Target cluster unreachable: %s", e.err)
+}
+
+func (e *clusterUnreachableError) Unwrap() error {
+	return e.err
+}
+
+// connectivityRoundTripper records each successful response from a cluster, so that a cluster is seen to be reachable
+// again after the watches on it failed.
+type connectivityRoundTripper struct {
+	next      http.RoundTripper
+	onSuccess func()
+}
+
+func (rt connectivityRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		rt.onSuccess()
+	}
+	return resp, err
+}
+
+// recordSuccess notes that the cluster given is reachable and the cache given is allowed what it asks for. If the
+// cluster wasn't reachable before, the pipelines using any of its caches are queued so that their status is brought up
+// to date; if only the cache was refused before, the pipelines using it are.
+func (c *caches) recordSuccess(cluster client.ObjectKey, key clusterAndGVK, access *cacheAccess, logger logr.Logger) {
+	if c.connectivity.recordSuccess(cluster) {
+		logger.Info("target cluster is reachable again")
+		go c.enqueuePipelinesUsingCluster(cluster, logger)
+	}
+	if access.allow() {
+		logger.Info("target cache is allowed access again")
+		go c.enqueuePipelinesUsingCache(key, logger)
+	}
+}
+
+// watchErrorHandler returns an informer's watch error handler. An error in reaching the cluster is recorded for the
+// cluster, and if the cluster was reachable before, the pipelines using any of its caches are queued so that the error
+// is shown in their status. A refusal is recorded for the cache alone, and shown in the status of the pipelines using
+// it. Routine errors, such as an expired resource version, are left to the informer.
+func (c *caches) watchErrorHandler(cluster client.ObjectKey, key clusterAndGVK, access *cacheAccess, logger logr.Logger) toolscache.WatchErrorHandler {
+	return func(r *toolscache.Reflector, err error) {
+		toolscache.DefaultWatchErrorHandler(r, err)
+		switch classifyWatchError(err) {
+		case connectivityWatchError:
+			if c.connectivity.recordError(cluster, err) {
+				logger.Info("target cluster has become unreachable", "error", err.Error())
+				go c.enqueuePipelinesUsingCluster(cluster, logger)
+			}
+		case accessWatchError:
+			if access.refuse(err) {
+				logger.Info("target cache has been refused access", "error", err.Error())
+				go c.enqueuePipelinesUsingCache(key, logger)
+			}
+		}
+	}
+}
+
+// expireIfNotSynced waits for the informer of the cache given to sync. If it hasn't synced within the sync timeout, the
+// cache is removed and the pipelines using it are queued, so that it's recreated when they are reconciled.
+func (c *caches) expireIfNotSynced(ctx context.Context, cluster client.ObjectKey, key clusterAndGVK, ca cache.Cache, inf cache.Informer, access *cacheAccess, logger logr.Logger) {
+	syncCtx, cancel := context.WithTimeout(ctx, c.syncTimeout)
+	defer cancel()
+	if toolscache.WaitForCacheSync(syncCtx.Done(), inf.HasSynced) {
+		c.recordSuccess(cluster, key, access, logger)
+		return
+	}
+	if ctx.Err() != nil {
+		return // the cache was removed, or the manager is shutting down.
+	}
+
+	logger.Info("cache did not sync in time, recreating it", "timeout", c.syncTimeout)
+	// a cache that was refused access says nothing about the cluster.
+	if c.connectivity.err(cluster) == nil && access.get() == nil {
+		c.connectivity.recordError(cluster, fmt.Errorf("cache did not sync within %s", c.syncTimeout))
+	}
+	c.removeCacheIfSame(key, ca)
+	c.enqueuePipelinesUsingCache(key, logger)
+}
+
+// enqueuePipelinesUsingCluster queues the pipelines with targets that come from any cache for the cluster given for
+// reconciliation.
+func (c *caches) enqueuePipelinesUsingCluster(cluster client.ObjectKey, logger logr.Logger) {
+	for _, key := range c.getCacheKeys() {
+		if key.ObjectKey == cluster {
+			c.enqueuePipelinesUsingCache(key, logger)
+		}
+	}
+}
+
+// enqueuePipelinesUsingCache queues the pipelines with targets that come from the cache given for reconciliation.
+func (c *caches) enqueuePipelinesUsingCache(key clusterAndGVK, logger logr.Logger) {
+	var list v1alpha1.PipelineList
+	if err := c.reader.List(context.Background(), &list, client.MatchingFields{
+		cacheIndex: key.String(),
+	}); err != nil {
+		logger.Error(err, "failed to look up pipelines in index of caches")
+		return
+	}
+	for i := range list.Items {
+		c.events <- event.GenericEvent{Object: &list.Items[i]}
+	}
+}
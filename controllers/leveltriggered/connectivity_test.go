@@ -0,0 +1,139 @@
+package leveltriggered
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestConnectivity(t *testing.T) {
+	g := NewWithT(t)
+
+	c := newConnectivity()
+	cluster := client.ObjectKey{Namespace: "clusters", Name: "leaf"}
+
+	g.Expect(c.err(cluster)).To(BeNil(), "nothing known yet")
+	g.Expect(c.recordSuccess(cluster)).To(BeFalse(), "was not unreachable before")
+
+	failure := errors.New("connection refused")
+	g.Expect(c.recordError(cluster, failure)).To(BeTrue(), "became unreachable")
+	g.Expect(c.recordError(cluster, failure)).To(BeFalse(), "was unreachable already")
+	g.Expect(c.err(cluster)).To(MatchError(failure))
+	g.Expect(c.err(client.ObjectKey{})).To(BeNil(), "other clusters are unaffected")
+
+	g.Expect(c.recordSuccess(cluster)).To(BeTrue(), "became reachable again")
+	g.Expect(c.err(cluster)).To(BeNil())
+
+	c.recordError(cluster, failure)
+	c.forget(cluster)
+	g.Expect(c.err(cluster)).To(BeNil(), "forgotten")
+}
+
+func TestConnectivityRoundTripper(t *testing.T) {
+	g := NewWithT(t)
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	var successes int
+	httpClient := &http.Client{Transport: connectivityRoundTripper{
+		next:      http.DefaultTransport,
+		onSuccess: func() { successes++ },
+	}}
+
+	resp, err := httpClient.Get(server.URL)
+	g.Expect(err).NotTo(HaveOccurred())
+	resp.Body.Close()
+	g.Expect(successes).To(Equal(1))
+
+	status = http.StatusForbidden
+	resp, err = httpClient.Get(server.URL)
+	g.Expect(err).NotTo(HaveOccurred())
+	resp.Body.Close()
+	g.Expect(successes).To(Equal(1), "errors from the API server are not successes")
+}
+
+func TestCacheAccess(t *testing.T) {
+	g := NewWithT(t)
+
+	var a cacheAccess
+	g.Expect(a.get()).To(BeNil(), "nothing known yet")
+	g.Expect(a.allow()).To(BeFalse(), "was not refused before")
+
+	refusal := apierrors.NewForbidden(schema.GroupResource{Resource: "deployments"}, "", errors.New("no RBAC"))
+	g.Expect(a.refuse(refusal)).To(BeTrue(), "became refused")
+	g.Expect(a.refuse(refusal)).To(BeFalse(), "was refused already")
+	g.Expect(a.get()).To(MatchError(refusal))
+
+	g.Expect(a.allow()).To(BeTrue(), "became allowed again")
+	g.Expect(a.get()).To(BeNil())
+}
+
+func TestClassifyWatchError(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		name     string
+		err      error
+		expected watchErrorKind
+	}{
+		{
+			name:     "watch closed",
+			err:      io.EOF,
+			expected: routineWatchError,
+		},
+		{
+			name:     "resource version expired",
+			err:      apierrors.NewResourceExpired("too old resource version"),
+			expected: routineWatchError,
+		},
+		{
+			name:     "gone",
+			err:      apierrors.NewGone("gone"),
+			expected: routineWatchError,
+		},
+		{
+			name:     "forbidden list",
+			err:      fmt.Errorf("failed to list *v1.Deployment: %w", apierrors.NewForbidden(deployments, "", errors.New("no RBAC"))),
+			expected: accessWatchError,
+		},
+		{
+			name:     "unauthorized",
+			err:      apierrors.NewUnauthorized("expired token"),
+			expected: accessWatchError,
+		},
+		{
+			name:     "API server failing",
+			err:      apierrors.NewServiceUnavailable("etcd unavailable"),
+			expected: connectivityWatchError,
+		},
+		{
+			name:     "dial failure",
+			err:      fmt.Errorf("failed to list *v1.Deployment: %w", &url.Error{Op: "Get", URL: "https://leaf:6443", Err: errors.New("connection refused")}),
+			expected: connectivityWatchError,
+		},
+		{
+			name:     "connection dropped",
+			err:      io.ErrUnexpectedEOF,
+			expected: connectivityWatchError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(classifyWatchError(tt.err)).To(Equal(tt.expected))
+		})
+	}
+}
@@ -2,43 +2,65 @@ package leveltriggered
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/fluxcd/pkg/runtime/patch"
-	clusterctrlv1alpha1 "github.com/weaveworks/cluster-controller/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/clusteraccess"
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
+	"github.com/weaveworks/pipeline-controller/internal/metrics"
+	"github.com/weaveworks/pipeline-controller/internal/tracing"
 	"github.com/weaveworks/pipeline-controller/pkg/conditions"
+	"github.com/weaveworks/pipeline-controller/pkg/freeze"
+	"github.com/weaveworks/pipeline-controller/pkg/targetstatus"
 	"github.com/weaveworks/pipeline-controller/server/strategy"
 )
 
+// DefaultPromotionRetryBackoff is how long an in-flight promotion is given to take effect before the promotion strategy is
+// run again, and how long until a failed promotion is retried, unless overridden with WithPromotionRetryBackoff.
+const DefaultPromotionRetryBackoff = 30 * time.Minute
+
 // PipelineReconciler reconciles a Pipeline object
 type PipelineReconciler struct {
 	client.Client
-	Scheme         *runtime.Scheme
-	ControllerName string
-	caches         *caches
-	recorder       record.EventRecorder
-	stratReg       strategy.StrategyRegistry
+	Scheme                *runtime.Scheme
+	ControllerName        string
+	caches                *caches
+	recorder              record.EventRecorder
+	stratReg              strategy.StrategyRegistry
+	promotionRetryBackoff time.Duration
+	targetStatus          *targetstatus.Resolver
+	impersonator          *impersonation.Impersonator
+	clusterAccess         clusteraccess.Policy
 
 	appEvents chan event.GenericEvent
 }
 
-func NewPipelineReconciler(c client.Client, s *runtime.Scheme, controllerName string, eventRecorder record.EventRecorder, stratReg strategy.StrategyRegistry) *PipelineReconciler {
+func NewPipelineReconciler(c client.Client, s *runtime.Scheme, controllerName string, eventRecorder record.EventRecorder, stratReg strategy.StrategyRegistry, opts ...Opt) *PipelineReconciler {
 	appEvents := make(chan event.GenericEvent)
 
 	// this is empty because we're going to use unstructured.Unstructured objects to support arbitrary types.
@@ -53,7 +75,14 @@ func NewPipelineReconciler(c client.Client, s *runtime.Scheme, controllerName st
 		stratReg:       stratReg,
 		caches:         newCaches(appEvents, targetScheme),
 		appEvents:      appEvents,
+
+		promotionRetryBackoff: DefaultPromotionRetryBackoff,
 	}
+
+	for _, opt := range opts {
+		opt(pc)
+	}
+
 	return pc
 }
 
@@ -61,6 +90,7 @@ func NewPipelineReconciler(c client.Client, s *runtime.Scheme, controllerName st
 //+kubebuilder:rbac:groups=pipelines.weave.works,resources=pipelines/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=pipelines.weave.works,resources=pipelines/finalizers,verbs=update
 //+kubebuilder:rbac:groups=gitops.weave.works,resources=gitopsclusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 
 func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -70,31 +100,58 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	var pipeline v1alpha1.Pipeline
 	if err := r.Get(ctx, req.NamespacedName, &pipeline); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.DeletePipeline(req.Namespace, req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
 	// Examine if the object is under deletion
 	if !pipeline.ObjectMeta.DeletionTimestamp.IsZero() {
-		// Stop reconciliation as the object is being deleted
-		return ctrl.Result{}, nil
+		metrics.DeletePipeline(pipeline.Namespace, pipeline.Name)
+		// Stop reconciliation as the object is being deleted, once the promotion strategies have cleaned up after it
+		return r.reconcileDelete(ctx, &pipeline)
+	}
+
+	// the finalizer needs to be in place before promoting, since that is what leaves things behind to clean up.
+	if err := r.reconcileCleanupFinalizer(ctx, &pipeline); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update the cleanup finalizer: %w", err)
 	}
 
 	patcher := patch.NewSerialPatcher(&pipeline, r.Client)
 	withFieldOwner := patch.WithFieldOwner(r.ControllerName)
 
 	envStatuses := map[string]*v1alpha1.EnvironmentStatus{}
-	var unready bool
+	var unready, unreachable, notAllowed bool
+
+	// the clusters, kubeconfigs and local targets of the pipeline are read from the manager's caches, but only if its
+	// service account, if it has one, is allowed to read them.
+	pipelineReader, serviceAccountErr := r.pipelineReader(&pipeline, r.Client)
+	if serviceAccountErr != nil && !errors.Is(serviceAccountErr, impersonation.ErrServiceAccountRequired) {
+		return ctrl.Result{}, serviceAccountErr
+	}
 
 	for _, env := range pipeline.Spec.Environments {
-		var envStatus v1alpha1.EnvironmentStatus
+		// start from the previous status, so that fields not calculated here (e.g., the promotion history) are kept.
+		envStatus := &v1alpha1.EnvironmentStatus{}
+		if previous := pipeline.Status.Environments[env.Name]; previous != nil {
+			envStatus = previous.DeepCopy()
+		}
+		previousTargets := envStatus.Targets
 		envStatus.Targets = make([]v1alpha1.TargetStatus, len(env.Targets))
-		envStatuses[env.Name] = &envStatus
+		envStatuses[env.Name] = envStatus
 
 		for i, target := range env.Targets {
 			targetStatus := &envStatus.Targets[i]
-			targetStatus.ClusterAppRef.LocalAppReference = pipeline.Spec.AppRef
+			targetStatus.ClusterAppRef.LocalAppReference = target.ResolveAppRef(pipeline.Spec.AppRef)
+			if serviceAccountErr != nil {
+				targetStatus.ClusterAppRef.ClusterRef = target.ClusterRef
+				targetStatus.Error = serviceAccountErr.Error()
+				unready = true
+				continue
+			}
 
-			var clusterObject *clusterctrlv1alpha1.GitopsCluster
+			var cluster *remoteCluster
 			if target.ClusterRef != nil {
 				// record the fact of the remote cluster in the target status
 				targetStatus.ClusterAppRef.ClusterRef = target.ClusterRef
@@ -103,7 +160,7 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 				// every time. We might have been queued because of a cluster disappearing.
 
 				var err error
-				clusterObject, err = r.getCluster(ctx, pipeline, *target.ClusterRef)
+				cluster, err = r.getCluster(ctx, pipelineReader, pipeline, *target.ClusterRef)
 				if err != nil {
 					// emit the event whatever problem there was
 					r.emitEventf(
@@ -116,7 +173,8 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 					)
 
 					// not found -- fine, maybe things are happening out of order; make a note and wait until the cluster exists (or something else happens).
-					if apierrors.IsNotFound(err) {
+					// The same goes for a kind of cluster whose API isn't installed.
+					if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
 						targetStatus.Error = err.Error()
 						unready = true
 						continue
@@ -126,7 +184,13 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 					return ctrl.Result{}, err
 				}
 
-				if !conditions.IsReady(clusterObject.Status.Conditions) {
+				if err := r.clusterAccess.Check(pipeline.Namespace, cluster.object); err != nil {
+					targetStatus.Error = err.Error()
+					unready, notAllowed = true, true
+					continue
+				}
+
+				if !cluster.resolver.IsReady(cluster.object) {
 					msg := fmt.Sprintf("Target cluster '%s' not ready", target.ClusterRef.String())
 					targetStatus.Error = msg
 					unready = true
@@ -141,20 +205,50 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 				continue
 			}
 
-			// it's OK if clusterObject is still `nil` -- that represents the local cluster.
-			clusterClient, ok, err := r.caches.watchTargetAndGetReader(ctx, clusterObject, targetObj)
+			// it's OK if cluster is still `nil` -- that represents the local cluster.
+			clusterClient, ok, err := r.caches.watchTargetAndGetReader(ctx, cluster, targetObj)
 			if err != nil {
-				return ctrl.Result{}, err
+				var (
+					unreachableErr *clusterUnreachableError
+					accessErr      *cacheAccessError
+				)
+				switch {
+				case errors.As(err, &unreachableErr):
+					targetStatus.Error = err.Error()
+					unready, unreachable = true, true
+				case errors.As(err, &accessErr):
+					targetStatus.Error = err.Error()
+					unready = true
+				default:
+					return ctrl.Result{}, err
+				}
+				continue
+			}
+			// the cache may have synced before the cluster became unreachable, in which case what it has is stale.
+			var clusterKey client.ObjectKey
+			if cluster != nil {
+				clusterKey = cluster.key
+			}
+			if err := r.caches.clusterError(clusterKey); err != nil {
+				targetStatus.Error = (&clusterUnreachableError{err: err}).Error()
+				unready, unreachable = true, true
+				continue
 			}
 			if !ok {
 				targetStatus.Error = "Target cluster client is not synced"
 				unready = true
 				continue
 			}
+			var targetReader client.Reader = clusterClient
+			if cluster == nil {
+				// the cache holds what the controller's own identity can read, so the target is only read from it if the
+				// pipeline's service account may read it. The service account error was dealt with above.
+				targetReader, _ = r.pipelineReader(&pipeline, clusterClient)
+			}
 
 			targetKey := client.ObjectKeyFromObject(targetObj)
 			// look up the actual application
-			err = clusterClient.Get(ctx, targetKey, targetObj)
+			err = targetReader.Get(ctx, targetKey, targetObj)
 			if err != nil {
 				r.emitEventf(
 					&pipeline,
@@ -169,19 +263,54 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 				unready = true
 				continue
 			}
-			setTargetStatus(targetStatus, targetObj)
+			r.setTargetStatus(&pipeline, targetStatus, targetObj)
+			setReadySince(targetStatus, previousTargets, i)
 		}
+
+		setKnownGoodRevision(envStatus, metav1.Now())
+		summarizeEnvironment(envStatus)
 	}
 
+	dependenciesErr := pipeline.Spec.ValidateDependencies()
+
 	var readyCondition metav1.Condition
-	if unready {
+	switch {
+	case dependenciesErr != nil:
+		readyCondition = metav1.Condition{
+			Type:    conditions.ReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  v1alpha1.InvalidDependenciesReason,
+			Message: trimString(dependenciesErr.Error(), v1alpha1.MaxConditionMessageLength),
+		}
+	case serviceAccountErr != nil:
+		readyCondition = metav1.Condition{
+			Type:    conditions.ReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  v1alpha1.ServiceAccountRequiredReason,
+			Message: trimString(serviceAccountErr.Error(), v1alpha1.MaxConditionMessageLength),
+		}
+	case notAllowed:
+		readyCondition = metav1.Condition{
+			Type:    conditions.ReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  v1alpha1.TargetClusterNotAllowedReason,
+			Message: "One or more target clusters may not be referred to from the namespace of the pipeline",
+		}
+	case unreachable:
+		readyCondition = metav1.Condition{
+			Type:    conditions.ReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  v1alpha1.TargetClusterUnreachableReason,
+			Message: "One or more target clusters could not be reached",
+		}
+	case unready:
 		readyCondition = metav1.Condition{
 			Type:    conditions.ReadyCondition,
 			Status:  metav1.ConditionFalse,
 			Reason:  v1alpha1.TargetNotReadableReason,
 			Message: "One or more targets was not reachable or not present",
 		}
-	} else {
+	default:
 		readyCondition = metav1.Condition{
 			Type:    conditions.ReadyCondition,
 			Status:  metav1.ConditionTrue,
@@ -193,6 +322,11 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	pipeline.Status.ObservedGeneration = pipeline.Generation
 	apimeta.SetStatusCondition(&pipeline.Status.Conditions, readyCondition)
 	pipeline.Status.Environments = envStatuses
+	setEnvironmentRevisions(&pipeline)
+	recordTargetMetrics(&pipeline)
+	if dependenciesErr != nil {
+		removeEnvironmentPendingConditions(&pipeline, nil)
+	}
 	if err := patcher.Patch(ctx, &pipeline, withFieldOwner); err != nil {
 		r.emitEventf(
 			&pipeline,
@@ -210,27 +344,49 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		pipeline.GetNamespace(), pipeline.GetName(),
 	)
 
+	if dependenciesErr != nil {
+		// there's no sensible order to promote in; this will be retried when the pipeline is changed.
+		return ctrl.Result{}, nil
+	}
+	if serviceAccountErr != nil {
+		// nothing can be promoted without reading the targets; this will be retried when the pipeline is changed.
+		return ctrl.Result{}, nil
+	}
+
+	// this is rejected by the validating webhook, but that may not be installed.
+	if len(pipeline.Spec.Environments) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	// rolling back doesn't depend on the state of the other environments, so it's done before checking whether there's a
+	// revision to promote. Any changes to the status are persisted by the patches below.
+	rollbackRequeueAfter, rollbackErr := r.rollBackUnhealthyEnvironments(ctx, &pipeline)
+
+	// A valid dependency graph has exactly one root, which is the first environment, since every other environment
+	// depends on the one before it unless it says otherwise.
 	firstEnv := pipeline.Spec.Environments[0]
 
 	latestRevision := checkAllTargetsHaveSameRevision(pipeline.Status.Environments[firstEnv.Name])
 	if latestRevision == "" {
 		// not all targets have the same revision, or have no revision set, so we can't proceed
 		setPendingCondition(&pipeline, v1alpha1.EnvironmentNotReadyReason, "Waiting for all targets to have the same revision")
+		removeEnvironmentPendingConditions(&pipeline, nil)
 		if err := patcher.Patch(ctx, &pipeline, withFieldOwner); err != nil {
 			return ctrl.Result{Requeue: true}, fmt.Errorf("error setting pending condition: %w", err)
 		}
 
-		return ctrl.Result{}, nil
+		return ctrl.Result{RequeueAfter: rollbackRequeueAfter}, rollbackErr
 	}
 
 	if !checkAllTargetsAreReady(pipeline.Status.Environments[firstEnv.Name]) {
 		// not all targets are ready, so we can't proceed
 		setPendingCondition(&pipeline, v1alpha1.EnvironmentNotReadyReason, "Waiting for all targets to be ready")
+		removeEnvironmentPendingConditions(&pipeline, nil)
 		if err := patcher.Patch(ctx, &pipeline, withFieldOwner); err != nil {
 			return ctrl.Result{}, fmt.Errorf("error setting pending condition: %w", err)
 		}
 
-		return ctrl.Result{}, nil
+		return ctrl.Result{RequeueAfter: rollbackRequeueAfter}, rollbackErr
 	}
 
 	removePendingCondition(&pipeline)
@@ -238,25 +394,164 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, fmt.Errorf("error removing pending condition: %w", err)
 	}
 
+	requeueAfter := rollbackRequeueAfter
+	var promotionErrs []error
+	// the environments for which a promotion is held back; the others have their PromotionPending condition removed below.
+	pendingEnvs := map[string]bool{}
+	if rollbackErr != nil {
+		promotionErrs = append(promotionErrs, rollbackErr)
+	}
+
 	for _, env := range pipeline.Spec.Environments[1:] {
+		envStatus := pipeline.Status.Environments[env.Name]
+
+		// a revision that was rolled back is only held back until there's a newer one
+		if envStatus.RolledBackRevision != "" && envStatus.RolledBackRevision != latestRevision {
+			envStatus.RolledBackRevision = ""
+		}
+
 		// if all targets run the latest revision and are ready, we can skip this environment
-		if checkAllTargetsRunRevision(pipeline.Status.Environments[env.Name], latestRevision) && checkAllTargetsAreReady(pipeline.Status.Environments[env.Name]) {
+		if checkAllTargetsRunRevision(envStatus, latestRevision) && checkAllTargetsAreReady(envStatus) {
+			// any promotion to this environment has now taken effect
+			envStatus.InFlightPromotion = nil
 			continue
 		}
 
-		if checkAnyTargetHasRevision(pipeline.Status.Environments[env.Name], latestRevision) {
-			return ctrl.Result{}, nil
+		// environments are only promoted to once all their dependencies run the revision and are ready
+		dependencies := pipeline.Spec.GetDependencies(env.Name)
+		if !checkAllEnvironmentsReached(&pipeline, dependencies, latestRevision) {
+			continue
 		}
 
-		err := r.promoteLatestRevision(ctx, pipeline, env, latestRevision)
+		// the status is still collected above for a suspended environment, but nothing is promoted to it.
+		if pipeline.Spec.IsSuspended(env.Name) {
+			setEnvironmentPendingCondition(&pipeline, env.Name, v1alpha1.SuspendedReason, suspendedMessage(&pipeline, env.Name))
+			pendingEnvs[env.Name] = true
+			continue
+		}
+
+		if envStatus.RolledBackRevision == latestRevision {
+			setEnvironmentPendingCondition(&pipeline, env.Name, v1alpha1.RolledBackReason, fmt.Sprintf("Revision %s was rolled back in environment %s, and will not be promoted to it again", latestRevision, env.Name))
+			pendingEnvs[env.Name] = true
+			continue
+		}
+
+		// the promotion is under way
+		if checkAnyTargetHasRevision(envStatus, latestRevision) {
+			continue
+		}
+
+		// a manual promotion has to be approved first; approvals are recorded in the status, e.g. by the approval webhook.
+		if promotion := pipeline.Spec.GetPromotion(env.Name); promotion != nil && promotion.Manual && envStatus.ApprovedRevision != latestRevision {
+			if pipeline.Status.GetWaitingApproval(env.Name).Revision != latestRevision {
+				pipeline.Status.SetWaitingApproval(env.Name, latestRevision)
+				r.emitEventf(
+					&pipeline,
+					corev1.EventTypeNormal,
+					"WaitingApproval", "Promotion of revision %s to environment %s is waiting for approval",
+					latestRevision, env.Name,
+				)
+			}
+			setEnvironmentPendingCondition(&pipeline, env.Name, v1alpha1.WaitingApprovalReason, fmt.Sprintf("Waiting for approval to promote revision %s to environment %s", latestRevision, env.Name))
+			pendingEnvs[env.Name] = true
+			continue
+		}
+
+		// the strategy has already been run for this revision; give it a chance to take effect before running it again.
+		if inFlight := envStatus.InFlightPromotion; inFlight != nil && inFlight.Revision == latestRevision {
+			if wait := time.Until(inFlight.StartedAt.Add(r.promotionRetryBackoff)); wait > 0 {
+				if requeueAfter == 0 || wait < requeueAfter {
+					requeueAfter = wait
+				}
+				continue
+			}
+		}
+
+		// a failed promotion is only retried once the backoff has passed. Recording the failure updates the pipeline, which
+		// would otherwise have it retried straight away.
+		if wait := r.failedPromotionBackoff(envStatus, latestRevision, false); wait > 0 {
+			if requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+			continue
+		}
+
+		// the revision has to have been ready in each dependency for long enough before moving on.
+		var remaining time.Duration
+		var soakingEnv string
+		for _, dep := range dependencies {
+			if r := remainingSoakTime(pipeline.Status.Environments[dep], pipeline.Spec.GetMinSoakDuration(dep, env.Name), time.Now()); r > remaining {
+				remaining, soakingEnv = r, dep
+			}
+		}
+		if remaining > 0 {
+			setEnvironmentPendingCondition(&pipeline, env.Name, v1alpha1.SoakingReason, fmt.Sprintf("Waiting for revision %s to soak in environment %s for another %s", latestRevision, soakingEnv, remaining.Round(time.Second)))
+			pendingEnvs[env.Name] = true
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+
+		// nothing is promoted during a freeze; this picks up again once the freeze ends.
+		frozen, until, err := freeze.Check(pipeline.Spec.GetFreezeWindows(env.Name), time.Now())
 		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("error promoting new version: %w", err)
+			promotionErrs = append(promotionErrs, fmt.Errorf("error checking freeze windows of environment %s: %w", env.Name, err))
+			continue
+		}
+		if frozen {
+			setEnvironmentPendingCondition(&pipeline, env.Name, v1alpha1.FrozenReason, fmt.Sprintf("Promotion of revision %s to environment %s is frozen until %s", latestRevision, env.Name, until.UTC().Format(time.RFC3339)))
+			pendingEnvs[env.Name] = true
+			if wait := time.Until(until); requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+			continue
 		}
 
-		break
+		// a failed promotion is recorded in the history and retried after the backoff, rather than by returning the error,
+		// which would retry it at the pace of the controller's rate limiter.
+		if err := r.promoteLatestRevision(ctx, &pipeline, dependencies, env, latestRevision); err != nil {
+			logger.Error(err, "error promoting new version", "environment", env.Name, "revision", latestRevision)
+			r.emitEventf(
+				&pipeline,
+				corev1.EventTypeWarning,
+				"PromotionFailed", "Failed to promote revision %s to environment %s: %s",
+				latestRevision, env.Name,
+				err,
+			)
+			if requeueAfter == 0 || r.promotionRetryBackoff < requeueAfter {
+				requeueAfter = r.promotionRetryBackoff
+			}
+		}
 	}
 
-	return ctrl.Result{}, nil
+	removeEnvironmentPendingConditions(&pipeline, pendingEnvs)
+
+	if !anyEnvironmentRolledBack(&pipeline) {
+		apimeta.RemoveStatusCondition(&pipeline.Status.Conditions, conditions.RolledBackCondition)
+	}
+
+	// this records any promotion attempts and the pending condition, if set
+	if err := patcher.Patch(ctx, &pipeline, withFieldOwner); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error recording promotion: %w", err)
+	}
+	if len(promotionErrs) > 0 {
+		return ctrl.Result{}, kerrors.NewAggregate(promotionErrs)
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// checkAllEnvironmentsReached returns true if all targets in all the environments named run the revision given and are ready.
+func checkAllEnvironmentsReached(pipeline *v1alpha1.Pipeline, envs []string, revision string) bool {
+	for _, name := range envs {
+		env := pipeline.Status.Environments[name]
+		if env == nil || !checkAllTargetsRunRevision(env, revision) || !checkAllTargetsAreReady(env) {
+			return false
+		}
+	}
+
+	return true
 }
 
 func setPendingCondition(pipeline *v1alpha1.Pipeline, reason, message string) {
@@ -273,30 +568,289 @@ func removePendingCondition(pipeline *v1alpha1.Pipeline) {
 	apimeta.RemoveStatusCondition(&pipeline.Status.Conditions, conditions.PromotionPendingCondition)
 }
 
-func (r *PipelineReconciler) promoteLatestRevision(ctx context.Context, pipeline v1alpha1.Pipeline, env v1alpha1.Environment, revision string) error {
-	// none of the current strategies are idepontent, using it now to keep the ball rolling, but we need to implement
-	// strategies that are.
+// promoteLatestRevision runs the promotion strategy for the environment given, and records the attempt in the
+// environment's promotion history. It is up to the caller to persist the pipeline status.
+func (r *PipelineReconciler) promoteLatestRevision(ctx context.Context, pipeline *v1alpha1.Pipeline, sourceEnvs []string, env v1alpha1.Environment, revision string) error {
+	// none of the current strategies are idempotent, so the caller must avoid running this again while a promotion is in
+	// flight (see `.status.environments[].inFlightPromotion`).
 
 	promotion := pipeline.Spec.GetPromotion(env.Name)
 	if promotion == nil {
 		return nil
 	}
 
-	strat, err := r.stratReg.Get(*promotion)
+	record, err := r.runPromotion(ctx, pipeline, *promotion, env, v1alpha1.PromotionRecord{
+		SourceEnvironment: strings.Join(sourceEnvs, ","),
+		TargetEnvironment: env.Name,
+		Revision:          revision,
+		Strategy:          promotion.Strategy.Type(),
+	})
+
+	// A failed promotion is retried by the caller after a backoff; a successful one is remembered, so the strategy isn't run
+	// again on every reconciliation until the environment catches up.
+	if err == nil {
+		pipeline.Status.Environments[env.Name].InFlightPromotion = &v1alpha1.InFlightPromotion{
+			Revision:  revision,
+			StartedAt: record.StartedAt,
+			Location:  record.Location,
+		}
+	}
+
+	return err
+}
+
+// rollBackUnhealthyEnvironments promotes the last known-good revision to each environment with a rollback policy whose
+// targets have been unhealthy with another revision for longer than the policy's timeout. It returns how long until the
+// next rollback would be due, if any. It is up to the caller to persist the pipeline status.
+func (r *PipelineReconciler) rollBackUnhealthyEnvironments(ctx context.Context, pipeline *v1alpha1.Pipeline) (time.Duration, error) {
+	var (
+		requeueAfter time.Duration
+		errs         []error
+	)
+
+	for _, env := range pipeline.Spec.Environments[1:] {
+		promotion := pipeline.Spec.GetPromotion(env.Name)
+		if promotion == nil || promotion.Rollback == nil || pipeline.Spec.IsSuspended(env.Name) {
+			continue
+		}
+
+		envStatus := pipeline.Status.Environments[env.Name]
+		badRevision := unhealthyRevision(envStatus)
+		if badRevision == "" || badRevision == envStatus.RolledBackRevision {
+			continue
+		}
+
+		if wait := time.Until(envStatus.UnhealthySince.Add(promotion.Rollback.Timeout.Duration)); wait > 0 {
+			if requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+			continue
+		}
+
+		if wait := r.failedPromotionBackoff(envStatus, envStatus.KnownGoodRevision, true); wait > 0 {
+			if requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+			continue
+		}
+
+		// a rollback runs the promotion strategy, so it has to wait for any freeze to end like any other promotion.
+		frozen, until, err := freeze.Check(pipeline.Spec.GetFreezeWindows(env.Name), time.Now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error checking freeze windows of environment %s: %w", env.Name, err))
+			continue
+		}
+		if frozen {
+			if wait := time.Until(until); requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+			continue
+		}
+
+		// like a failed promotion, a failed rollback is retried after the backoff; rollBack records it and emits an event.
+		if err := r.rollBack(ctx, pipeline, env, *promotion, badRevision); err != nil {
+			log.FromContext(ctx).Error(err, "error rolling back environment", "environment", env.Name)
+			if requeueAfter == 0 || r.promotionRetryBackoff < requeueAfter {
+				requeueAfter = r.promotionRetryBackoff
+			}
+		}
+	}
+
+	return requeueAfter, kerrors.NewAggregate(errs)
+}
+
+// failedPromotionBackoff returns how long until the promotion of the revision given into the environment may be tried
+// again, if the latest attempt at it failed, and zero otherwise. `rollback` says whether the attempt is a rollback.
+func (r *PipelineReconciler) failedPromotionBackoff(envStatus *v1alpha1.EnvironmentStatus, revision string, rollback bool) time.Duration {
+	if envStatus == nil || len(envStatus.PromotionHistory) == 0 {
+		return 0
+	}
+	last := envStatus.PromotionHistory[0]
+	if last.Outcome != v1alpha1.PromotionFailed || last.Revision != revision || last.Rollback != rollback {
+		return 0
+	}
+
+	return time.Until(last.CompletedAt.Add(r.promotionRetryBackoff))
+}
+
+// rollBack runs the promotion strategy for the environment's last known-good revision, and records the attempt in the
+// environment's promotion history.
+func (r *PipelineReconciler) rollBack(ctx context.Context, pipeline *v1alpha1.Pipeline, env v1alpha1.Environment, promotion v1alpha1.Promotion, badRevision string) error {
+	envStatus := pipeline.Status.Environments[env.Name]
+	goodRevision := envStatus.KnownGoodRevision
+
+	_, err := r.runPromotion(ctx, pipeline, promotion, env, v1alpha1.PromotionRecord{
+		TargetEnvironment: env.Name,
+		Revision:          goodRevision,
+		Strategy:          promotion.Strategy.Type(),
+		Rollback:          true,
+	})
+	if err != nil {
+		r.emitEventf(
+			pipeline,
+			corev1.EventTypeWarning,
+			"RollbackFailed", "Failed to roll back environment %s from revision %s to %s: %s",
+			env.Name, badRevision, goodRevision,
+			err,
+		)
+		return err
+	}
+
+	// the promotion of the bad revision has been superseded, and the bad revision mustn't be promoted again.
+	envStatus.InFlightPromotion = nil
+	envStatus.RolledBackRevision = badRevision
+
+	message := fmt.Sprintf("Environment %s was rolled back from revision %s to %s", env.Name, badRevision, goodRevision)
+	apimeta.SetStatusCondition(&pipeline.Status.Conditions, metav1.Condition{
+		Type:    conditions.RolledBackCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1alpha1.RolledBackReason,
+		Message: trimString(message, v1alpha1.MaxConditionMessageLength),
+	})
+	r.emitEventf(pipeline, corev1.EventTypeWarning, "RolledBack", "%s", message)
+
+	return nil
+}
+
+// runPromotion runs the promotion strategy for the revision of the record given, then completes the record with the
+// outcome and adds it to the environment's promotion history.
+func (r *PipelineReconciler) runPromotion(ctx context.Context, pipeline *v1alpha1.Pipeline, promotion v1alpha1.Promotion, env v1alpha1.Environment, record v1alpha1.PromotionRecord) (v1alpha1.PromotionRecord, error) {
+	record.StartedAt = metav1.Now()
+
+	location, err := r.promote(ctx, pipeline, promotion, env, record.Revision)
+
+	record.CompletedAt = metav1.Now()
+	record.Location = location
 	if err != nil {
-		return fmt.Errorf("error getting strategy from registry: %w", err)
+		record.Outcome = v1alpha1.PromotionFailed
+		record.Error = trimString(err.Error(), v1alpha1.MaxConditionMessageLength)
+	} else {
+		record.Outcome = v1alpha1.PromotionSucceeded
+	}
+	pipeline.Status.AddPromotionRecord(record)
+	metrics.RecordPromotion(record)
+
+	return record, err
+}
+
+// promote runs the strategy for the promotion given, which is the promotion for the environment `env`.
+func (r *PipelineReconciler) promote(ctx context.Context, pipeline *v1alpha1.Pipeline, promotion v1alpha1.Promotion, env v1alpha1.Environment, revision string) (string, error) {
+	strat, err := r.stratReg.Get(promotion)
+	if err != nil {
+		return "", fmt.Errorf("error getting strategy from registry: %w", err)
 	}
 
 	prom := strategy.Promotion{
-		PipelineName:      pipeline.Name,
-		PipelineNamespace: pipeline.Namespace,
-		Environment:       env,
-		Version:           revision,
+		PipelineName:       pipeline.Name,
+		PipelineNamespace:  pipeline.Namespace,
+		Environment:        env,
+		Version:            revision,
+		ServiceAccountName: pipeline.Spec.ServiceAccountName,
+	}
+
+	ctx, span := tracing.Start(ctx, "strategy.Promote", tracing.PromotionAttributes(pipeline.Namespace, pipeline.Name, env.Name, revision)...)
+	res, err := strat.Promote(ctx, promotion, prom)
+	if tracing.End(span, err) != nil || res == nil {
+		return "", err
 	}
 
-	_, err = strat.Promote(ctx, *pipeline.Spec.Promotion, prom)
+	return res.Location, nil
+}
 
-	return err
+// setReadySince records in the target status when the target became ready with its current revision. This is carried over
+// from the target's previous status, if that was for the same app, revision and was also ready; otherwise, it is now.
+func setReadySince(status *v1alpha1.TargetStatus, previousTargets []v1alpha1.TargetStatus, i int) {
+	if !status.Ready {
+		status.ReadySince = nil
+		return
+	}
+
+	if i < len(previousTargets) {
+		previous := previousTargets[i]
+		if previous.Ready && previous.ReadySince != nil &&
+			previous.Revision == status.Revision &&
+			previous.ClusterAppRef.LocalAppReference == status.ClusterAppRef.LocalAppReference &&
+			clusterPrefix(previous.ClusterAppRef.ClusterRef) == clusterPrefix(status.ClusterAppRef.ClusterRef) {
+			status.ReadySince = previous.ReadySince
+			return
+		}
+	}
+
+	now := metav1.Now()
+	status.ReadySince = &now
+}
+
+// setKnownGoodRevision records the environment's revision as known-good if all its targets run it and are ready, and
+// otherwise records when the environment became unhealthy.
+func setKnownGoodRevision(env *v1alpha1.EnvironmentStatus, now metav1.Time) {
+	if checkAllTargetsAreReady(env) {
+		if revision := checkAllTargetsHaveSameRevision(env); revision != "" {
+			env.KnownGoodRevision = revision
+		}
+		env.UnhealthySince = nil
+		return
+	}
+
+	if env.UnhealthySince == nil {
+		env.UnhealthySince = &now
+	}
+}
+
+// unhealthyRevision returns the revision an unhealthy environment has received since it last ran its known-good revision,
+// or an empty string if the environment is healthy or has nothing to roll back to.
+func unhealthyRevision(env *v1alpha1.EnvironmentStatus) string {
+	if env.UnhealthySince == nil || env.KnownGoodRevision == "" {
+		return ""
+	}
+
+	for _, target := range env.Targets {
+		if target.Revision != "" && target.Revision != env.KnownGoodRevision {
+			return target.Revision
+		}
+	}
+
+	return ""
+}
+
+// suspendedMessage explains why promotions to the environment given are suspended.
+func suspendedMessage(pipeline *v1alpha1.Pipeline, env string) string {
+	if pipeline.Spec.Suspend {
+		return "Promotions of the pipeline are suspended"
+	}
+
+	return fmt.Sprintf("Promotions to environment %s are suspended", env)
+}
+
+// anyEnvironmentRolledBack returns true if any environment of the pipeline is holding back a revision it was rolled back from.
+func anyEnvironmentRolledBack(pipeline *v1alpha1.Pipeline) bool {
+	for _, env := range pipeline.Status.Environments {
+		if env != nil && env.RolledBackRevision != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remainingSoakTime returns how much longer the environment must stay ready before the soak duration given has passed for
+// all its targets, or zero if it has already passed.
+func remainingSoakTime(env *v1alpha1.EnvironmentStatus, soak time.Duration, now time.Time) time.Duration {
+	if soak <= 0 {
+		return 0
+	}
+
+	var remaining time.Duration
+	for _, target := range env.Targets {
+		if target.ReadySince == nil {
+			// shouldn't happen for ready targets, but err on the side of caution
+			return soak
+		}
+		if r := target.ReadySince.Add(soak).Sub(now); r > remaining {
+			remaining = r
+		}
+	}
+
+	return remaining
 }
 
 func checkAnyTargetHasRevision(env *v1alpha1.EnvironmentStatus, revision string) bool {
@@ -360,60 +914,60 @@ func clusterPrefix(ref *v1alpha1.CrossNamespaceClusterReference) string {
 // must be handled by setTargetStatus.
 func targetObject(pipeline *v1alpha1.Pipeline, target *v1alpha1.Target) (client.Object, error) {
 	var obj unstructured.Unstructured
-	gv, err := schema.ParseGroupVersion(pipeline.Spec.AppRef.APIVersion)
+	appRef := target.ResolveAppRef(pipeline.Spec.AppRef)
+	gv, err := schema.ParseGroupVersion(appRef.APIVersion)
 	if err != nil {
 		return nil, err
 	}
-	gvk := gv.WithKind(pipeline.Spec.AppRef.Kind)
+	gvk := gv.WithKind(appRef.Kind)
 	obj.GetObjectKind().SetGroupVersionKind(gvk)
-	obj.SetName(pipeline.Spec.AppRef.Name)
+	obj.SetName(appRef.Name)
 	obj.SetNamespace(target.Namespace)
 	return &obj, nil
 }
 
-// setTargetStatus gets the relevant status from the app object given, and records it in the TargetStatus.
-func setTargetStatus(status *v1alpha1.TargetStatus, targetObject client.Object) {
-	switch obj := targetObject.(type) {
-	case *unstructured.Unstructured:
-		// this assumes it's a Flux-like object; specifically with
-		//   - a Ready condition
-		//   - a .status.lastAppliedRevision
-		conds, ok, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
-		if !ok || err != nil {
-			status.Ready = false
-			return
-		}
-		status.Ready = conditions.IsReadyUnstructured(conds)
-
-		lastAppliedRev, ok, err := unstructured.NestedString(obj.Object, "status", "lastAppliedRevision")
-		if !ok || err != nil {
-			// It's not an error to lack a Ready condition (new objects will lack any conditions), and it's not an error to lack a lastAppliedRevision
-			// (maybe it hasn't got that far yet); but it is an error to have a ready condition of true and lack a lastAppliedRevision, since that means
-			// the object is not a usable target.
-			if status.Ready {
-				status.Error = "unable to find .status.lastAppliedRevision in ready target object"
-				status.Ready = false
-				return
-			}
-		} else {
-			status.Revision = lastAppliedRev
-		}
-	default:
+// setTargetStatus gets the relevant status from the app object given, and records it in the TargetStatus. How the status
+// is read depends on the kind of object, and can be configured with rules in the pipeline or given to the controller.
+func (r *PipelineReconciler) setTargetStatus(pipeline *v1alpha1.Pipeline, status *v1alpha1.TargetStatus, targetObject client.Object) {
+	obj, ok := targetObject.(*unstructured.Unstructured)
+	if !ok {
 		status.Error = "unable to determine ready status for object"
 		status.Ready = false
+		return
+	}
+
+	statusFunc, err := r.targetStatus.For(pipeline.Spec.TargetStatusRules, obj.GroupVersionKind())
+	if err != nil {
+		status.Error = err.Error()
+		status.Ready = false
+		return
+	}
+
+	objStatus, err := statusFunc(obj)
+	if err != nil {
+		status.Error = err.Error()
+		status.Ready = false
+		return
 	}
+	status.Ready = objStatus.Ready
+	status.Revision = objStatus.Revision
 }
 
-func (r *PipelineReconciler) getCluster(ctx context.Context, p v1alpha1.Pipeline, clusterRef v1alpha1.CrossNamespaceClusterReference) (*clusterctrlv1alpha1.GitopsCluster, error) {
-	cluster := &clusterctrlv1alpha1.GitopsCluster{}
+func (r *PipelineReconciler) getCluster(ctx context.Context, reader client.Reader, p v1alpha1.Pipeline, clusterRef v1alpha1.CrossNamespaceClusterReference) (*remoteCluster, error) {
 	namespace := clusterRef.Namespace
 	if clusterRef.Namespace == "" {
 		namespace = p.Namespace
 	}
-	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: clusterRef.Name}, cluster); err != nil {
-		return nil, err
+	return r.caches.getCluster(ctx, reader, clusterRef.Kind, client.ObjectKey{Namespace: namespace, Name: clusterRef.Name})
+}
+
+// pipelineReader returns a reader for the objects a pipeline refers to, which reads from the reader given what the
+// pipeline's service account is allowed to, if the reconciler has an impersonator, and everything otherwise.
+func (r *PipelineReconciler) pipelineReader(pipeline *v1alpha1.Pipeline, reader client.Reader) (client.Reader, error) {
+	if r.impersonator == nil {
+		return reader, nil
 	}
-	return cluster, nil
+	return r.impersonator.Reader(reader, pipeline.Namespace, pipeline.Spec.ServiceAccountName)
 }
 
 // == Setup of indices and static watchers ==
@@ -426,28 +980,83 @@ func (r *PipelineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return nil
 	}
 
-	const (
-		gitopsClusterIndexKey string = ".spec.environment.ClusterRef" // this is arbitrary, but let's make it suggest what it's indexing.
-	)
-	// Index the Pipelines by the GitopsCluster references they (may) point at.
-	if err := mgr.GetCache().IndexField(context.TODO(), &v1alpha1.Pipeline{}, gitopsClusterIndexKey, r.indexClusterKind("GitopsCluster")); err != nil {
-		return fmt.Errorf("failed setting index fields: %w", err)
+	kinds := make([]string, 0, len(r.caches.clusterResolvers))
+	for kind := range r.caches.clusterResolvers {
+		kinds = append(kinds, kind)
 	}
+	sort.Strings(kinds)
 
 	if r.recorder == nil {
 		r.recorder = mgr.GetEventRecorderFor(r.ControllerName)
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.Pipeline{}).
+	bldr := ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Pipeline{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.caches.shard.Contains)))
+
+	// Clusters of each kind are watched only if their API is installed, so that e.g. pipelines can be used without
+	// Weave GitOps' cluster-controller or Cluster API. A kind whose API is installed later is watched after a restart.
+	var watchedKinds []string
+	for _, kind := range kinds {
+		resolver := r.caches.clusterResolvers[kind]
+		gvk, err := apiutil.GVKForObject(resolver.NewObject(), mgr.GetScheme())
+		if err != nil {
+			return fmt.Errorf("cluster kind %s: %w", kind, err)
+		}
+		if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				mgr.GetLogger().Info("API for cluster kind is not installed, not watching clusters of this kind", "kind", kind, "gvk", gvk)
+				continue
+			}
+			return fmt.Errorf("cluster kind %s: %w", kind, err)
+		}
+
+		// Index the Pipelines by the cluster references of this kind they (may) point at.
+		if err := mgr.GetCache().IndexField(context.TODO(), &v1alpha1.Pipeline{}, clusterIndexKey(kind), inShard(r.caches.shard, r.indexClusterKind(kind))); err != nil {
+			return fmt.Errorf("failed setting index fields: %w", err)
+		}
+
+		// Index the clusters by the Secret their kubeconfig comes from, so that a change of credentials can be traced
+		// back to the pipelines using the cluster.
+		if err := mgr.GetCache().IndexField(context.TODO(), resolver.NewObject(), kubeconfigSecretIndexKey, indexKubeconfigSecret(resolver)); err != nil {
+			return fmt.Errorf("failed setting index fields: %w", err)
+		}
+
+		bldr = bldr.Watches(
+			resolver.NewObject(),
+			handler.EnqueueRequestsFromMapFunc(r.requestsForCluster(clusterIndexKey(kind))),
+		)
+		watchedKinds = append(watchedKinds, kind)
+	}
+
+	return bldr.
 		Watches(
-			&clusterctrlv1alpha1.GitopsCluster{},
-			handler.EnqueueRequestsFromMapFunc(r.requestsForCluster(gitopsClusterIndexKey)),
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForKubeconfigSecret(watchedKinds)),
+			builder.WithPredicates(secretDataChangedPredicate{}),
 		).
 		WatchesRawSource(&source.Channel{Source: r.appEvents}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
 
+// secretDataChangedPredicate lets through updates to Secrets only when their data, or the namespaces allowed to refer to
+// them, changed, since other updates can't affect the credentials for a cluster.
+type secretDataChangedPredicate struct {
+	predicate.Funcs
+}
+
+func (secretDataChangedPredicate) Update(e event.UpdateEvent) bool {
+	oldSecret, ok := e.ObjectOld.(*corev1.Secret)
+	if !ok {
+		return true
+	}
+	newSecret, ok := e.ObjectNew.(*corev1.Secret)
+	if !ok {
+		return true
+	}
+	return !equality.Semantic.DeepEqual(oldSecret.Data, newSecret.Data) ||
+		oldSecret.GetAnnotations()[v1alpha1.AllowedNamespacesAnnotation] != newSecret.GetAnnotations()[v1alpha1.AllowedNamespacesAnnotation]
+}
+
 func (r *PipelineReconciler) emitEventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
 	if r.recorder == nil {
 		return
@@ -130,4 +130,171 @@ func TestRemoteTargets(t *testing.T) {
 
 		// TODO possibly: check the events too, as it used to.
 	})
+
+	t.Run("replaces the cache for the cluster when its credentials change", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		ctx := context.TODO()
+
+		name := "pipeline-" + rand.String(5)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+		targetNs := corev1.Namespace{}
+		targetNs.Name = ns.Name
+		g.Expect(leafClient.Create(ctx, &targetNs)).To(Succeed())
+		hr := createApp(ctx, leafClient, g, name, targetNs.Name)
+
+		pipeline := newPipeline(name, ns.Name, []*clusterctrlv1alpha1.GitopsCluster{leafCluster})
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+		checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+		// the hashes of the kubeconfigs used by the caches for the leaf cluster.
+		configHashes := func() []string {
+			c := pipelineReconciler.caches
+			c.cachesMu.Lock()
+			defer c.cachesMu.Unlock()
+			var hashes []string
+			for key, entry := range c.cachesMap {
+				if key.ObjectKey == client.ObjectKeyFromObject(leafCluster) {
+					hashes = append(hashes, entry.configHash)
+				}
+			}
+			return hashes
+		}
+		previousHashes := configHashes()
+		g.Expect(previousHashes).NotTo(BeEmpty())
+
+		// rotate the credentials, by switching to another user.
+		rotatedUser, err := leafEnv.ControlPlane.AddUser(envtest.User{
+			Name:   "leaf-admin-rotated",
+			Groups: []string{"system:masters"},
+		}, nil)
+		g.Expect(err).NotTo(HaveOccurred())
+		rotatedKubeConfig, err := rotatedUser.KubeConfig()
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		secret.Data = map[string][]byte{"kubeconfig": rotatedKubeConfig}
+		g.Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+		g.Eventually(configHashes, defaultTimeout, defaultInterval).ShouldNot(ContainElements(previousHashes))
+
+		// the replacement cache is watching the app, so changes to it are still seen.
+		const appRevision = "v1.0.2"
+		hr.Status.LastAppliedRevision = appRevision
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "test"})
+		g.Expect(leafClient.Status().Update(ctx, hr)).To(Succeed())
+
+		g.Eventually(func() string {
+			p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+			return getTargetStatus(g, p, "test", 0).Revision
+		}, defaultTimeout, defaultInterval).Should(Equal(appRevision))
+	})
+
+	t.Run("targets a remote cluster through its kubeconfig Secret", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		ctx := context.TODO()
+
+		name := "pipeline-" + rand.String(5)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+		targetNs := corev1.Namespace{}
+		targetNs.Name = ns.Name
+		g.Expect(leafClient.Create(ctx, &targetNs)).To(Succeed())
+		hr := createApp(ctx, leafClient, g, name, targetNs.Name)
+		const appRevision = "v1.0.3"
+		hr.Status.LastAppliedRevision = appRevision
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "test"})
+		g.Expect(leafClient.Status().Update(ctx, hr)).To(Succeed())
+
+		pipeline := newPipeline(name, ns.Name, nil)
+		pipeline.Spec.Environments[0].Targets[0].ClusterRef = &v1alpha1.CrossNamespaceClusterReference{
+			Kind:      v1alpha1.SecretClusterKind,
+			Name:      secret.Name,
+			Namespace: secret.Namespace,
+		}
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+
+		checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+		g.Eventually(func() string {
+			p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+			return getTargetStatus(g, p, "test", 0).Revision
+		}, defaultTimeout, defaultInterval).Should(Equal(appRevision))
+	})
+
+	t.Run("refuses a cluster that does not allow the pipeline's namespace", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		ctx := context.TODO()
+
+		name := "pipeline-" + rand.String(5)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+		restrictedCluster := &clusterctrlv1alpha1.GitopsCluster{
+			Spec: clusterctrlv1alpha1.GitopsClusterSpec{
+				SecretRef: &meta.LocalObjectReference{
+					Name: kubeconfigSecretName,
+				},
+			},
+		}
+		restrictedCluster.Name = "restricted-" + rand.String(5)
+		restrictedCluster.Namespace = "default"
+		restrictedCluster.Annotations = map[string]string{v1alpha1.AllowedNamespacesAnnotation: "some-other-namespace"}
+		g.Expect(k8sClient.Create(ctx, restrictedCluster)).To(Succeed())
+		apimeta.SetStatusCondition(&restrictedCluster.Status.Conditions, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "test"})
+		g.Expect(k8sClient.Status().Update(ctx, restrictedCluster)).To(Succeed())
+
+		pipeline := newPipeline(name, ns.Name, []*clusterctrlv1alpha1.GitopsCluster{restrictedCluster})
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+
+		checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionFalse, v1alpha1.TargetClusterNotAllowedReason)
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		g.Expect(getTargetStatus(g, p, "test", 0).Error).To(ContainSubstring("does not allow namespace"))
+	})
+}
+
+// Test that a target in a cluster that can't be reached is reported as such.
+func TestUnreachableRemoteTarget(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+	ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	// nothing listens on this port, so connecting to it is refused straight away.
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: unreachable
+  cluster:
+    server: https://127.0.0.1:1
+contexts:
+- name: unreachable
+  context:
+    cluster: unreachable
+    user: unreachable
+current-context: unreachable
+users:
+- name: unreachable
+  user:
+    token: token
+`
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "unreachable-kubeconfig", Namespace: ns.Name},
+		StringData: map[string]string{"kubeconfig": kubeconfig},
+	}
+	g.Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+	cluster := &clusterctrlv1alpha1.GitopsCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "unreachable", Namespace: ns.Name},
+		Spec: clusterctrlv1alpha1.GitopsClusterSpec{
+			SecretRef: &meta.LocalObjectReference{Name: secret.Name},
+		},
+	}
+	g.Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+	apimeta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "test"})
+	g.Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+	pipeline := newPipeline("pipeline-"+rand.String(5), ns.Name, []*clusterctrlv1alpha1.GitopsCluster{cluster})
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionFalse, v1alpha1.TargetClusterUnreachableReason)
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	g.Expect(getTargetStatus(g, p, "test", 0).Error).To(ContainSubstring("Target cluster unreachable"))
 }
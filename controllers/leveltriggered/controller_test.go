@@ -119,6 +119,70 @@ func TestReconcile(t *testing.T) {
 		g.Expect(targetStatus.Revision).To(Equal(appRevision))
 	})
 
+	t.Run("uses the target's appRef override", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		name := "pipeline-" + rand.String(5)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+		t.Cleanup(deleteObjectCleanup(ctx, g, ns))
+
+		appName := name + "-test"
+		pipeline := newPipeline(name, ns.Name, nil)
+		pipeline.Spec.Environments[0].Targets[0].AppRef = &v1alpha1.TargetAppReference{
+			Name: appName,
+		}
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+
+		checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionFalse, v1alpha1.TargetNotReadableReason)
+
+		// an app with the pipeline's appRef name is not the target
+		createApp(ctx, k8sClient, g, name, ns.Name)
+		hr := createApp(ctx, k8sClient, g, appName, ns.Name)
+		checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		g.Expect(getTargetStatus(g, p, "test", 0).ClusterAppRef.Name).To(Equal(appName))
+
+		// changes to the overridden app are picked up through the index
+		const appRevision = "v1.0.1"
+		hr.Status.LastAppliedRevision = appRevision
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "test"})
+		g.Expect(k8sClient.Status().Update(ctx, hr)).To(Succeed())
+
+		g.Eventually(func() string {
+			p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+			return getTargetStatus(g, p, "test", 0).Revision
+		}, "5s", "0.2s").Should(Equal(appRevision))
+	})
+
+	t.Run("uses the pipeline's target status rules", func(t *testing.T) {
+		g := testingutils.NewGomegaWithT(t)
+		name := "pipeline-" + rand.String(5)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+		t.Cleanup(deleteObjectCleanup(ctx, g, ns))
+
+		pipeline := newPipeline(name, ns.Name, nil)
+		pipeline.Spec.TargetStatusRules = []v1alpha1.TargetStatusRule{{
+			APIVersion: pipeline.Spec.AppRef.APIVersion,
+			Kind:       pipeline.Spec.AppRef.Kind,
+			Revision:   ".status.lastAttemptedRevision",
+		}}
+		g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+
+		hr := createApp(ctx, k8sClient, g, name, ns.Name)
+		checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+		const appRevision = "v1.0.2"
+		hr.Status.LastAppliedRevision = "v1.0.1"
+		hr.Status.LastAttemptedRevision = appRevision
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "test"})
+		g.Expect(k8sClient.Status().Update(ctx, hr)).To(Succeed())
+
+		g.Eventually(func() string {
+			p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+			return getTargetStatus(g, p, "test", 0).Revision
+		}, "5s", "0.2s").Should(Equal(appRevision))
+	})
+
 	t.Run("works with a Kustomization", func(t *testing.T) {
 		g := testingutils.NewGomegaWithT(t)
 		ctx := context.TODO()
@@ -0,0 +1,119 @@
+package leveltriggered
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+// CacheDebugInfo describes a target cache, as served by the handler returned from PipelineReconciler.DebugHandler.
+type CacheDebugInfo struct {
+	// Key is the cache's key, as used in the index of pipelines by cache.
+	Key string `json:"key"`
+	// Cluster is the namespace and name of the cluster the cache is for, or empty for the local cluster.
+	Cluster string `json:"cluster,omitempty"`
+	// TargetNamespace is the only namespace the cache watches, or empty if it watches the whole cluster.
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+	// GVK is the group, version and kind of the objects in the cache.
+	GVK string `json:"gvk"`
+	// Created is when the cache was created.
+	Created time.Time `json:"created"`
+	// Synced says whether the cache's informer has synced.
+	Synced bool `json:"synced"`
+	// Objects is the number of objects in the cache, or nil if that's not known.
+	Objects *int `json:"objects,omitempty"`
+	// Pipelines are the namespaces and names of the pipelines with targets that come from the cache.
+	Pipelines []string `json:"pipelines"`
+	// GCRequeues is how many times the garbage collector found the cache to be still in use.
+	GCRequeues int `json:"gcRequeues"`
+	// LastError is the last error seen watching or talking to the cluster, and LastErrorTime when that was.
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+	// LastSuccess is when a request to the cluster last succeeded.
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+}
+
+// DebugHandler returns an HTTP handler that responds with a JSON list of the target caches the reconciler currently
+// has, as CacheDebugInfo values. It does no authentication or authorization of its own.
+func (r *PipelineReconciler) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		infos, err := r.caches.debugInfo(req.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(infos); err != nil {
+			r.caches.baseLogger.Error(err, "failed writing debug response")
+		}
+	})
+}
+
+// debugInfo describes each of the caches, in order of their keys.
+func (c *caches) debugInfo(ctx context.Context) ([]CacheDebugInfo, error) {
+	c.cachesMu.Lock()
+	entries := make(map[clusterAndGVK]cacheAndCancel, len(c.cachesMap))
+	for k, v := range c.cachesMap {
+		entries[k] = v
+	}
+	c.cachesMu.Unlock()
+
+	infos := make([]CacheDebugInfo, 0, len(entries))
+	for key, entry := range entries {
+		info := CacheDebugInfo{
+			Key:             key.String(),
+			TargetNamespace: key.TargetNamespace,
+			GVK:             key.GroupVersionKind.String(),
+			Created:         entry.created,
+			Pipelines:       []string{},
+		}
+		if key.ObjectKey != (client.ObjectKey{}) {
+			info.Cluster = key.ObjectKey.String()
+		}
+		if entry.informer != nil {
+			info.Synced = entry.informer.HasSynced()
+			// The informers controller-runtime creates are SharedIndexInformers, which expose their store.
+			if inf, ok := entry.informer.(interface{ GetStore() toolscache.Store }); ok {
+				n := len(inf.GetStore().ListKeys())
+				info.Objects = &n
+			}
+		}
+		if c.cachesGC != nil {
+			info.GCRequeues = c.cachesGC.queue.NumRequeues(key)
+		}
+
+		cc := c.connectivity.get(key.ObjectKey)
+		if cc.lastError != nil {
+			info.LastError = cc.lastError.Error()
+			info.LastErrorTime = &cc.lastErrorTime
+		}
+		if !cc.lastSuccess.IsZero() {
+			info.LastSuccess = &cc.lastSuccess
+		}
+
+		var list v1alpha1.PipelineList
+		if err := c.reader.List(ctx, &list, client.MatchingFields{
+			cacheIndex: key.String(),
+		}); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			info.Pipelines = append(info.Pipelines, client.ObjectKeyFromObject(&list.Items[i]).String())
+		}
+		sort.Strings(info.Pipelines)
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+	return infos, nil
+}
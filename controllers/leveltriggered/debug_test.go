@@ -0,0 +1,79 @@
+package leveltriggered
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+func TestCachesDebugInfo(t *testing.T) {
+	g := NewWithT(t)
+
+	s := runtime.NewScheme()
+	g.Expect(v1alpha1.AddToScheme(s)).To(Succeed())
+
+	gvk := schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Version: "v2beta1", Kind: "HelmRelease"}
+	cluster := client.ObjectKey{Namespace: "pipelines", Name: "prod"}
+	localKey := clusterAndGVK{GroupVersionKind: gvk}
+	remoteKey := clusterAndGVK{ObjectKey: cluster, GroupVersionKind: gvk}
+
+	pipeline := &v1alpha1.Pipeline{}
+	pipeline.Name, pipeline.Namespace = "app", "pipelines"
+	pipeline.Spec.AppRef = v1alpha1.LocalAppReference{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Name: "app"}
+	pipeline.Spec.Environments = []v1alpha1.Environment{{
+		Name: "prod",
+		Targets: []v1alpha1.Target{{
+			Namespace:  "default",
+			ClusterRef: &v1alpha1.CrossNamespaceClusterReference{Kind: "GitopsCluster", Name: "prod"},
+		}},
+	}}
+
+	// An informer that's never started: it hasn't synced, but objects can be put in its store directly.
+	informer := toolscache.NewSharedIndexInformer(&toolscache.ListWatch{}, &unstructured.Unstructured{}, 0, toolscache.Indexers{})
+	obj := &unstructured.Unstructured{}
+	obj.SetNamespace("default")
+	obj.SetName("app")
+	g.Expect(informer.GetStore().Add(obj)).To(Succeed())
+
+	created := time.Now()
+	c := newCaches(nil, s)
+	c.reader = fake.NewClientBuilder().WithScheme(s).WithObjects(pipeline).
+		WithIndex(&v1alpha1.Pipeline{}, cacheIndex, indexTargetCache).Build()
+	c.cachesMap[localKey] = cacheAndCancel{created: created}
+	c.cachesMap[remoteKey] = cacheAndCancel{informer: informer, created: created}
+	c.connectivity.recordError(cluster, errors.New("connection refused"))
+
+	infos, err := c.debugInfo(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(infos).To(HaveLen(2))
+
+	local := infos[0]
+	g.Expect(local.Key).To(Equal(localKey.String()))
+	g.Expect(local.Cluster).To(BeEmpty())
+	g.Expect(local.Objects).To(BeNil())
+	g.Expect(local.Pipelines).To(BeEmpty())
+	g.Expect(local.LastError).To(BeEmpty())
+
+	remote := infos[1]
+	g.Expect(remote.Key).To(Equal(remoteKey.String()))
+	g.Expect(remote.Cluster).To(Equal("pipelines/prod"))
+	g.Expect(remote.GVK).To(Equal(gvk.String()))
+	g.Expect(remote.Synced).To(BeFalse())
+	g.Expect(remote.Objects).NotTo(BeNil())
+	g.Expect(*remote.Objects).To(Equal(1))
+	g.Expect(remote.Pipelines).To(ConsistOf("pipelines/app"))
+	g.Expect(remote.LastError).To(Equal("connection refused"))
+	g.Expect(remote.LastErrorTime).NotTo(BeNil())
+	g.Expect(remote.LastSuccess).To(BeNil())
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/sharding"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -63,8 +65,72 @@ func (r *PipelineReconciler) requestsForCluster(indexKey string) func(context.Co
 	}
 }
 
+// clusterIndexKey names the index of Pipelines by the clusters of the kind given that they (may) point at. This is
+// arbitrary, but let's make it suggest what it's indexing.
+func clusterIndexKey(kind string) string {
+	return ".spec.environment.ClusterRef." + kind
+}
+
+// kubeconfigSecretIndexKey names the index of cluster objects by the Secret their kubeconfig is read from.
+const kubeconfigSecretIndexKey = ".spec.secretRef.name"
+
+// indexKubeconfigSecret returns a func that will extract the name of the Secret holding the kubeconfig for a cluster
+// object of the kind handled by the resolver given. For GitopsClusters, that's either a Secret referenced directly, or
+// the kubeconfig Secret of the Cluster API cluster it refers to.
+func indexKubeconfigSecret(resolver ClusterResolver) func(o client.Object) []string {
+	return func(o client.Object) []string {
+		if name := resolver.KubeconfigSecretName(o); name != "" {
+			return []string{name}
+		}
+		return nil
+	}
+}
+
+// requestsForKubeconfigSecret returns a func that will look up the pipelines using a cluster whose kubeconfig is in a
+// Secret, via the cluster objects of each kind indexed by `indexKubeconfigSecret` and then the pipelines indexed by
+// `clusterIndexKey(kind)`. Reconciling these pipelines replaces the caches built with the old credentials.
+func (r *PipelineReconciler) requestsForKubeconfigSecret(kinds []string) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var reqs []reconcile.Request
+		for _, kind := range kinds {
+			list := r.caches.clusterResolvers[kind].NewObjectList()
+			if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{
+				kubeconfigSecretIndexKey: obj.GetName(),
+			}); err != nil {
+				continue
+			}
+			items, err := apimeta.ExtractList(list)
+			if err != nil {
+				continue
+			}
+			requestsForCluster := r.requestsForCluster(clusterIndexKey(kind))
+			for _, item := range items {
+				if cluster, ok := item.(client.Object); ok {
+					reqs = append(reqs, requestsForCluster(ctx, cluster)...)
+				}
+			}
+		}
+		return reqs
+	}
+}
+
 const applicationKey = ".spec.environments[].targets[].appRef"
 
+// inShard wraps an IndexerFunc for Pipelines so that only the Pipelines in the shard given are indexed. Since events
+// for targets and clusters are traced back to Pipelines through these indices, and caches are only kept while an
+// index says they are used, this keeps the work done and the caches held to those needed for the shard.
+func inShard(shard sharding.Shard, fn client.IndexerFunc) client.IndexerFunc {
+	if !shard.IsSharded() {
+		return fn
+	}
+	return func(o client.Object) []string {
+		if !shard.Contains(o) {
+			return nil
+		}
+		return fn(o)
+	}
+}
+
 // targetKeyFunc is a type representing a way to get an index key from a target spec.
 type targetKeyFunc func(cluster client.ObjectKey, typ schema.GroupVersionKind, target client.ObjectKey) string
 
@@ -77,20 +143,18 @@ func indexTargets(fn targetKeyFunc) func(client.Object) []string {
 			panic(fmt.Sprintf("Expected a Pipeline, got %T", o))
 		}
 
-		// TODO future: account for the name being provided in the target ref.
-		name := p.Spec.AppRef.Name
-		kind := p.Spec.AppRef.Kind
-		apiVersion := p.Spec.AppRef.APIVersion
-		gv, err := schema.ParseGroupVersion(apiVersion)
-		if err != nil {
-			// FIXME: ideally we'd log this problem here; but, the log is not available.
-			return nil
-		}
-		gvk := gv.WithKind(kind)
-
 		var res []string
 		for _, env := range p.Spec.Environments {
 			for _, target := range env.Targets {
+				// each target can override the pipeline's appRef, so the GVK and name are worked out per target.
+				appRef := target.ResolveAppRef(p.Spec.AppRef)
+				gv, err := schema.ParseGroupVersion(appRef.APIVersion)
+				if err != nil {
+					// FIXME: ideally we'd log this problem here; but, the log is not available.
+					continue
+				}
+				gvk := gv.WithKind(appRef.Kind)
+
 				var clusterKey client.ObjectKey
 				if target.ClusterRef != nil {
 					clusterKey.Name = target.ClusterRef.Name
@@ -98,11 +162,12 @@ func indexTargets(fn targetKeyFunc) func(client.Object) []string {
 					if clusterKey.Namespace == "" {
 						clusterKey.Namespace = p.GetNamespace()
 					}
+					clusterKey = qualifiedClusterKey(target.ClusterRef.Kind, clusterKey)
 				}
 
 				var targetKey client.ObjectKey
 				targetKey.Namespace = target.Namespace
-				targetKey.Name = name
+				targetKey.Name = appRef.Name
 				if targetKey.Namespace == "" {
 					targetKey.Namespace = p.GetNamespace()
 				}
@@ -0,0 +1,90 @@
+package leveltriggered
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/weaveworks/pipeline-controller/internal/clusteraccess"
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
+	"github.com/weaveworks/pipeline-controller/internal/sharding"
+	"github.com/weaveworks/pipeline-controller/pkg/targetstatus"
+)
+
+// Opt is an option for the PipelineReconciler, passed to NewPipelineReconciler.
+type Opt func(r *PipelineReconciler)
+
+// WithPromotionRetryBackoff sets how long to wait for an in-flight promotion to take effect before running the
+// promotion strategy again for the same revision, and how long to wait before retrying a promotion that failed.
+func WithPromotionRetryBackoff(d time.Duration) Opt {
+	return func(r *PipelineReconciler) {
+		r.promotionRetryBackoff = d
+	}
+}
+
+// WithTargetStatusResolver sets how the readiness and revision of target objects are determined. Without this, only
+// the built-in rules and those given in each pipeline are used.
+func WithTargetStatusResolver(resolver *targetstatus.Resolver) Opt {
+	return func(r *PipelineReconciler) {
+		r.targetStatus = resolver
+	}
+}
+
+// WithNamespacedTargetCaches makes the reconciler watch targets with a cache per cluster, namespace and type, rather
+// than per cluster and type, so that the kubeconfig for a cluster only needs to allow listing and watching in the
+// namespaces of its targets. GitopsClusters can override this with the pipelines.weave.works/namespaced-cache annotation.
+func WithNamespacedTargetCaches(namespaced bool) Opt {
+	return func(r *PipelineReconciler) {
+		r.caches.namespacedByDefault = namespaced
+	}
+}
+
+// WithCacheSyncTimeout sets how long a cache watching targets is given to sync, before it's torn down and recreated.
+func WithCacheSyncTimeout(d time.Duration) Opt {
+	return func(r *PipelineReconciler) {
+		r.caches.syncTimeout = d
+	}
+}
+
+// WithTargetCacheTransform sets a func applied to each target object before it's stored in a cache, e.g. to drop the
+// parts of it that aren't needed to determine its status.
+func WithTargetCacheTransform(transform toolscache.TransformFunc) Opt {
+	return func(r *PipelineReconciler) {
+		r.caches.transform = transform
+	}
+}
+
+// WithTargetCacheSelectors restricts the target objects that are cached to those matching the selectors given. Either
+// can be nil. Targets not matching the selectors are reported as not found.
+func WithTargetCacheSelectors(labelSelector labels.Selector, fieldSelector fields.Selector) Opt {
+	return func(r *PipelineReconciler) {
+		r.caches.labelSelector = labelSelector
+		r.caches.fieldSelector = fieldSelector
+	}
+}
+
+// WithShard makes the reconciler responsible for only the Pipelines in the shard given, so that several controllers
+// can split the Pipelines between them. The manager's cache of Pipelines should be restricted to the shard's label
+// selector too, so that Pipelines in other shards aren't held in memory.
+func WithShard(shard sharding.Shard) Opt {
+	return func(r *PipelineReconciler) {
+		r.caches.shard = shard
+	}
+}
+
+// WithImpersonator makes the reconciler read the clusters, kubeconfig Secrets and local targets of each Pipeline as the
+// service account named in its `.spec.serviceAccountName`.
+func WithImpersonator(imp *impersonation.Impersonator) Opt {
+	return func(r *PipelineReconciler) {
+		r.impersonator = imp
+	}
+}
+
+// WithClusterAccessPolicy sets the policy for which clusters a Pipeline may refer to.
+func WithClusterAccessPolicy(policy clusteraccess.Policy) Opt {
+	return func(r *PipelineReconciler) {
+		r.clusterAccess = policy
+	}
+}
@@ -2,7 +2,10 @@ package leveltriggered
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
 	"github.com/fluxcd/pkg/apis/meta"
@@ -123,6 +126,22 @@ func TestPromotionAlgorithm(t *testing.T) {
 			return true
 		}, "5s", "0.2s").Should(BeTrue())
 
+		t.Run("records the promotions in the environments' history", func(t *testing.T) {
+			g := testingutils.NewGomegaWithT(t)
+			p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+
+			g.Expect(p.Status.Environments["dev"].PromotionHistory).To(BeEmpty())
+			for source, target := range map[string]string{"dev": "staging", "staging": "prod"} {
+				history := p.Status.Environments[target].PromotionHistory
+				g.Expect(history).NotTo(BeEmpty())
+				g.Expect(history[0].SourceEnvironment).To(Equal(source))
+				g.Expect(history[0].TargetEnvironment).To(Equal(target))
+				g.Expect(history[0].Revision).To(Equal(versionToPromote))
+				g.Expect(history[0].Strategy).To(Equal("notification"))
+				g.Expect(history[0].Outcome).To(Equal(v1alpha1.PromotionSucceeded))
+			}
+		})
+
 		t.Run("triggers another promotion if the app is updated again", func(t *testing.T) {
 			g := testingutils.NewGomegaWithT(t)
 			// Bumping dev revision to trigger the promotion
@@ -211,6 +230,864 @@ func TestPromotionAlgorithm(t *testing.T) {
 	})
 }
 
+func TestSoakTime(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	name := "pipeline-" + rand.String(5)
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+
+	stagingApp := createApp(ctx, k8sClient, g, name, stagingNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, stagingApp, "v1.0.0")
+
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Do(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) {
+			setAppRevision(ctx, g, stagingApp, prom.Version)
+		})
+
+	const soak = 3 * time.Second
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name: "dev",
+					Targets: []v1alpha1.Target{
+						{Namespace: devNs.Name},
+					},
+					MinSoakDuration: &metav1.Duration{Duration: soak},
+				},
+				{
+					Name: "staging",
+					Targets: []v1alpha1.Target{
+						{Namespace: stagingNs.Name},
+					},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.1")
+	promotionTriggered := time.Now()
+
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), pipelineconditions.PromotionPendingCondition, metav1.ConditionTrue, v1alpha1.SoakingReason)
+
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	g.Expect(getTargetStatus(g, p, "dev", 0).ReadySince).NotTo(BeNil())
+	g.Expect(getTargetStatus(g, p, "staging", 0).Revision).To(Equal("v1.0.0"))
+
+	// the controller requeues itself once the soak time has passed, with no other changes needed.
+	g.Eventually(func() string {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return getTargetStatus(g, p, "staging", 0).Revision
+	}, "10s", "0.2s").Should(Equal("v1.0.1"))
+	g.Expect(time.Since(promotionTriggered)).To(BeNumerically(">=", soak))
+}
+
+func TestPromotionDependencies(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingEUNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingUSNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	prodNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	name := "pipeline-" + rand.String(5)
+	apps := map[string]*helmv2.HelmRelease{}
+	for env, ns := range map[string]string{
+		"dev":        devNs.Name,
+		"staging-eu": stagingEUNs.Name,
+		"staging-us": stagingUSNs.Name,
+		"prod":       prodNs.Name,
+	} {
+		apps[env] = createApp(ctx, k8sClient, g, name, ns)
+		setAppRevisionAndReadyStatus(ctx, g, apps[env], "v1.0.0")
+	}
+
+	var promotionsMu sync.Mutex
+	promotions := map[string]int{}
+
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Do(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) {
+			promotionsMu.Lock()
+			promotions[prom.Environment.Name]++
+			promotionsMu.Unlock()
+			// staging-us is held back, so that prod has to wait for it.
+			if prom.Environment.Name != "staging-us" {
+				setAppRevision(ctx, g, apps[prom.Environment.Name], prom.Version)
+			}
+		})
+	promotionCount := func(env string) int {
+		promotionsMu.Lock()
+		defer promotionsMu.Unlock()
+		return promotions[env]
+	}
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:      "staging-eu",
+					Targets:   []v1alpha1.Target{{Namespace: stagingEUNs.Name}},
+					DependsOn: []string{"dev"},
+				},
+				{
+					Name:      "staging-us",
+					Targets:   []v1alpha1.Target{{Namespace: stagingUSNs.Name}},
+					DependsOn: []string{"dev"},
+				},
+				{
+					Name:      "prod",
+					Targets:   []v1alpha1.Target{{Namespace: prodNs.Name}},
+					DependsOn: []string{"staging-eu", "staging-us"},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	setAppRevisionAndReadyStatus(ctx, g, apps["dev"], "v1.0.1")
+
+	// both staging environments are promoted to ...
+	g.Eventually(func() bool {
+		return promotionCount("staging-eu") > 0 && promotionCount("staging-us") > 0
+	}, "5s", "0.2s").Should(BeTrue())
+	g.Eventually(func() string {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return getTargetStatus(g, p, "staging-eu", 0).Revision
+	}, "5s", "0.2s").Should(Equal("v1.0.1"))
+
+	// ... but prod waits for both of them.
+	g.Consistently(func() int {
+		return promotionCount("prod")
+	}, "2s", "0.2s").Should(BeZero())
+
+	setAppRevision(ctx, g, apps["staging-us"], "v1.0.1")
+
+	g.Eventually(func() string {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return getTargetStatus(g, p, "prod", 0).Revision
+	}, "5s", "0.2s").Should(Equal("v1.0.1"))
+
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	g.Expect(p.Status.Environments["prod"].PromotionHistory).NotTo(BeEmpty())
+	g.Expect(p.Status.Environments["prod"].PromotionHistory[0].SourceEnvironment).To(Equal("staging-eu,staging-us"))
+}
+
+func TestInFlightPromotion(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	name := "pipeline-" + rand.String(5)
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+	stagingApp := createApp(ctx, k8sClient, g, name, stagingNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, stagingApp, "v1.0.0")
+
+	var promotionsMu sync.Mutex
+	var promotions []string
+
+	// the strategy never takes effect, so the promotion stays in flight.
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) (*strategy.PromotionResult, error) {
+			promotionsMu.Lock()
+			defer promotionsMu.Unlock()
+			promotions = append(promotions, prom.Version)
+			return &strategy.PromotionResult{Location: "https://example.com/pr/" + prom.Version}, nil
+		})
+	getPromotions := func() []string {
+		promotionsMu.Lock()
+		defer promotionsMu.Unlock()
+		return append([]string(nil), promotions...)
+	}
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:    "staging",
+					Targets: []v1alpha1.Target{{Namespace: stagingNs.Name}},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.1")
+
+	g.Eventually(func() *v1alpha1.InFlightPromotion {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return p.Status.Environments["staging"].InFlightPromotion
+	}, "5s", "0.2s").ShouldNot(BeNil())
+
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	inFlight := p.Status.Environments["staging"].InFlightPromotion
+	g.Expect(inFlight.Revision).To(Equal("v1.0.1"))
+	g.Expect(inFlight.Location).To(Equal("https://example.com/pr/v1.0.1"))
+
+	// further reconciliations don't run the strategy again for the same revision
+	p.Annotations = map[string]string{"test": "reconcile"}
+	g.Expect(k8sClient.Update(ctx, p)).To(Succeed())
+	g.Consistently(getPromotions, "2s", "0.2s").Should(Equal([]string{"v1.0.1"}))
+
+	// a new revision is promoted straight away
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.2")
+	g.Eventually(getPromotions, "5s", "0.2s").Should(Equal([]string{"v1.0.1", "v1.0.2"}))
+
+	// and once the environment runs the revision, the in-flight promotion is cleared
+	setAppRevision(ctx, g, stagingApp, "v1.0.2")
+	g.Eventually(func() *v1alpha1.InFlightPromotion {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return p.Status.Environments["staging"].InFlightPromotion
+	}, "5s", "0.2s").Should(BeNil())
+}
+
+func TestFailedPromotion(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	name := "pipeline-" + rand.String(5)
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+	stagingApp := createApp(ctx, k8sClient, g, name, stagingNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, stagingApp, "v1.0.0")
+
+	var promotionsMu sync.Mutex
+	var promotions int
+
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) (*strategy.PromotionResult, error) {
+			promotionsMu.Lock()
+			defer promotionsMu.Unlock()
+			promotions++
+			return nil, errors.New("git provider unavailable")
+		})
+	getPromotions := func() int {
+		promotionsMu.Lock()
+		defer promotionsMu.Unlock()
+		return promotions
+	}
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:    "staging",
+					Targets: []v1alpha1.Target{{Namespace: stagingNs.Name}},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.1")
+
+	g.Eventually(func() []v1alpha1.PromotionRecord {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return p.Status.Environments["staging"].PromotionHistory
+	}, "5s", "0.2s").ShouldNot(BeEmpty())
+
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	record := p.Status.Environments["staging"].PromotionHistory[0]
+	g.Expect(record.Outcome).To(Equal(v1alpha1.PromotionFailed))
+	g.Expect(record.Error).To(Equal("git provider unavailable"))
+	g.Expect(p.Status.Environments["staging"].InFlightPromotion).To(BeNil())
+
+	// the failed promotion is retried after the backoff, not straight away.
+	g.Consistently(getPromotions, "2s", "0.2s").Should(Equal(1))
+}
+
+func TestManualPromotion(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	name := "pipeline-" + rand.String(5)
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	prodNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+	prodApp := createApp(ctx, k8sClient, g, name, prodNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, prodApp, "v1.0.0")
+
+	var promotionsMu sync.Mutex
+	var promotions []v1alpha1.Promotion
+
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Do(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) {
+			promotionsMu.Lock()
+			promotions = append(promotions, p)
+			promotionsMu.Unlock()
+			setAppRevision(ctx, g, prodApp, prom.Version)
+		})
+	getPromotions := func() []v1alpha1.Promotion {
+		promotionsMu.Lock()
+		defer promotionsMu.Unlock()
+		return append([]v1alpha1.Promotion(nil), promotions...)
+	}
+
+	// there's no pipeline-wide promotion, only one for the prod environment.
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:    "prod",
+					Targets: []v1alpha1.Target{{Namespace: prodNs.Name}},
+					Promotion: &v1alpha1.Promotion{
+						Manual: true,
+						Strategy: v1alpha1.Strategy{
+							Notification: &v1alpha1.NotificationPromotion{},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.1")
+
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), pipelineconditions.PromotionPendingCondition, metav1.ConditionTrue, v1alpha1.WaitingApprovalReason)
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	g.Expect(p.Status.GetWaitingApproval("prod").Revision).To(Equal("v1.0.1"))
+	g.Consistently(getPromotions, "1s", "0.2s").Should(BeEmpty())
+
+	// approve the revision, as the approval webhook would
+	p.Status.SetApprovedRevision("prod", "v1.0.1")
+	g.Expect(k8sClient.Status().Update(ctx, p)).To(Succeed())
+
+	g.Eventually(func() string {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return getTargetStatus(g, p, "prod", 0).Revision
+	}, "5s", "0.2s").Should(Equal("v1.0.1"))
+
+	// the strategy was given the environment's promotion
+	g.Expect(getPromotions()).NotTo(BeEmpty())
+	g.Expect(getPromotions()[0].Manual).To(BeTrue())
+
+	p = getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	g.Expect(p.Status.GetWaitingApproval("prod").Revision).To(BeEmpty())
+}
+
+func TestRollback(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	name := "pipeline-" + rand.String(5)
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+	stagingApp := createApp(ctx, k8sClient, g, name, stagingNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, stagingApp, "v1.0.0")
+
+	const badRevision = "v1.0.1"
+
+	var promotionsMu sync.Mutex
+	var promotions []string
+
+	// the bad revision never becomes ready in staging; any other revision does.
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Do(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) {
+			promotionsMu.Lock()
+			promotions = append(promotions, prom.Version)
+			promotionsMu.Unlock()
+
+			status := metav1.ConditionTrue
+			if prom.Version == badRevision {
+				status = metav1.ConditionFalse
+			}
+			stagingApp.Status.LastAppliedRevision = prom.Version
+			apimeta.SetStatusCondition(&stagingApp.Status.Conditions, metav1.Condition{Type: "Ready", Status: status, Reason: "test"})
+			g.Expect(k8sClient.Status().Update(ctx, stagingApp)).To(Succeed())
+		})
+	getPromotions := func() []string {
+		promotionsMu.Lock()
+		defer promotionsMu.Unlock()
+		return append([]string(nil), promotions...)
+	}
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:    "staging",
+					Targets: []v1alpha1.Target{{Namespace: stagingNs.Name}},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Rollback: &v1alpha1.RollbackPolicy{
+					Timeout: metav1.Duration{Duration: time.Second},
+				},
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	g.Eventually(func() string {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		return p.Status.Environments["staging"].KnownGoodRevision
+	}, "5s", "0.2s").Should(Equal("v1.0.0"))
+
+	setAppRevisionAndReadyStatus(ctx, g, devApp, badRevision)
+
+	// the bad revision is promoted, then rolled back once staging has been unhealthy for long enough
+	g.Eventually(getPromotions, "10s", "0.2s").Should(Equal([]string{badRevision, "v1.0.0"}))
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), pipelineconditions.RolledBackCondition, metav1.ConditionTrue, v1alpha1.RolledBackReason)
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), pipelineconditions.PromotionPendingCondition, metav1.ConditionTrue, v1alpha1.RolledBackReason)
+
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	g.Expect(p.Status.Environments["staging"].RolledBackRevision).To(Equal(badRevision))
+	g.Expect(p.Status.Environments["staging"].PromotionHistory[0].Rollback).To(BeTrue())
+	g.Expect(p.Status.Environments["staging"].PromotionHistory[0].Revision).To(Equal("v1.0.0"))
+
+	// the bad revision isn't promoted again
+	g.Consistently(getPromotions, "2s", "0.2s").Should(HaveLen(2))
+
+	// but a newer revision is, after which the rollback is forgotten
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.2")
+	g.Eventually(getPromotions, "5s", "0.2s").Should(Equal([]string{badRevision, "v1.0.0", "v1.0.2"}))
+	g.Eventually(func() *metav1.Condition {
+		return apimeta.FindStatusCondition(getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline)).Status.Conditions, pipelineconditions.RolledBackCondition)
+	}, "5s", "0.2s").Should(BeNil())
+}
+
+func TestFreezeWindows(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	name := "pipeline-" + rand.String(5)
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+	stagingApp := createApp(ctx, k8sClient, g, name, stagingNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, stagingApp, "v1.0.0")
+
+	var promotionsMu sync.Mutex
+	var promotions []string
+
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Do(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) {
+			promotionsMu.Lock()
+			promotions = append(promotions, prom.Version)
+			promotionsMu.Unlock()
+			setAppRevision(ctx, g, stagingApp, prom.Version)
+		})
+	getPromotions := func() []string {
+		promotionsMu.Lock()
+		defer promotionsMu.Unlock()
+		return append([]string(nil), promotions...)
+	}
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:    "staging",
+					Targets: []v1alpha1.Target{{Namespace: stagingNs.Name}},
+					// a window starting every minute and lasting an hour is always in force.
+					FreezeWindows: []v1alpha1.FreezeWindow{{
+						Schedule: "* * * * *",
+						Duration: metav1.Duration{Duration: time.Hour},
+					}},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.1")
+
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), pipelineconditions.PromotionPendingCondition, metav1.ConditionTrue, v1alpha1.FrozenReason)
+	g.Consistently(getPromotions, "1s", "0.2s").Should(BeEmpty())
+
+	// lifting the freeze lets the promotion go ahead
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	p.Spec.Environments[1].FreezeWindows = nil
+	g.Expect(k8sClient.Update(ctx, p)).To(Succeed())
+
+	g.Eventually(getPromotions, "5s", "0.2s").Should(Equal([]string{"v1.0.1"}))
+}
+
+func TestSuspend(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	name := "pipeline-" + rand.String(5)
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+	stagingApp := createApp(ctx, k8sClient, g, name, stagingNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, stagingApp, "v1.0.0")
+
+	var promotionsMu sync.Mutex
+	var promotions []string
+
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Do(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) {
+			promotionsMu.Lock()
+			promotions = append(promotions, prom.Version)
+			promotionsMu.Unlock()
+			setAppRevision(ctx, g, stagingApp, prom.Version)
+		})
+	getPromotions := func() []string {
+		promotionsMu.Lock()
+		defer promotionsMu.Unlock()
+		return append([]string(nil), promotions...)
+	}
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:    "staging",
+					Targets: []v1alpha1.Target{{Namespace: stagingNs.Name}},
+					Suspend: true,
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.1")
+
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), pipelineconditions.PromotionPendingCondition, metav1.ConditionTrue, v1alpha1.SuspendedReason)
+	g.Consistently(getPromotions, "1s", "0.2s").Should(BeEmpty())
+
+	// the status of the suspended environment is still recorded
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	g.Expect(getTargetStatus(g, p, "staging", 0).Revision).To(Equal("v1.0.0"))
+
+	// resuming lets the promotion go ahead
+	p.Spec.Environments[1].Suspend = false
+	g.Expect(k8sClient.Update(ctx, p)).To(Succeed())
+
+	g.Eventually(getPromotions, "5s", "0.2s").Should(Equal([]string{"v1.0.1"}))
+}
+
+func TestEnvironmentSummary(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+
+	name := "pipeline-" + rand.String(5)
+	managementNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	devNs := testingutils.NewNamespace(ctx, g, k8sClient)
+	stagingNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	devApp := createApp(ctx, k8sClient, g, name, devNs.Name)
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.0")
+	stagingApp := createApp(ctx, k8sClient, g, name, stagingNs.Name)
+	setAppRevision(ctx, g, stagingApp, "v1.0.0")
+
+	mockStrategy := installMockStrategy(t, pipelineReconciler)
+	mockStrategy.EXPECT().Handles(gomock.Any()).Return(true).AnyTimes()
+	mockStrategy.EXPECT().
+		Promote(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Do(func(ctx context.Context, p v1alpha1.Promotion, prom strategy.Promotion) {
+			setAppRevisionAndReadyStatus(ctx, g, stagingApp, prom.Version)
+		})
+
+	pipeline := &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: managementNs.Name,
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       name,
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: devNs.Name}},
+				},
+				{
+					Name:    "staging",
+					Targets: []v1alpha1.Target{{Namespace: stagingNs.Name}},
+					Suspend: true,
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			},
+		},
+	}
+
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+
+	g.Eventually(func(g Gomega) {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		g.Expect(p.Status.FirstEnvironmentRevision).To(Equal("v1.0.0"))
+		g.Expect(p.Status.LastEnvironmentRevision).To(Equal("v1.0.0"))
+
+		dev := p.Status.Environments["dev"]
+		g.Expect(dev.Revision).To(Equal("v1.0.0"))
+		g.Expect(dev.ReadyTargets).To(BeEquivalentTo(1))
+		g.Expect(dev.TotalTargets).To(BeEquivalentTo(1))
+		g.Expect(apimeta.IsStatusConditionTrue(dev.Conditions, meta.ReadyCondition)).To(BeTrue())
+		g.Expect(apimeta.IsStatusConditionTrue(dev.Conditions, pipelineconditions.ConvergedCondition)).To(BeTrue())
+
+		staging := p.Status.Environments["staging"]
+		g.Expect(staging.ReadyTargets).To(BeEquivalentTo(0))
+		g.Expect(apimeta.FindStatusCondition(staging.Conditions, meta.ReadyCondition).Reason).To(Equal(v1alpha1.TargetsNotReadyReason))
+	}, defaultTimeout, defaultInterval).Should(Succeed())
+
+	// a promotion held back is reported against the environment it's held back from.
+	setAppRevisionAndReadyStatus(ctx, g, devApp, "v1.0.1")
+
+	g.Eventually(func(g Gomega) {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		g.Expect(p.Status.FirstEnvironmentRevision).To(Equal("v1.0.1"))
+		pending := apimeta.FindStatusCondition(p.Status.Environments["staging"].Conditions, pipelineconditions.PromotionPendingCondition)
+		g.Expect(pending).NotTo(BeNil())
+		g.Expect(pending.Reason).To(Equal(v1alpha1.SuspendedReason))
+		g.Expect(apimeta.FindStatusCondition(p.Status.Environments["dev"].Conditions, pipelineconditions.PromotionPendingCondition)).To(BeNil())
+	}, defaultTimeout, defaultInterval).Should(Succeed())
+
+	// once the promotion goes ahead, the condition is removed and the promotion time recorded.
+	p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+	p.Spec.Environments[1].Suspend = false
+	g.Expect(k8sClient.Update(ctx, p)).To(Succeed())
+
+	g.Eventually(func(g Gomega) {
+		p := getPipeline(ctx, g, client.ObjectKeyFromObject(pipeline))
+		staging := p.Status.Environments["staging"]
+		g.Expect(staging.Revision).To(Equal("v1.0.1"))
+		g.Expect(staging.LastPromotionTime).NotTo(BeNil())
+		g.Expect(apimeta.FindStatusCondition(staging.Conditions, pipelineconditions.PromotionPendingCondition)).To(BeNil())
+		g.Expect(p.Status.LastEnvironmentRevision).To(Equal("v1.0.1"))
+	}, defaultTimeout, defaultInterval).Should(Succeed())
+}
+
+func TestInvalidDependencies(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	ctx := context.TODO()
+	name := "pipeline-" + rand.String(5)
+	ns := testingutils.NewNamespace(ctx, g, k8sClient)
+
+	pipeline := newPipeline(name, ns.Name, nil)
+	pipeline.Spec.Environments = append(pipeline.Spec.Environments, v1alpha1.Environment{
+		Name:    "prod",
+		Targets: []v1alpha1.Target{{Namespace: ns.Name}},
+	})
+	pipeline.Spec.Environments[0].DependsOn = []string{"prod"}
+	g.Expect(k8sClient.Create(ctx, pipeline)).To(Succeed())
+
+	checkCondition(ctx, g, client.ObjectKeyFromObject(pipeline), meta.ReadyCondition, metav1.ConditionFalse, v1alpha1.InvalidDependenciesReason)
+}
+
 func setAppRevisionAndReadyStatus(ctx context.Context, g Gomega, hr *helmv2.HelmRelease, revision string) {
 	setAppRevision(ctx, g, hr, revision)
 	setAppStatusReadyCondition(ctx, g, hr)
@@ -18,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
@@ -122,6 +123,10 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalf("add GitopsCluster to schema failed: %s", err)
 	}
+	err = clusterv1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		log.Fatalf("add CAPI Cluster to schema failed: %s", err)
+	}
 
 	err = helmv2.AddToScheme(scheme.Scheme)
 	if err != nil {
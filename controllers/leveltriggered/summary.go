@@ -0,0 +1,106 @@
+package leveltriggered
+
+import (
+	"fmt"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/metrics"
+	"github.com/weaveworks/pipeline-controller/pkg/conditions"
+)
+
+// summarizeEnvironment sets the fields of an environment's status that summarise the status of its targets, and its
+// Ready and Converged conditions.
+func summarizeEnvironment(env *v1alpha1.EnvironmentStatus) {
+	env.Revision = checkAllTargetsHaveSameRevision(env)
+	env.TotalTargets = int32(len(env.Targets))
+	env.ReadyTargets = 0
+	for _, target := range env.Targets {
+		if target.Ready {
+			env.ReadyTargets++
+		}
+	}
+
+	readyCondition := metav1.Condition{
+		Type:    conditions.ReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1alpha1.AllTargetsReadyReason,
+		Message: fmt.Sprintf("%d/%d targets are ready", env.ReadyTargets, env.TotalTargets),
+	}
+	if env.ReadyTargets < env.TotalTargets {
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = v1alpha1.TargetsNotReadyReason
+	}
+	apimeta.SetStatusCondition(&env.Conditions, readyCondition)
+
+	convergedCondition := metav1.Condition{
+		Type:    conditions.ConvergedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1alpha1.RevisionsConvergedReason,
+		Message: fmt.Sprintf("All targets run revision %s", env.Revision),
+	}
+	if env.Revision == "" {
+		convergedCondition.Status = metav1.ConditionFalse
+		convergedCondition.Reason = v1alpha1.RevisionsDivergedReason
+		convergedCondition.Message = "Targets run different revisions, or have no revision"
+	}
+	apimeta.SetStatusCondition(&env.Conditions, convergedCondition)
+}
+
+// setEnvironmentRevisions records the revisions of the first and last environments in the pipeline status, where they can
+// be shown as printer columns.
+func setEnvironmentRevisions(pipeline *v1alpha1.Pipeline) {
+	pipeline.Status.FirstEnvironmentRevision = ""
+	pipeline.Status.LastEnvironmentRevision = ""
+
+	envs := pipeline.Spec.Environments
+	if len(envs) == 0 {
+		return
+	}
+	if first := pipeline.Status.Environments[envs[0].Name]; first != nil {
+		pipeline.Status.FirstEnvironmentRevision = first.Revision
+	}
+	if last := pipeline.Status.Environments[envs[len(envs)-1].Name]; last != nil {
+		pipeline.Status.LastEnvironmentRevision = last.Revision
+	}
+}
+
+// recordTargetMetrics sets the target readiness metrics of each of the pipeline's environments, dropping those of
+// environments that have been removed.
+func recordTargetMetrics(pipeline *v1alpha1.Pipeline) {
+	metrics.DeletePipeline(pipeline.Namespace, pipeline.Name)
+	for name, env := range pipeline.Status.Environments {
+		if env != nil {
+			metrics.SetTargets(pipeline.Namespace, pipeline.Name, name, env.ReadyTargets, env.TotalTargets)
+		}
+	}
+}
+
+// setEnvironmentPendingCondition sets the PromotionPending condition of both the pipeline and the environment given.
+func setEnvironmentPendingCondition(pipeline *v1alpha1.Pipeline, env, reason, message string) {
+	setPendingCondition(pipeline, reason, message)
+
+	envStatus := pipeline.Status.Environments[env]
+	if envStatus == nil {
+		return
+	}
+	apimeta.SetStatusCondition(&envStatus.Conditions, metav1.Condition{
+		Type:    conditions.PromotionPendingCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// removeEnvironmentPendingConditions removes the PromotionPending condition of each environment not in `pending`. This is
+// done after deciding what to promote, rather than before, so that the conditions that are set again keep their last
+// transition time.
+func removeEnvironmentPendingConditions(pipeline *v1alpha1.Pipeline, pending map[string]bool) {
+	for name, envStatus := range pipeline.Status.Environments {
+		if envStatus != nil && !pending[name] {
+			apimeta.RemoveStatusCondition(&envStatus.Conditions, conditions.PromotionPendingCondition)
+		}
+	}
+}
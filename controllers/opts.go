@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"github.com/weaveworks/pipeline-controller/internal/clusteraccess"
+)
+
+type Opt func(r *PipelineReconciler)
+
+// WithClusterAccessPolicy sets the policy for which clusters a Pipeline may refer to.
+func WithClusterAccessPolicy(policy clusteraccess.Policy) Opt {
+	return func(r *PipelineReconciler) {
+		r.clusterAccess = policy
+	}
+}
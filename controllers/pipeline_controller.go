@@ -18,6 +18,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/clusteraccess"
 	"github.com/weaveworks/pipeline-controller/pkg/conditions"
 )
 
@@ -28,21 +29,27 @@ type PipelineReconciler struct {
 	targetScheme   *runtime.Scheme
 	ControllerName string
 	recorder       record.EventRecorder
+	clusterAccess  clusteraccess.Policy
 }
 
 func NewPipelineReconciler(
 	c client.Client,
 	s *runtime.Scheme,
 	controllerName string,
+	opts ...Opt,
 ) *PipelineReconciler {
 	targetScheme := runtime.NewScheme()
 
-	return &PipelineReconciler{
+	r := &PipelineReconciler{
 		Client:         c,
 		Scheme:         s,
 		targetScheme:   targetScheme,
 		ControllerName: controllerName,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 //+kubebuilder:rbac:groups=pipelines.weave.works,resources=pipelines,verbs=get;list;watch;create;update;patch;delete
@@ -105,6 +112,29 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 					return ctrl.Result{}, err
 				}
 
+				// this won't change until the pipeline or the cluster does, both of which are watched.
+				if err := r.clusterAccess.Check(pipeline.Namespace, cluster); err != nil {
+					r.emitEventf(
+						&pipeline,
+						corev1.EventTypeWarning,
+						"ClusterNotAllowed", "Pipeline %s/%s may not refer to cluster %s: %s",
+						pipeline.GetNamespace(), pipeline.GetName(),
+						target.ClusterRef.String(),
+						err,
+					)
+					if err := r.setStatusCondition(ctx, pipeline, err.Error(), v1alpha1.TargetClusterNotAllowedReason); err != nil {
+						r.emitEventf(
+							&pipeline,
+							corev1.EventTypeWarning,
+							"SetStatusConditionError", "Failed to set status for pipeline %s/%s: %s",
+							pipeline.GetNamespace(), pipeline.GetName(),
+							err,
+						)
+						return ctrl.Result{}, err
+					}
+					return ctrl.Result{}, nil
+				}
+
 				if !conditions.IsReady(cluster.Status.Conditions) {
 					err := r.setStatusCondition(
 						ctx, pipeline,
@@ -93,6 +93,26 @@ func TestReconcile(t *testing.T) {
 		g.Expect(events[0].reason).To(Equal("Updated"))
 		g.Expect(events[0].message).To(ContainSubstring("Updated pipeline"))
 	})
+
+	t.Run("sets cluster not allowed condition", func(_ *testing.T) {
+		name := "pipeline-" + rand.String(5)
+		ns := testingutils.NewNamespace(ctx, g, k8sClient)
+		clusterNs := testingutils.NewNamespace(ctx, g, k8sClient)
+
+		gc := testingutils.NewGitopsCluster(ctx, g, k8sClient, name, clusterNs.Name, kubeConfig)
+		apimeta.SetStatusCondition(&gc.Status.Conditions, metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "test"})
+		g.Expect(k8sClient.Status().Update(ctx, gc)).To(Succeed())
+		gc.Annotations = map[string]string{v1alpha1.AllowedNamespacesAnnotation: "some-other-namespace"}
+		g.Expect(k8sClient.Update(ctx, gc)).To(Succeed())
+
+		pipeline := newPipeline(ctx, g, name, ns.Name, []*clusterctrlv1alpha1.GitopsCluster{gc})
+		checkReadyCondition(ctx, g, client.ObjectKeyFromObject(pipeline), metav1.ConditionFalse, v1alpha1.TargetClusterNotAllowedReason)
+
+		// allow the pipeline's namespace, and check that the controller notices
+		gc.Annotations[v1alpha1.AllowedNamespacesAnnotation] = "some-other-namespace," + ns.Name
+		g.Expect(k8sClient.Update(ctx, gc)).To(Succeed())
+		checkReadyCondition(ctx, g, client.ObjectKeyFromObject(pipeline), metav1.ConditionTrue, v1alpha1.ReconciliationSucceededReason)
+	})
 }
 
 func checkReadyCondition(ctx context.Context, g Gomega, n types.NamespacedName, status metav1.ConditionStatus, reason string) {
@@ -0,0 +1,48 @@
+// Package clusteraccess decides whether a Pipeline may refer to a cluster object in another namespace, so that tenants
+// sharing a management cluster can't use each other's clusters.
+package clusteraccess
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+// ErrNotAllowed is returned when a Pipeline refers to a cluster object that it's not allowed to refer to.
+var ErrNotAllowed = errors.New("cluster reference not allowed")
+
+// Policy says which cluster objects Pipelines may refer to. A Pipeline may always refer to a cluster object in its own
+// namespace. A cluster object with the v1alpha1.AllowedNamespacesAnnotation may be referred to from the namespaces it
+// lists; the zero value of Policy allows references to any other cluster object.
+type Policy struct {
+	// NoCrossNamespaceRefs, if true, disallows references to cluster objects in other namespaces, unless they list the
+	// namespace of the Pipeline in their v1alpha1.AllowedNamespacesAnnotation.
+	NoCrossNamespaceRefs bool
+}
+
+// Check returns an error wrapping ErrNotAllowed if a Pipeline in the namespace given may not refer to the cluster object
+// given, and nil otherwise.
+func (p Policy) Check(pipelineNamespace string, cluster client.Object) error {
+	if cluster.GetNamespace() == pipelineNamespace {
+		return nil
+	}
+	allowed, ok := cluster.GetAnnotations()[v1alpha1.AllowedNamespacesAnnotation]
+	if !ok {
+		if p.NoCrossNamespaceRefs {
+			return fmt.Errorf("%w: cross-namespace references to %s/%s are disabled, and it does not allow namespace %q with the %s annotation",
+				ErrNotAllowed, cluster.GetNamespace(), cluster.GetName(), pipelineNamespace, v1alpha1.AllowedNamespacesAnnotation)
+		}
+		return nil
+	}
+	for _, ns := range strings.Split(allowed, ",") {
+		if ns = strings.TrimSpace(ns); ns == "*" || ns == pipelineNamespace {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s/%s does not allow namespace %q with the %s annotation",
+		ErrNotAllowed, cluster.GetNamespace(), cluster.GetName(), pipelineNamespace, v1alpha1.AllowedNamespacesAnnotation)
+}
@@ -0,0 +1,52 @@
+package clusteraccess_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	clusterctrlv1alpha1 "github.com/weaveworks/cluster-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/clusteraccess"
+)
+
+func cluster(namespace string, allowed *string) *clusterctrlv1alpha1.GitopsCluster {
+	c := &clusterctrlv1alpha1.GitopsCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: namespace},
+	}
+	if allowed != nil {
+		c.Annotations = map[string]string{v1alpha1.AllowedNamespacesAnnotation: *allowed}
+	}
+	return c
+}
+
+func TestCheck(t *testing.T) {
+	list := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		policy  clusteraccess.Policy
+		cluster *clusterctrlv1alpha1.GitopsCluster
+		allowed bool
+	}{
+		{name: "same namespace", policy: clusteraccess.Policy{NoCrossNamespaceRefs: true}, cluster: cluster("tenant", list("other")), allowed: true},
+		{name: "cross-namespace by default", cluster: cluster("clusters", nil), allowed: true},
+		{name: "cross-namespace disabled", policy: clusteraccess.Policy{NoCrossNamespaceRefs: true}, cluster: cluster("clusters", nil)},
+		{name: "listed", policy: clusteraccess.Policy{NoCrossNamespaceRefs: true}, cluster: cluster("clusters", list("dev, tenant")), allowed: true},
+		{name: "wildcard", policy: clusteraccess.Policy{NoCrossNamespaceRefs: true}, cluster: cluster("clusters", list("*")), allowed: true},
+		{name: "not listed", cluster: cluster("clusters", list("dev,staging"))},
+		{name: "empty list", cluster: cluster("clusters", list(""))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check("tenant", tt.cluster)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, clusteraccess.ErrNotAllowed)
+			}
+		})
+	}
+}
@@ -192,7 +192,7 @@ func (p *AzureDevOpsProvider) ListPullRequests(ctx context.Context, repoURL stri
 func (p *AzureDevOpsProvider) sendRawRequest(ctx context.Context, request *scm.Request) (*scm.Response, error) {
 	resp, err := p.client.Do(ctx, request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to commit files: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	defer resp.Body.Close()
@@ -227,6 +227,60 @@ func (p *AzureDevOpsProvider) UpdatePullRequest(ctx context.Context, repoURL str
 	}, nil
 }
 
+func (p *AzureDevOpsProvider) ClosePullRequest(ctx context.Context, repoURL string, number int) error {
+	jsmc := jenkinsSCM{}
+
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse url %q: %w", repoURL, err)
+	}
+
+	repo, err := jsmc.GetRepository(ctx, p.log, p.client, u)
+	if err != nil {
+		return err
+	}
+
+	// closing a pull request without merging it is called abandoning it in Azure DevOps.
+	if _, err := p.client.PullRequests.Close(ctx, repo.FullName, number); err != nil {
+		return fmt.Errorf("failed to abandon PR %d: %w", number, err)
+	}
+
+	return nil
+}
+
+func (p *AzureDevOpsProvider) DeleteBranch(ctx context.Context, repoURL, branch string) error {
+	jsmc := jenkinsSCM{}
+
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse url %q: %w", repoURL, err)
+	}
+
+	repo, err := jsmc.GetRepository(ctx, p.log, p.client, u)
+	if err != nil {
+		return err
+	}
+
+	// the Azure driver doesn't support deleting references, so this updates the branch to point at nothing, which is
+	// how Azure DevOps deletes a branch. That needs the commit the branch currently points at.
+	branches, _, err := p.client.Git.ListBranches(ctx, repo.FullName, &scm.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	for _, b := range branches {
+		if b.Name != branch {
+			continue
+		}
+
+		if _, err := p.sendRawRequest(ctx, jsmc.DeleteBranchRequest(b.Sha, repoURL, branch)); err != nil {
+			return fmt.Errorf("failed to delete branch %q: %w", branch, err)
+		}
+	}
+
+	return nil
+}
+
 func (p *AzureDevOpsProvider) Name() string {
 	return AzureDevOpsProviderName
 }
@@ -1,8 +1,13 @@
 package git
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/fluxcd/go-git-providers/gitprovider"
 	"github.com/fluxcd/go-git-providers/stash"
@@ -167,6 +172,87 @@ func (p *BitBucketServerProvider) UpdatePullRequest(ctx context.Context, repoURL
 	})
 }
 
+func (p *BitBucketServerProvider) ClosePullRequest(ctx context.Context, repoURL string, number int) error {
+	raw, ref, err := p.rawRepository(repoURL)
+	if err != nil {
+		return err
+	}
+
+	// declining a pull request needs its current version, so that it isn't declined after a change that wasn't seen.
+	pr, err := raw.PullRequests.Get(ctx, ref.Key(), ref.RepositoryName, number)
+	if err != nil {
+		return fmt.Errorf("failed to get PR %d: %w", number, err)
+	}
+
+	req, err := raw.NewRequest(ctx, http.MethodPost,
+		fmt.Sprintf("/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d/decline", ref.Key(), ref.RepositoryName, number),
+		stash.WithQuery(url.Values{"version": []string{strconv.Itoa(pr.Version)}}),
+		stash.WithHeader(http.Header{"X-Atlassian-Token": []string{"no-check"}}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create request to decline PR %d: %w", number, err)
+	}
+
+	if _, _, err := raw.Do(req); err != nil {
+		return fmt.Errorf("failed to decline PR %d: %w", number, err)
+	}
+
+	return nil
+}
+
+func (p *BitBucketServerProvider) DeleteBranch(ctx context.Context, repoURL, branch string) error {
+	raw, ref, err := p.rawRepository(repoURL)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"name":   "refs/heads/" + branch,
+		"dryRun": false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// branches are deleted through the branch utils API rather than the core REST API.
+	req, err := raw.NewRequest(ctx, http.MethodDelete,
+		fmt.Sprintf("/rest/branch-utils/1.0/projects/%s/repos/%s/branches", ref.Key(), ref.RepositoryName),
+		stash.WithBody(bytes.NewReader(body)),
+		stash.WithHeader(http.Header{"Content-Type": []string{"application/json"}}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create request to delete branch %q: %w", branch, err)
+	}
+
+	// the client returns no error for a 404, which is what a branch that doesn't exist gets.
+	if _, _, err := raw.Do(req); err != nil {
+		return fmt.Errorf("failed to delete branch %q: %w", branch, err)
+	}
+
+	return nil
+}
+
+// rawRepository returns the go-stash client, for the operations go-git-providers doesn't support, along with the
+// reference to the repository given.
+func (p *BitBucketServerProvider) rawRepository(repoURL string) (*stash.Client, *gitprovider.OrgRepositoryRef, error) {
+	raw, ok := p.client.Raw().(*stash.Client)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected BitBucket Server client type %T", p.client.Raw())
+	}
+
+	providerURL, err := GetGitProviderUrl(repoURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get git provider url: %w", err)
+	}
+
+	ref, err := GoGitProvider{}.ParseBitbucketServerURL(providerURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return raw, ref, nil
+}
+
 func (p *BitBucketServerProvider) Name() string {
 	return BitBucketServerProviderName
 }
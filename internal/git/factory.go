@@ -55,7 +55,7 @@ func (f *ProviderFactory) Create(providerName string, opts ...ProviderWithFn) (P
 		return nil, fmt.Errorf("unable to apply options on provider %q: %w", providerName, err)
 	}
 
-	return provider, nil
+	return WithTracing(provider), nil
 }
 
 type ProviderOption struct {
@@ -3,10 +3,12 @@ package git
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/fluxcd/go-git-providers/github"
 	"github.com/fluxcd/go-git-providers/gitprovider"
 	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v49/github"
 )
 
 const GitHubProviderName string = "github"
@@ -164,10 +166,57 @@ func (p *GitHubProvider) UpdatePullRequest(ctx context.Context, repoURL string,
 	})
 }
 
-func (p *GitHubProvider) DeleteBranch(ctx context.Context, repoURL, branchName string) error {
+func (p *GitHubProvider) ClosePullRequest(ctx context.Context, repoURL string, number int) error {
+	raw, owner, name, err := p.rawRepository(ctx, repoURL)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := raw.PullRequests.Edit(ctx, owner, name, number, &gogithub.PullRequest{
+		State: gogithub.String("closed"),
+	}); err != nil {
+		return fmt.Errorf("failed to close PR %d: %w", number, err)
+	}
+
+	return nil
+}
+
+func (p *GitHubProvider) DeleteBranch(ctx context.Context, repoURL, branch string) error {
+	raw, owner, name, err := p.rawRepository(ctx, repoURL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := raw.Git.DeleteRef(ctx, owner, name, "heads/"+branch)
+	if err != nil {
+		// GitHub responds with 422 rather than 404 when the reference doesn't exist.
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete branch %q: %w", branch, err)
+	}
+
 	return nil
 }
 
+// rawRepository returns the go-github client, for the operations go-git-providers doesn't support, along with the owner
+// and name of the repository given.
+func (p *GitHubProvider) rawRepository(ctx context.Context, repoURL string) (*gogithub.Client, string, string, error) {
+	raw, ok := p.client.Raw().(*gogithub.Client)
+	if !ok {
+		return nil, "", "", fmt.Errorf("unexpected GitHub client type %T", p.client.Raw())
+	}
+
+	ggp := GoGitProvider{}
+
+	repo, err := ggp.GetRepository(ctx, p.log, p.client, repoURL)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return raw, repo.Repository().GetIdentity(), repo.Repository().GetRepository(), nil
+}
+
 func (p *GitHubProvider) Name() string {
 	return GitHubProviderName
 }
@@ -3,10 +3,12 @@ package git
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/fluxcd/go-git-providers/gitlab"
 	"github.com/fluxcd/go-git-providers/gitprovider"
 	"github.com/go-logr/logr"
+	gogitlab "github.com/xanzy/go-gitlab"
 )
 
 const (
@@ -196,6 +198,56 @@ func (p *GitLabProvider) UpdatePullRequest(ctx context.Context, repoURL string,
 	})
 }
 
+func (p *GitLabProvider) ClosePullRequest(ctx context.Context, repoURL string, number int) error {
+	raw, project, err := p.rawProject(ctx, repoURL)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := raw.MergeRequests.UpdateMergeRequest(project, number, &gogitlab.UpdateMergeRequestOptions{
+		StateEvent: gogitlab.String("close"),
+	}, gogitlab.WithContext(ctx)); err != nil {
+		return fmt.Errorf("failed to close merge request %d: %w", number, err)
+	}
+
+	return nil
+}
+
+func (p *GitLabProvider) DeleteBranch(ctx context.Context, repoURL, branch string) error {
+	raw, project, err := p.rawProject(ctx, repoURL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := raw.Branches.DeleteBranch(project, branch, gogitlab.WithContext(ctx))
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to delete branch %q: %w", branch, err)
+	}
+
+	return nil
+}
+
+// rawProject returns the go-gitlab client, for the operations go-git-providers doesn't support, along with the path of
+// the project given, including any subgroups.
+func (p *GitLabProvider) rawProject(ctx context.Context, repoURL string) (*gogitlab.Client, string, error) {
+	raw, ok := p.client.Raw().(*gogitlab.Client)
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected GitLab client type %T", p.client.Raw())
+	}
+
+	ggp := GoGitProvider{}
+
+	repo, err := ggp.GetRepository(ctx, p.log, p.client, repoURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return raw, repo.Repository().GetIdentity() + "/" + repo.Repository().GetRepository(), nil
+}
+
 func (p *GitLabProvider) Name() string {
 	return GitLabProviderName
 }
@@ -164,6 +164,9 @@ func (g GoGitProvider) GetRepository(ctx context.Context, log logr.Logger, clien
 func (g GoGitProvider) ParseBitbucketServerURL(url string) (*gitprovider.OrgRepositoryRef, error) {
 	re := regexp.MustCompile(`://(?P<host>[^/]+)/(.+/)?(?P<key>[^/]+)/(?P<repo>[^/]+)\.git`)
 	match := re.FindStringSubmatch(url)
+	if match == nil {
+		return nil, fmt.Errorf("unable to parse repository URL %q using regex %q", url, re.String())
+	}
 	result := make(map[string]string)
 	for i, name := range re.SubexpNames() {
 		if i != 0 && name != "" {
@@ -151,9 +151,38 @@ func (p *jenkinsSCM) CommitFilesRequest(sha, url, head, message string, files []
 	}
 }
 
+// DeleteBranchRequest returns a request that deletes the branch `head`, which points at the commit `sha`, by updating it
+// to the null object ID.
+//
+// See:
+// https://learn.microsoft.com/en-us/rest/api/azure/devops/git/refs/update-refs?view=azure-devops-rest-6.0
+func (p *jenkinsSCM) DeleteBranchRequest(sha, url, head string) *scm.Request {
+	endpoint, _ := p.Endpoint(url, "refs")
+
+	buf := new(bytes.Buffer)
+	_ = json.NewEncoder(buf).Encode([]refUpdate{{
+		Name:        fmt.Sprintf("refs/heads/%s", head),
+		OldObjectID: sha,
+		NewObjectID: nullObjectID,
+	}})
+
+	return &scm.Request{
+		Method: "POST",
+		Path:   endpoint,
+		Header: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+		Body: buf,
+	}
+}
+
+// nullObjectID is the object ID a reference is updated to, to delete it.
+const nullObjectID = "0000000000000000000000000000000000000000"
+
 type refUpdate struct {
 	Name        string `json:"name"`
 	OldObjectID string `json:"oldObjectId,omitempty"`
+	NewObjectID string `json:"newObjectId,omitempty"`
 }
 
 type change struct {
@@ -24,6 +24,10 @@ type Provider interface {
 	GetTreeList(ctx context.Context, repoUrl, sha, path string) ([]*TreeEntry, error)
 	ListPullRequests(ctx context.Context, repoURL string) ([]*PullRequest, error)
 	UpdatePullRequest(ctx context.Context, repoURL string, number int, options UpdatePullRequestOptions) (*PullRequest, error)
+	// ClosePullRequest closes an open pull request without merging it.
+	ClosePullRequest(ctx context.Context, repoURL string, number int) error
+	// DeleteBranch deletes a branch. Deleting a branch that doesn't exist is not an error.
+	DeleteBranch(ctx context.Context, repoURL, branch string) error
 
 	RawClient() interface{}
 }
@@ -0,0 +1,69 @@
+package git
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/weaveworks/pipeline-controller/internal/tracing"
+)
+
+// tracingProvider wraps a Provider so that each of its API calls is traced.
+type tracingProvider struct {
+	Provider
+}
+
+var _ Provider = tracingProvider{}
+
+// WithTracing returns a Provider that starts a span around each API call it makes with the provider given.
+func WithTracing(p Provider) Provider {
+	return tracingProvider{Provider: p}
+}
+
+func (p tracingProvider) start(ctx context.Context, op, repoURL string) (context.Context, func(error) error) {
+	ctx, span := tracing.Start(ctx, "git."+op,
+		attribute.String("git.provider", p.Name()),
+		attribute.String("git.repository", repoURL),
+	)
+	return ctx, func(err error) error { return tracing.End(span, err) }
+}
+
+func (p tracingProvider) CreatePullRequest(ctx context.Context, input PullRequestInput) (*PullRequest, error) {
+	ctx, end := p.start(ctx, "CreatePullRequest", input.RepositoryURL)
+	pr, err := p.Provider.CreatePullRequest(ctx, input)
+	return pr, end(err)
+}
+
+func (p tracingProvider) GetRepository(ctx context.Context, repoURL string) (*Repository, error) {
+	ctx, end := p.start(ctx, "GetRepository", repoURL)
+	repo, err := p.Provider.GetRepository(ctx, repoURL)
+	return repo, end(err)
+}
+
+func (p tracingProvider) GetTreeList(ctx context.Context, repoURL, sha, path string) ([]*TreeEntry, error) {
+	ctx, end := p.start(ctx, "GetTreeList", repoURL)
+	entries, err := p.Provider.GetTreeList(ctx, repoURL, sha, path)
+	return entries, end(err)
+}
+
+func (p tracingProvider) ListPullRequests(ctx context.Context, repoURL string) ([]*PullRequest, error) {
+	ctx, end := p.start(ctx, "ListPullRequests", repoURL)
+	prs, err := p.Provider.ListPullRequests(ctx, repoURL)
+	return prs, end(err)
+}
+
+func (p tracingProvider) UpdatePullRequest(ctx context.Context, repoURL string, number int, options UpdatePullRequestOptions) (*PullRequest, error) {
+	ctx, end := p.start(ctx, "UpdatePullRequest", repoURL)
+	pr, err := p.Provider.UpdatePullRequest(ctx, repoURL, number, options)
+	return pr, end(err)
+}
+
+func (p tracingProvider) ClosePullRequest(ctx context.Context, repoURL string, number int) error {
+	ctx, end := p.start(ctx, "ClosePullRequest", repoURL)
+	return end(p.Provider.ClosePullRequest(ctx, repoURL, number))
+}
+
+func (p tracingProvider) DeleteBranch(ctx context.Context, repoURL, branch string) error {
+	ctx, end := p.start(ctx, "DeleteBranch", repoURL)
+	return end(p.Provider.DeleteBranch(ctx, repoURL, branch))
+}
@@ -1,6 +1,8 @@
 package git
 
 import (
+	"fmt"
+	"net/url"
 	"path"
 	"strings"
 	"time"
@@ -77,6 +79,38 @@ func ParseURL(provider string, repoURL string) (ParsedURL, error) {
 	return parsed, nil
 }
 
+// ValidateRepositoryURL checks that the repository URL given can be used with the provider named.
+func ValidateRepositoryURL(provider string, repoURL string) error {
+	switch provider {
+	case GitHubProviderName, GitLabProviderName, BitBucketServerProviderName:
+		_, err := ParseURL(provider, repoURL)
+		return err
+	case AzureDevOpsProviderName:
+		return validateAzureDevOpsURL(repoURL)
+	default:
+		return fmt.Errorf("provider %q is not supported", provider)
+	}
+}
+
+// validateAzureDevOpsURL checks for a URL of the form https://dev.azure.com/{organization}/{project}/_git/{repository},
+// or https://{organization}.visualstudio.com/{project}/_git/{repository}.
+func validateAzureDevOpsURL(repoURL string) error {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("repository URL %q is not an https URL", repoURL)
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 3 || segments[len(segments)-2] != "_git" || segments[len(segments)-1] == "" {
+		return fmt.Errorf("repository URL %q does not have the form https://<host>/<organization>/<project>/_git/<repository>", repoURL)
+	}
+
+	return nil
+}
+
 func AddSchemeToDomain(domain string) string {
 	// Fixing https:// again (ggp quirk)
 	if domain != "github.com" && domain != "gitlab.com" && !strings.HasPrefix(domain, "http://") && !strings.HasPrefix(domain, "https://") {
@@ -0,0 +1,130 @@
+// Package impersonation gives clients that act as the service account named by a Pipeline, so that a Pipeline can only
+// get the controller to read what its service account is allowed to read.
+package impersonation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=impersonate
+
+// DefaultIdleTimeout is how long a client for a service account is kept after it was last asked for.
+const DefaultIdleTimeout = 10 * time.Minute
+
+// ErrServiceAccountRequired is returned when a service account to impersonate is required, but none is given.
+var ErrServiceAccountRequired = errors.New("a service account to impersonate must be given with .spec.serviceAccountName")
+
+// Impersonator gives clients and readers for service accounts. The clients read from the API server directly, rather
+// than from a cache, since a cache would be shared with identities other than the service account. Clients are reused
+// while they are in use, and dropped once they haven't been asked for within the idle timeout, so that service accounts
+// no longer named by any Pipeline don't keep a client forever. Readers read from a cache, but only what the service
+// account may read (see Reader).
+type Impersonator struct {
+	defaultClient client.Client
+	config        *rest.Config
+	scheme        *runtime.Scheme
+	mapper        meta.RESTMapper
+	required      bool
+	idleTimeout   time.Duration
+	decisionTTL   time.Duration
+
+	mu        sync.Mutex
+	clients   map[client.ObjectKey]*cachedClient
+	decisions map[accessKey]decision
+}
+
+type cachedClient struct {
+	client   client.Client
+	lastUsed time.Time
+}
+
+// Opt is an option for New.
+type Opt func(i *Impersonator)
+
+// WithIdleTimeout sets how long a client for a service account is kept after it was last asked for. It defaults to
+// DefaultIdleTimeout.
+func WithIdleTimeout(d time.Duration) Opt {
+	return func(i *Impersonator) {
+		i.idleTimeout = d
+	}
+}
+
+// WithDecisionTTL sets how long whether a service account may read an object is remembered for by readers. It defaults
+// to DefaultDecisionTTL.
+func WithDecisionTTL(d time.Duration) Opt {
+	return func(i *Impersonator) {
+		i.decisionTTL = d
+	}
+}
+
+// New returns an Impersonator that makes clients from the config given. When no service account is given, the default
+// client is used, unless `required` is true.
+func New(defaultClient client.Client, config *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper, required bool, opts ...Opt) *Impersonator {
+	i := &Impersonator{
+		defaultClient: defaultClient,
+		config:        config,
+		scheme:        scheme,
+		mapper:        mapper,
+		required:      required,
+		idleTimeout:   DefaultIdleTimeout,
+		decisionTTL:   DefaultDecisionTTL,
+		clients:       make(map[client.ObjectKey]*cachedClient),
+		decisions:     make(map[accessKey]decision),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Client returns a client that acts as the service account given, in the namespace given. If the service account name
+// is empty, it returns the default client, or ErrServiceAccountRequired if a service account is required.
+func (i *Impersonator) Client(namespace, serviceAccountName string) (client.Client, error) {
+	if serviceAccountName == "" {
+		if i.required {
+			return nil, ErrServiceAccountRequired
+		}
+		return i.defaultClient, nil
+	}
+
+	key := client.ObjectKey{Namespace: namespace, Name: serviceAccountName}
+	now := time.Now()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.evictIdle(now)
+	if c, ok := i.clients[key]; ok {
+		c.lastUsed = now
+		return c.client, nil
+	}
+
+	cfg := rest.CopyConfig(i.config)
+	cfg.Impersonate = rest.ImpersonationConfig{UserName: UserName(namespace, serviceAccountName)}
+	c, err := client.New(cfg, client.Options{Scheme: i.scheme, Mapper: i.mapper})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client impersonating service account %s: %w", key, err)
+	}
+	i.clients[key] = &cachedClient{client: c, lastUsed: now}
+	return c, nil
+}
+
+// evictIdle drops the clients that haven't been asked for within the idle timeout. It must be called with the lock held.
+func (i *Impersonator) evictIdle(now time.Time) {
+	for key, c := range i.clients {
+		if now.Sub(c.lastUsed) > i.idleTimeout {
+			delete(i.clients, key)
+		}
+	}
+}
+
+// UserName returns the name a service account authenticates as.
+func UserName(namespace, serviceAccountName string) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccountName)
+}
@@ -0,0 +1,82 @@
+package impersonation_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
+)
+
+func TestClient(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		users []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		users = append(users, r.Header.Get("Impersonate-User"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds","namespace":"tenant"}}`))
+	}))
+	defer server.Close()
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	defaultClient := fake.NewClientBuilder().Build()
+
+	newImpersonator := func(required bool, opts ...impersonation.Opt) *impersonation.Impersonator {
+		return impersonation.New(defaultClient, &rest.Config{Host: server.URL}, scheme.Scheme, mapper, required, opts...)
+	}
+
+	t.Run("uses the default client without a service account", func(t *testing.T) {
+		c, err := newImpersonator(false).Client("tenant", "")
+		require.NoError(t, err)
+		assert.Equal(t, defaultClient, c)
+	})
+
+	t.Run("requires a service account if configured to", func(t *testing.T) {
+		_, err := newImpersonator(true).Client("tenant", "")
+		assert.ErrorIs(t, err, impersonation.ErrServiceAccountRequired)
+	})
+
+	t.Run("impersonates the service account", func(t *testing.T) {
+		imp := newImpersonator(true)
+		c, err := imp.Client("tenant", "pipelines")
+		require.NoError(t, err)
+
+		var secret corev1.Secret
+		require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Namespace: "tenant", Name: "creds"}, &secret))
+		mu.Lock()
+		assert.Equal(t, []string{"system:serviceaccount:tenant:pipelines"}, users)
+		mu.Unlock()
+
+		again, err := imp.Client("tenant", "pipelines")
+		require.NoError(t, err)
+		assert.Same(t, c, again, "clients are reused")
+	})
+
+	t.Run("drops clients that are no longer used", func(t *testing.T) {
+		imp := newImpersonator(true, impersonation.WithIdleTimeout(10*time.Millisecond))
+		c, err := imp.Client("tenant", "pipelines")
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+		again, err := imp.Client("tenant", "pipelines")
+		require.NoError(t, err)
+		assert.NotSame(t, c, again, "idle clients are dropped")
+	})
+}
@@ -0,0 +1,152 @@
+package impersonation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	authzv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// DefaultDecisionTTL is how long whether a service account may read an object is remembered for.
+const DefaultDecisionTTL = time.Minute
+
+// accessKey identifies what a service account asked to do with an object, or with a list of objects if name is empty.
+type accessKey struct {
+	user      string
+	verb      string
+	resource  schema.GroupResource
+	namespace string
+	name      string
+}
+
+// decision is the answer to a SubjectAccessReview, and when it stops being used.
+type decision struct {
+	allowed bool
+	expires time.Time
+}
+
+// Reader returns a reader that reads from the reader given, e.g. the manager's cache, only what the service account
+// given, in the namespace given, is allowed to read. That is decided with a SubjectAccessReview, the answer to which is
+// remembered for the decision TTL, so that reading the same objects every time a Pipeline is reconciled costs neither
+// a request for the object nor a review each time. If the service account name is empty, it returns the reader given,
+// or ErrServiceAccountRequired if a service account is required.
+func (i *Impersonator) Reader(reader client.Reader, namespace, serviceAccountName string) (client.Reader, error) {
+	if serviceAccountName == "" {
+		if i.required {
+			return nil, ErrServiceAccountRequired
+		}
+		return reader, nil
+	}
+
+	return &authorizedReader{
+		impersonator: i,
+		reader:       reader,
+		namespace:    namespace,
+		name:         serviceAccountName,
+	}, nil
+}
+
+// authorizedReader reads from another reader what a service account is allowed to read.
+type authorizedReader struct {
+	impersonator *Impersonator
+	reader       client.Reader
+	namespace    string
+	name         string
+}
+
+var _ client.Reader = &authorizedReader{}
+
+func (r *authorizedReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := r.authorize(ctx, obj, "get", key.Namespace, key.Name); err != nil {
+		return err
+	}
+	return r.reader.Get(ctx, key, obj, opts...)
+}
+
+func (r *authorizedReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	if err := r.authorize(ctx, list, "list", listOpts.Namespace, ""); err != nil {
+		return err
+	}
+	return r.reader.List(ctx, list, opts...)
+}
+
+// authorize returns a Forbidden error if the service account may not do what's given with the object given, and nil if
+// it may.
+func (r *authorizedReader) authorize(ctx context.Context, obj runtime.Object, verb, namespace, name string) error {
+	gvk, err := apiutil.GVKForObject(obj, r.impersonator.scheme)
+	if err != nil {
+		return err
+	}
+	if verb == "list" {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	mapping, err := r.impersonator.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+
+	key := accessKey{
+		user:      UserName(r.namespace, r.name),
+		verb:      verb,
+		resource:  mapping.Resource.GroupResource(),
+		namespace: namespace,
+		name:      name,
+	}
+	allowed, err := r.impersonator.allowed(ctx, key, r.namespace)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return apierrors.NewForbidden(key.resource, name, fmt.Errorf("service account %s/%s may not %s it", r.namespace, r.name, verb))
+	}
+	return nil
+}
+
+// allowed says whether the access given is allowed to a service account in the namespace given, asking the API server
+// with a SubjectAccessReview unless there's a decision that hasn't expired.
+func (i *Impersonator) allowed(ctx context.Context, key accessKey, serviceAccountNamespace string) (bool, error) {
+	now := time.Now()
+	i.mu.Lock()
+	d, ok := i.decisions[key]
+	i.mu.Unlock()
+	if ok && now.Before(d.expires) {
+		return d.allowed, nil
+	}
+
+	review := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   key.user,
+			Groups: []string{"system:serviceaccounts", "system:serviceaccounts:" + serviceAccountNamespace, "system:authenticated"},
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace: key.namespace,
+				Verb:      key.verb,
+				Group:     key.resource.Group,
+				Resource:  key.resource.Resource,
+				Name:      key.name,
+			},
+		},
+	}
+	if err := i.defaultClient.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("failed creating SubjectAccessReview: %w", err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for k, d := range i.decisions {
+		if !now.Before(d.expires) {
+			delete(i.decisions, k)
+		}
+	}
+	i.decisions[key] = decision{allowed: review.Status.Allowed, expires: now.Add(i.decisionTTL)}
+	return review.Status.Allowed, nil
+}
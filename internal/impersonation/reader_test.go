@@ -0,0 +1,117 @@
+package impersonation_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
+)
+
+func TestReader(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		reviews []authzv1.ResourceAttributes
+	)
+	// the service account tenant/pipelines may get the Secret "creds" and list Secrets in its namespace, and nothing else.
+	defaultClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review, ok := obj.(*authzv1.SubjectAccessReview)
+			if !ok {
+				return c.Create(ctx, obj, opts...)
+			}
+			attrs := *review.Spec.ResourceAttributes
+			mu.Lock()
+			reviews = append(reviews, attrs)
+			mu.Unlock()
+			review.Status.Allowed = review.Spec.User == "system:serviceaccount:tenant:pipelines" &&
+				attrs.Resource == "secrets" && attrs.Namespace == "tenant" &&
+				(attrs.Verb == "get" && attrs.Name == "creds" || attrs.Verb == "list")
+			return nil
+		},
+	}).Build()
+
+	cached := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "tenant"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "tenant"}},
+	).Build()
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+
+	newImpersonator := func(required bool, opts ...impersonation.Opt) *impersonation.Impersonator {
+		mu.Lock()
+		reviews = nil
+		mu.Unlock()
+		return impersonation.New(defaultClient, &rest.Config{}, scheme.Scheme, mapper, required, opts...)
+	}
+	reviewCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reviews)
+	}
+
+	t.Run("reads everything without a service account", func(t *testing.T) {
+		r, err := newImpersonator(false).Reader(cached, "tenant", "")
+		require.NoError(t, err)
+		assert.Equal(t, cached, r)
+	})
+
+	t.Run("requires a service account if configured to", func(t *testing.T) {
+		_, err := newImpersonator(true).Reader(cached, "tenant", "")
+		assert.ErrorIs(t, err, impersonation.ErrServiceAccountRequired)
+	})
+
+	t.Run("reads what the service account may read", func(t *testing.T) {
+		r, err := newImpersonator(true).Reader(cached, "tenant", "pipelines")
+		require.NoError(t, err)
+
+		var secret corev1.Secret
+		require.NoError(t, r.Get(context.TODO(), client.ObjectKey{Namespace: "tenant", Name: "creds"}, &secret))
+		assert.Equal(t, "creds", secret.Name)
+
+		err = r.Get(context.TODO(), client.ObjectKey{Namespace: "tenant", Name: "other"}, &corev1.Secret{})
+		assert.True(t, apierrors.IsForbidden(err), "expected forbidden, got %v", err)
+
+		var list corev1.SecretList
+		require.NoError(t, r.List(context.TODO(), &list, client.InNamespace("tenant")))
+		assert.Len(t, list.Items, 2)
+
+		err = r.List(context.TODO(), &corev1.SecretList{}, client.InNamespace("default"))
+		assert.True(t, apierrors.IsForbidden(err), "expected forbidden, got %v", err)
+	})
+
+	t.Run("remembers decisions", func(t *testing.T) {
+		r, err := newImpersonator(true).Reader(cached, "tenant", "pipelines")
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, r.Get(context.TODO(), client.ObjectKey{Namespace: "tenant", Name: "creds"}, &corev1.Secret{}))
+		}
+		assert.Equal(t, 1, reviewCount())
+	})
+
+	t.Run("asks again once a decision expires", func(t *testing.T) {
+		r, err := newImpersonator(true, impersonation.WithDecisionTTL(10*time.Millisecond)).Reader(cached, "tenant", "pipelines")
+		require.NoError(t, err)
+
+		require.NoError(t, r.Get(context.TODO(), client.ObjectKey{Namespace: "tenant", Name: "creds"}, &corev1.Secret{}))
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, r.Get(context.TODO(), client.ObjectKey{Namespace: "tenant", Name: "creds"}, &corev1.Secret{}))
+		assert.Equal(t, 2, reviewCount())
+	})
+}
@@ -0,0 +1,99 @@
+// Package kubeauth protects HTTP handlers with the credentials of the Kubernetes cluster the controller runs in: the
+// bearer token sent with a request is authenticated with a TokenReview, and the user it belongs to must be allowed to
+// "get" the request's path as a non-resource URL, as checked with a SubjectAccessReview.
+//
+// For example, this ClusterRole allows reading the debug endpoint:
+//
+//	rules:
+//	- nonResourceURLs: ["/debug/caches"]
+//	  verbs: ["get"]
+package kubeauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Middleware returns a handler that only passes on requests from users allowed to "get" the request's path to the
+// handler given. Other requests get 401 Unauthorized if they have no valid bearer token, or 403 Forbidden.
+func Middleware(c client.Client, log logr.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := authenticate(r.Context(), c, token)
+		if err != nil {
+			log.Error(err, "failed to authenticate request", "path", r.URL.Path)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := authorize(r.Context(), c, *user, r.URL.Path)
+		if err != nil {
+			log.Error(err, "failed to authorize request", "path", r.URL.Path, "user", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the user the token given belongs to, or nil if it's not valid.
+func authenticate(ctx context.Context, c client.Client, token string) (*authnv1.UserInfo, error) {
+	review := &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return nil, fmt.Errorf("failed creating TokenReview: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, nil
+	}
+	return &review.Status.User, nil
+}
+
+// authorize returns true if the user given may "get" the non-resource URL path given.
+func authorize(ctx context.Context, c client.Client, user authnv1.UserInfo, path string) (bool, error) {
+	extra := make(map[string]authzv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	review := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authzv1.NonResourceAttributes{
+				Path: path,
+				Verb: "get",
+			},
+		},
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("failed creating SubjectAccessReview: %w", err)
+	}
+	return review.Status.Allowed, nil
+}
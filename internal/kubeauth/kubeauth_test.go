@@ -0,0 +1,84 @@
+package kubeauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/weaveworks/pipeline-controller/internal/kubeauth"
+)
+
+// fakeAPIServer answers TokenReviews for the token "valid" with the user "alice", and SubjectAccessReviews by
+// allowing alice to get "/debug/caches" only.
+func fakeAPIServer(createErr error) client.Client {
+	return fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if createErr != nil {
+				return createErr
+			}
+			switch review := obj.(type) {
+			case *authnv1.TokenReview:
+				if review.Spec.Token == "valid" {
+					review.Status.Authenticated = true
+					review.Status.User = authnv1.UserInfo{Username: "alice", Groups: []string{"devs"}}
+				}
+			case *authzv1.SubjectAccessReview:
+				attrs := review.Spec.NonResourceAttributes
+				review.Status.Allowed = review.Spec.User == "alice" && attrs != nil &&
+					attrs.Path == "/debug/caches" && attrs.Verb == "get"
+			}
+			return nil
+		},
+	}).Build()
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		header    string
+		createErr error
+		want      int
+	}{
+		{name: "no token", path: "/debug/caches", want: http.StatusUnauthorized},
+		{name: "not a bearer token", path: "/debug/caches", header: "Basic dmFsaWQ=", want: http.StatusUnauthorized},
+		{name: "invalid token", path: "/debug/caches", header: "Bearer invalid", want: http.StatusUnauthorized},
+		{name: "not allowed", path: "/debug/other", header: "Bearer valid", want: http.StatusForbidden},
+		{name: "allowed", path: "/debug/caches", header: "Bearer valid", want: http.StatusOK},
+		{
+			name:      "review fails",
+			path:      "/debug/caches",
+			header:    "Bearer valid",
+			createErr: errors.New("boom"),
+			want:      http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := kubeauth.Middleware(fakeAPIServer(tt.createErr), logr.Discard(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
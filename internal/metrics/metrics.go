@@ -0,0 +1,126 @@
+// Package metrics defines the Prometheus metrics of the controller and the promotion server, and registers them on
+// controller-runtime's registry, so that they are served from the manager's metrics endpoint.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+const namespace = "pipeline_controller"
+
+var (
+	promotionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "promotions_total",
+		Help:      "Number of promotions run, by strategy, target environment and outcome.",
+	}, []string{"strategy", "environment", "outcome"})
+
+	promotionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "promotion_duration_seconds",
+		Help:      "How long running the promotion strategy took, by strategy, target environment and outcome.",
+		// promotions range from sending a notification to cloning a repository and opening a pull request.
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"strategy", "environment", "outcome"})
+
+	webhookRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_requests_total",
+		Help:      "Number of requests to the promotion server's webhooks, by webhook and HTTP status code.",
+	}, []string{"handler", "code"})
+
+	webhookRateLimitedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_rate_limited_total",
+		Help:      "Number of requests to the promotion server's webhooks rejected by the rate limiter.",
+	})
+
+	readyTargets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ready_targets",
+		Help:      "Number of ready targets in each environment of a pipeline.",
+	}, []string{"namespace", "name", "environment"})
+
+	totalTargets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "targets",
+		Help:      "Number of targets in each environment of a pipeline.",
+	}, []string{"namespace", "name", "environment"})
+
+	targetCaches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "target_caches",
+		Help:      "Number of caches running to watch targets, one for each cluster and type of target.",
+	})
+
+	targetCacheGCRemovalsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "target_cache_gc_removals_total",
+		Help:      "Number of target caches removed by garbage collection because no pipeline uses them.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		promotionsTotal,
+		promotionDuration,
+		webhookRequestsTotal,
+		webhookRateLimitedTotal,
+		readyTargets,
+		totalTargets,
+		targetCaches,
+		targetCacheGCRemovalsTotal,
+	)
+}
+
+// RecordPromotion counts the completed promotion given, and observes how long it took.
+func RecordPromotion(record v1alpha1.PromotionRecord) {
+	labels := prometheus.Labels{
+		"strategy":    record.Strategy,
+		"environment": record.TargetEnvironment,
+		"outcome":     string(record.Outcome),
+	}
+	promotionsTotal.With(labels).Inc()
+	promotionDuration.With(labels).Observe(record.CompletedAt.Sub(record.StartedAt.Time).Seconds())
+}
+
+// InstrumentWebhook wraps the webhook handler given so that its responses are counted by status code.
+func InstrumentWebhook(handler string, h http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerCounter(webhookRequestsTotal.MustCurryWith(prometheus.Labels{"handler": handler}), h)
+}
+
+// RecordRateLimited counts a webhook request rejected by the rate limiter.
+func RecordRateLimited() {
+	webhookRateLimitedTotal.Inc()
+}
+
+// SetTargets records how many of the targets of a pipeline's environment are ready.
+func SetTargets(namespace, name, env string, ready, total int32) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name, "environment": env}
+	readyTargets.With(labels).Set(float64(ready))
+	totalTargets.With(labels).Set(float64(total))
+}
+
+// DeletePipeline removes the per-environment metrics of a pipeline, e.g. when it's deleted, or before setting them again
+// so that those of environments that no longer exist go away.
+func DeletePipeline(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	readyTargets.DeletePartialMatch(labels)
+	totalTargets.DeletePartialMatch(labels)
+}
+
+// SetTargetCaches records the number of target caches running.
+func SetTargetCaches(n int) {
+	targetCaches.Set(float64(n))
+}
+
+// RecordTargetCacheGCRemoval counts a target cache removed by garbage collection.
+func RecordTargetCacheGCRemoval() {
+	targetCacheGCRemovalsTotal.Inc()
+}
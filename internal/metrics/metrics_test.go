@@ -0,0 +1,78 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/metrics"
+)
+
+func TestRecordPromotion(t *testing.T) {
+	started := time.Date(2023, 11, 6, 8, 0, 0, 0, time.UTC)
+	metrics.RecordPromotion(v1alpha1.PromotionRecord{
+		TargetEnvironment: "prod",
+		Strategy:          "pull-request",
+		Outcome:           v1alpha1.PromotionSucceeded,
+		StartedAt:         metav1.NewTime(started),
+		CompletedAt:       metav1.NewTime(started.Add(3 * time.Second)),
+	})
+
+	expected := `
+# HELP pipeline_controller_promotions_total Number of promotions run, by strategy, target environment and outcome.
+# TYPE pipeline_controller_promotions_total counter
+pipeline_controller_promotions_total{environment="prod",outcome="Succeeded",strategy="pull-request"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), "pipeline_controller_promotions_total"))
+
+	count, err := testutil.GatherAndCount(crmetrics.Registry, "pipeline_controller_promotion_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestInstrumentWebhook(t *testing.T) {
+	h := metrics.InstrumentWebhook("promotion", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/promotion/default/podinfo/dev", nil))
+
+	expected := `
+# HELP pipeline_controller_webhook_requests_total Number of requests to the promotion server's webhooks, by webhook and HTTP status code.
+# TYPE pipeline_controller_webhook_requests_total counter
+pipeline_controller_webhook_requests_total{code="429",handler="promotion"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), "pipeline_controller_webhook_requests_total"))
+}
+
+func TestSetTargets(t *testing.T) {
+	metrics.SetTargets("default", "podinfo", "dev", 1, 2)
+	metrics.SetTargets("default", "podinfo", "prod", 0, 1)
+	metrics.SetTargets("default", "other", "dev", 1, 1)
+
+	expected := `
+# HELP pipeline_controller_ready_targets Number of ready targets in each environment of a pipeline.
+# TYPE pipeline_controller_ready_targets gauge
+pipeline_controller_ready_targets{environment="dev",name="other",namespace="default"} 1
+pipeline_controller_ready_targets{environment="dev",name="podinfo",namespace="default"} 1
+pipeline_controller_ready_targets{environment="prod",name="podinfo",namespace="default"} 0
+`
+	assert.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), "pipeline_controller_ready_targets"))
+
+	metrics.DeletePipeline("default", "podinfo")
+
+	expected = `
+# HELP pipeline_controller_targets Number of targets in each environment of a pipeline.
+# TYPE pipeline_controller_targets gauge
+pipeline_controller_targets{environment="dev",name="other",namespace="default"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(crmetrics.Registry, strings.NewReader(expected), "pipeline_controller_targets"))
+}
@@ -0,0 +1,101 @@
+// Package sharding splits Pipelines between several controller deployments, so that each reconciles, and holds caches
+// for, only its own share of them.
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Shard selects the Pipelines a controller is responsible for. The zero value selects all Pipelines.
+type Shard struct {
+	// Selector, if not nil, selects the Pipelines in the shard by their labels.
+	Selector labels.Selector
+	// Index and Count, if Count is more than one, select the Pipelines whose namespace and name hash to Index, modulo
+	// Count.
+	Index, Count int
+}
+
+// New returns the shard given by a label selector and a shard key of the form `<index>/<count>`, either of which can
+// be empty.
+func New(selector, key string) (Shard, error) {
+	var shard Shard
+	if selector != "" {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return Shard{}, fmt.Errorf("invalid shard selector: %w", err)
+		}
+		shard.Selector = sel
+	}
+	if key != "" {
+		index, count, ok := strings.Cut(key, "/")
+		if !ok {
+			return Shard{}, fmt.Errorf("invalid shard key %q: expected <index>/<count>", key)
+		}
+		var err error
+		if shard.Index, err = strconv.Atoi(index); err != nil {
+			return Shard{}, fmt.Errorf("invalid shard key %q: %w", key, err)
+		}
+		if shard.Count, err = strconv.Atoi(count); err != nil {
+			return Shard{}, fmt.Errorf("invalid shard key %q: %w", key, err)
+		}
+		if shard.Count < 1 || shard.Index < 0 || shard.Index >= shard.Count {
+			return Shard{}, fmt.Errorf("invalid shard key %q: the index must be at least 0 and less than the count", key)
+		}
+	}
+	return shard, nil
+}
+
+// IsSharded says whether the shard leaves out any Pipelines.
+func (s Shard) IsSharded() bool {
+	return (s.Selector != nil && !s.Selector.Empty()) || s.Count > 1
+}
+
+// Contains says whether the Pipeline given is in the shard.
+func (s Shard) Contains(obj client.Object) bool {
+	if s.Selector != nil && !s.Selector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	if s.Count > 1 {
+		return int(hash(obj.GetNamespace()+"/"+obj.GetName())%uint32(s.Count)) == s.Index
+	}
+	return true
+}
+
+// ID returns a short identifier for the shard, which can be used in object names, e.g. to give each shard its own
+// leader election lease. It's empty if the shard contains all Pipelines.
+func (s Shard) ID() string {
+	if !s.IsSharded() {
+		return ""
+	}
+	var selector string
+	if s.Selector != nil {
+		selector = s.Selector.String()
+	}
+	return fmt.Sprintf("%08x", hash(fmt.Sprintf("%s|%d/%d", selector, s.Index, s.Count)))
+}
+
+func (s Shard) String() string {
+	var parts []string
+	if s.Selector != nil && !s.Selector.Empty() {
+		parts = append(parts, "selector "+s.Selector.String())
+	}
+	if s.Count > 1 {
+		parts = append(parts, fmt.Sprintf("key %d/%d", s.Index, s.Count))
+	}
+	if len(parts) == 0 {
+		return "all pipelines"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
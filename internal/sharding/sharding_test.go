@@ -0,0 +1,92 @@
+package sharding_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/sharding"
+)
+
+func pipeline(name string, labels map[string]string) *v1alpha1.Pipeline {
+	return &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pipelines", Labels: labels},
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		key      string
+		wantErr  string
+		sharded  bool
+	}{
+		{name: "no sharding"},
+		{name: "selector", selector: "shard=a", sharded: true},
+		{name: "key", key: "1/3", sharded: true},
+		{name: "single shard", key: "0/1"},
+		{name: "invalid selector", selector: "shard==,", wantErr: "invalid shard selector"},
+		{name: "key without count", key: "1", wantErr: "expected <index>/<count>"},
+		{name: "key not a number", key: "a/3", wantErr: "invalid shard key"},
+		{name: "index out of range", key: "3/3", wantErr: "less than the count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shard, err := sharding.New(tt.selector, tt.key)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.sharded, shard.IsSharded())
+			assert.Equal(t, tt.sharded, shard.ID() != "")
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	t.Run("selector", func(t *testing.T) {
+		shard, err := sharding.New("shard=a", "")
+		require.NoError(t, err)
+		assert.True(t, shard.Contains(pipeline("app", map[string]string{"shard": "a"})))
+		assert.False(t, shard.Contains(pipeline("app", map[string]string{"shard": "b"})))
+		assert.False(t, shard.Contains(pipeline("app", nil)))
+	})
+
+	t.Run("key", func(t *testing.T) {
+		const count = 3
+		shards := make([]sharding.Shard, count)
+		for i := range shards {
+			var err error
+			shards[i], err = sharding.New("", fmt.Sprintf("%d/%d", i, count))
+			require.NoError(t, err)
+		}
+
+		// each pipeline is in exactly one shard.
+		perShard := make([]int, count)
+		for i := 0; i < 100; i++ {
+			p := pipeline(fmt.Sprintf("app-%d", i), nil)
+			var in int
+			for j, shard := range shards {
+				if shard.Contains(p) {
+					in++
+					perShard[j]++
+				}
+			}
+			assert.Equal(t, 1, in, p.Name)
+		}
+		for j, n := range perShard {
+			assert.NotZero(t, n, "shard %d has no pipelines", j)
+		}
+	})
+
+	t.Run("no sharding", func(t *testing.T) {
+		assert.True(t, sharding.Shard{}.Contains(pipeline("app", nil)))
+	})
+}
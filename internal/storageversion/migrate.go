@@ -0,0 +1,137 @@
+// Package storageversion rewrites the stored objects of a custom resource in the CRD's current storage version. Once
+// that's done, the other versions can be dropped from the CRD's `.status.storedVersions`, and later from the CRD itself.
+//
+// This does the same as the Kubernetes storage version migrator, for clusters where that is not installed.
+package storageversion
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update
+
+// listPageSize is how many objects are fetched at a time while migrating.
+const listPageSize = 100
+
+// Migrator migrates the objects of a single custom resource to the storage version of its CRD. It is meant to be added
+// to a manager, so that it runs once when the manager is elected leader.
+type Migrator struct {
+	client  client.Client
+	crdName string
+	log     logr.Logger
+}
+
+// NewMigrator returns a Migrator for the CRD with the name given, e.g. "pipelines.pipelines.weave.works". The client
+// should not be backed by a cache, since the migration reads every object once and doesn't need to watch them.
+func NewMigrator(c client.Client, crdName string, log logr.Logger) *Migrator {
+	return &Migrator{
+		client:  c,
+		crdName: crdName,
+		log:     log,
+	}
+}
+
+// Start implements manager.Runnable. A failed migration is logged rather than returned, so that it doesn't stop the
+// manager; it is tried again the next time the manager starts.
+func (m *Migrator) Start(ctx context.Context) error {
+	if err := m.Migrate(ctx); err != nil {
+		m.log.Error(err, "failed to migrate to the storage version", "crd", m.crdName)
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that only one replica migrates at a time.
+func (m *Migrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Migrate rewrites each object of the custom resource, so that it is stored in the CRD's storage version, then records
+// in the CRD's status that only the storage version is stored.
+func (m *Migrator) Migrate(ctx context.Context) error {
+	var crd apiextensionsv1.CustomResourceDefinition
+	if err := m.client.Get(ctx, client.ObjectKey{Name: m.crdName}, &crd); err != nil {
+		return fmt.Errorf("failed to get CRD: %w", err)
+	}
+
+	storageVersion := ""
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			storageVersion = v.Name
+		}
+	}
+	if storageVersion == "" {
+		return fmt.Errorf("CRD %s has no storage version", m.crdName)
+	}
+
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		m.log.V(1).Info("nothing to migrate", "crd", m.crdName, "version", storageVersion)
+		return nil
+	}
+
+	gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: storageVersion, Kind: crd.Spec.Names.ListKind}
+	count, err := m.rewriteAll(ctx, gvk)
+	if err != nil {
+		return err
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := m.client.Get(ctx, client.ObjectKey{Name: m.crdName}, &crd); err != nil {
+			return err
+		}
+		crd.Status.StoredVersions = []string{storageVersion}
+		return m.client.Status().Update(ctx, &crd)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the stored versions of CRD: %w", err)
+	}
+
+	m.log.Info("migrated to the storage version", "crd", m.crdName, "version", storageVersion, "objects", count)
+	return nil
+}
+
+// rewriteAll updates each object of the list kind given without changing it, which makes the API server store it again
+// in the current storage version. It returns the number of objects rewritten.
+func (m *Migrator) rewriteAll(ctx context.Context, listGVK schema.GroupVersionKind) (int, error) {
+	var (
+		count int
+		errs  []error
+	)
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(listGVK)
+	for {
+		if err := m.client.List(ctx, list, client.Limit(listPageSize), client.Continue(list.GetContinue())); err != nil {
+			return count, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			err := m.client.Update(ctx, obj)
+			switch {
+			case err == nil:
+				count++
+			// the object has been written since it was listed, or deleted, either of which leaves nothing to migrate.
+			case apierrors.IsConflict(err), apierrors.IsNotFound(err):
+			default:
+				errs = append(errs, fmt.Errorf("failed to rewrite %s/%s: %w", obj.GetNamespace(), obj.GetName(), err))
+			}
+		}
+
+		if list.GetContinue() == "" {
+			break
+		}
+	}
+
+	return count, kerrors.NewAggregate(errs)
+}
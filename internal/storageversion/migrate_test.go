@@ -0,0 +1,97 @@
+package storageversion_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/storageversion"
+)
+
+const crdName = "pipelines.pipelines.weave.works"
+
+func pipelineCRD(storedVersions ...string) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: crdName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: v1alpha1.GroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "Pipeline", ListKind: "PipelineList", Plural: "pipelines"},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true, Storage: true},
+				{Name: "v1beta1", Served: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: storedVersions},
+	}
+}
+
+func newClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&apiextensionsv1.CustomResourceDefinition{}).
+		Build()
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	pipelines := []*v1alpha1.Pipeline{
+		{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "other"}},
+	}
+
+	t.Run("rewrites objects and records the storage version", func(t *testing.T) {
+		c := newClient(t, pipelineCRD("v1beta1", "v1alpha1"), pipelines[0], pipelines[1])
+
+		before := map[string]string{}
+		for _, p := range pipelines {
+			var got v1alpha1.Pipeline
+			require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(p), &got))
+			before[got.Namespace] = got.ResourceVersion
+		}
+
+		require.NoError(t, storageversion.NewMigrator(c, crdName, logr.Discard()).Migrate(ctx))
+
+		for _, p := range pipelines {
+			var got v1alpha1.Pipeline
+			require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(p), &got))
+			assert.NotEqual(t, before[got.Namespace], got.ResourceVersion, "expected %s/%s to be rewritten", got.Namespace, got.Name)
+		}
+
+		var crd apiextensionsv1.CustomResourceDefinition
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Name: crdName}, &crd))
+		assert.Equal(t, []string{"v1alpha1"}, crd.Status.StoredVersions)
+	})
+
+	t.Run("does nothing if only the storage version is stored", func(t *testing.T) {
+		c := newClient(t, pipelineCRD("v1alpha1"), pipelines[0])
+
+		var before v1alpha1.Pipeline
+		require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pipelines[0]), &before))
+
+		require.NoError(t, storageversion.NewMigrator(c, crdName, logr.Discard()).Migrate(ctx))
+
+		var after v1alpha1.Pipeline
+		require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pipelines[0]), &after))
+		assert.Equal(t, before.ResourceVersion, after.ResourceVersion)
+	})
+
+	t.Run("fails if the CRD is missing", func(t *testing.T) {
+		c := newClient(t)
+		assert.ErrorContains(t, storageversion.NewMigrator(c, crdName, logr.Discard()).Migrate(ctx), "failed to get CRD")
+	})
+}
@@ -0,0 +1,117 @@
+// Package tracing sets up OpenTelemetry tracing for the controller and the promotion server, and has helpers for
+// starting and ending spans around the stages of a promotion.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone doesn't export spans. Trace context is still propagated, so that traces started by callers of the
+	// promotion webhook aren't broken.
+	ExporterNone = "none"
+	// ExporterStdout writes spans to stdout, which is meant for local testing.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over OTLP/gRPC.
+	ExporterOTLP = "otlp"
+
+	serviceName = "pipeline-controller"
+	tracerName  = "github.com/weaveworks/pipeline-controller"
+)
+
+// Exporters lists the exporters Setup accepts.
+var Exporters = []string{ExporterNone, ExporterStdout, ExporterOTLP}
+
+// Options configures the exporter set up by Setup.
+type Options struct {
+	// Exporter is one of Exporters.
+	Exporter string
+	// OTLPEndpoint is the host:port of the collector spans are sent to with ExporterOTLP. When empty, the endpoint is
+	// taken from the standard OTEL_EXPORTER_OTLP_* environment variables.
+	OTLPEndpoint string
+	// OTLPInsecure disables TLS for the connection to the collector.
+	OTLPInsecure bool
+}
+
+// Setup installs the global tracer provider and propagator according to the options given. The function returned
+// flushes any spans not yet exported and shuts the exporter down; it should be called before the program exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var otlpOpts []otlptracegrpc.Option
+		if opts.OTLPEndpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracegrpc.WithEndpoint(opts.OTLPEndpoint))
+		}
+		if opts.OTLPInsecure {
+			otlpOpts = append(otlpOpts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, otlpOpts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, must be one of %v", opts.Exporter, Exporters)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed creating %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span with the name and attributes given, as a child of any span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span given, recording err on it if it's not nil. It returns err so that it can be used in return
+// statements.
+func End(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	return err
+}
+
+// PromotionAttributes returns the attributes identifying the promotion of a revision to a pipeline's environment.
+func PromotionAttributes(namespace, name, env, revision string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("pipeline.namespace", namespace),
+		attribute.String("pipeline.name", name),
+		attribute.String("pipeline.environment", env),
+		attribute.String("pipeline.revision", revision),
+	}
+}
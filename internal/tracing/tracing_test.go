@@ -0,0 +1,56 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/weaveworks/pipeline-controller/internal/tracing"
+)
+
+func TestSetup(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	for _, exporter := range []string{"", tracing.ExporterNone, tracing.ExporterStdout} {
+		shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: exporter})
+		require.NoError(t, err, "exporter %q", exporter)
+		assert.NoError(t, shutdown(context.Background()), "exporter %q", exporter)
+	}
+
+	_, err := tracing.Setup(context.Background(), tracing.Options{Exporter: "jaeger"})
+	assert.ErrorContains(t, err, `unknown tracing exporter "jaeger"`)
+}
+
+func TestStartEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, parent := tracing.Start(context.Background(), "parent", tracing.PromotionAttributes("default", "podinfo", "prod", "v1.0.1")...)
+	_, child := tracing.Start(ctx, "child", attribute.Int("retry.attempt", 1))
+	failure := errors.New("push rejected")
+	assert.Equal(t, failure, tracing.End(child, failure))
+	assert.NoError(t, tracing.End(parent, nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "child", spans[0].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "push rejected", spans[0].Status().Description)
+
+	assert.Equal(t, "parent", spans[1].Name())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+	assert.Contains(t, spans[1].Attributes(), attribute.String("pipeline.environment", "prod"))
+}
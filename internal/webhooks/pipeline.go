@@ -0,0 +1,234 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/git"
+	"github.com/weaveworks/pipeline-controller/pkg/freeze"
+	"github.com/weaveworks/pipeline-controller/pkg/targetstatus"
+)
+
+//+kubebuilder:webhook:path=/validate-pipelines-weave-works-v1alpha1-pipeline,mutating=false,failurePolicy=fail,sideEffects=None,groups=pipelines.weave.works,resources=pipelines,verbs=create;update,versions=v1alpha1,name=vpipeline.pipelines.weave.works,admissionReviewVersions=v1
+
+// PipelineValidator rejects Pipeline objects that can't be reconciled or promoted, so that mistakes are reported when
+// the object is applied rather than when it is acted upon.
+type PipelineValidator struct {
+	// LevelTriggered says whether Pipelines are reconciled by the level-triggered controller. If not, what only the
+	// level-triggered controller supports is rejected, since the default controller would ignore it.
+	LevelTriggered bool
+}
+
+var _ admission.CustomValidator = &PipelineValidator{}
+
+// SetupWithManager registers the validator with the manager's webhook server. Since Pipeline has more than one version,
+// this also registers the conversion webhook, provided all the versions are in the manager's scheme.
+func (v *PipelineValidator) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.Pipeline{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *PipelineValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator. Updates that leave the spec as it was, e.g. removing a finalizer
+// or rewriting the object in another version, and updates to a Pipeline being deleted are let through, so that a
+// Pipeline created before the webhook or its current rules can still be deleted and migrated.
+func (v *PipelineValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldPipeline, ok := oldObj.(*v1alpha1.Pipeline)
+	if !ok {
+		return nil, fmt.Errorf("expected a Pipeline but got %T", oldObj)
+	}
+	newPipeline, ok := newObj.(*v1alpha1.Pipeline)
+	if !ok {
+		return nil, fmt.Errorf("expected a Pipeline but got %T", newObj)
+	}
+
+	if !newPipeline.DeletionTimestamp.IsZero() || apiequality.Semantic.DeepEqual(oldPipeline.Spec, newPipeline.Spec) {
+		return nil, nil
+	}
+
+	return nil, v.validate(newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *PipelineValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *PipelineValidator) validate(obj runtime.Object) error {
+	pipeline, ok := obj.(*v1alpha1.Pipeline)
+	if !ok {
+		return fmt.Errorf("expected a Pipeline but got %T", obj)
+	}
+
+	errs := ValidatePipelineSpec(pipeline.Spec, field.NewPath("spec"))
+	if !v.LevelTriggered {
+		errs = append(errs, validateForDefaultController(pipeline.Spec, field.NewPath("spec"))...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(v1alpha1.GroupVersion.WithKind(v1alpha1.PipelineKind).GroupKind(), pipeline.Name, errs)
+}
+
+// ValidatePipelineSpec returns the problems with the pipeline spec given.
+func ValidatePipelineSpec(spec v1alpha1.PipelineSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	errs = append(errs, validateAPIVersion(spec.AppRef.APIVersion, path.Child("appRef", "apiVersion"))...)
+
+	if spec.Promotion != nil {
+		errs = append(errs, validatePromotion(*spec.Promotion, path.Child("promotion"))...)
+	}
+
+	for i, rule := range spec.TargetStatusRules {
+		rulePath := path.Child("targetStatusRules").Index(i)
+		errs = append(errs, validateAPIVersion(rule.APIVersion, rulePath.Child("apiVersion"))...)
+		if _, err := targetstatus.FromRule(rule); err != nil {
+			errs = append(errs, field.Invalid(rulePath, rule, err.Error()))
+		}
+	}
+
+	envsPath := path.Child("environments")
+	if len(spec.Environments) == 0 {
+		return append(errs, field.Required(envsPath, "a pipeline must have at least one environment"))
+	}
+
+	names := map[string]bool{}
+	for i, env := range spec.Environments {
+		envPath := envsPath.Index(i)
+
+		if names[env.Name] {
+			errs = append(errs, field.Duplicate(envPath.Child("name"), env.Name))
+		}
+		names[env.Name] = true
+
+		if len(env.Targets) == 0 {
+			errs = append(errs, field.Required(envPath.Child("targets"), "an environment must have at least one target"))
+		}
+		for j, target := range env.Targets {
+			if target.AppRef != nil && target.AppRef.APIVersion != "" {
+				errs = append(errs, validateAPIVersion(target.AppRef.APIVersion, envPath.Child("targets").Index(j).Child("appRef", "apiVersion"))...)
+			}
+		}
+
+		if env.Promotion != nil {
+			errs = append(errs, validatePromotion(*env.Promotion, envPath.Child("promotion"))...)
+		}
+
+		errs = append(errs, validateFreezeWindows(env.FreezeWindows, envPath.Child("freezeWindows"))...)
+	}
+
+	// duplicate names are already reported above, and would be reported again here.
+	if len(errs) == 0 {
+		if err := spec.ValidateDependencies(); err != nil {
+			errs = append(errs, field.Invalid(envsPath, "", err.Error()))
+		}
+	}
+
+	return errs
+}
+
+// validateForDefaultController returns the parts of the pipeline spec given that only the level-triggered controller
+// supports.
+func validateForDefaultController(spec v1alpha1.PipelineSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	// the default controller reads everything with its own identity, so a service account would give no isolation.
+	if spec.ServiceAccountName != "" {
+		errs = append(errs, field.Forbidden(path.Child("serviceAccountName"), "a service account is only supported when the level-triggered controller is enabled"))
+	}
+
+	for i, env := range spec.Environments {
+		for j, target := range env.Targets {
+			if target.ClusterRef != nil && target.ClusterRef.Kind != v1alpha1.GitopsClusterKind {
+				errs = append(errs, field.Invalid(path.Child("environments").Index(i).Child("targets").Index(j).Child("clusterRef", "kind"), target.ClusterRef.Kind,
+					fmt.Sprintf("only %s is supported unless the level-triggered controller is enabled", v1alpha1.GitopsClusterKind)))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validatePromotion(promotion v1alpha1.Promotion, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	strategyPath := path.Child("strategy")
+	var selected []string
+	if promotion.Strategy.PullRequest != nil {
+		selected = append(selected, "pull-request")
+		errs = append(errs, validatePullRequest(*promotion.Strategy.PullRequest, strategyPath.Child("pull-request"))...)
+	}
+	if promotion.Strategy.Notification != nil {
+		selected = append(selected, "notification")
+	}
+	switch len(selected) {
+	case 0:
+		errs = append(errs, field.Required(strategyPath, "exactly one promotion strategy must be given"))
+	case 1:
+	default:
+		errs = append(errs, field.Invalid(strategyPath, selected, "only one promotion strategy may be given"))
+	}
+
+	if promotion.Rollback != nil && promotion.Rollback.Timeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("rollback", "timeout"), promotion.Rollback.Timeout.Duration.String(), "must be positive"))
+	}
+
+	errs = append(errs, validateFreezeWindows(promotion.FreezeWindows, path.Child("freezeWindows"))...)
+
+	return errs
+}
+
+func validatePullRequest(pr v1alpha1.PullRequestPromotion, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	switch pr.Type {
+	case v1alpha1.Github, v1alpha1.Gitlab, v1alpha1.BitBucketServer, v1alpha1.AzureDevOps:
+		if err := git.ValidateRepositoryURL(pr.Type.String(), pr.URL); err != nil {
+			errs = append(errs, field.Invalid(path.Child("url"), pr.URL, fmt.Sprintf("not a valid %s repository URL: %s", pr.Type, err)))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("type"), pr.Type.String(),
+			[]string{v1alpha1.Github.String(), v1alpha1.Gitlab.String(), v1alpha1.BitBucketServer.String(), v1alpha1.AzureDevOps.String()}))
+	}
+
+	return errs
+}
+
+func validateFreezeWindows(windows []v1alpha1.FreezeWindow, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, window := range windows {
+		if err := freeze.Validate(window); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i), window, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func validateAPIVersion(apiVersion string, path *field.Path) field.ErrorList {
+	if apiVersion == "" {
+		return field.ErrorList{field.Required(path, "")}
+	}
+	if _, err := schema.ParseGroupVersion(apiVersion); err != nil {
+		return field.ErrorList{field.Invalid(path, apiVersion, err.Error())}
+	}
+
+	return nil
+}
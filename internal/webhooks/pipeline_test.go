@@ -0,0 +1,250 @@
+package webhooks_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/webhooks"
+)
+
+func validPipeline() *v1alpha1.Pipeline {
+	return &v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "podinfo",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.PipelineSpec{
+			AppRef: v1alpha1.LocalAppReference{
+				APIVersion: "helm.toolkit.fluxcd.io/v2beta1",
+				Kind:       "HelmRelease",
+				Name:       "podinfo",
+			},
+			Environments: []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: []v1alpha1.Target{{Namespace: "dev"}},
+				},
+				{
+					Name:    "prod",
+					Targets: []v1alpha1.Target{{Namespace: "prod"}},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					PullRequest: &v1alpha1.PullRequestPromotion{
+						Type: v1alpha1.Github,
+						URL:  "https://github.com/example/podinfo",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	invalid := func() *v1alpha1.Pipeline {
+		p := validPipeline()
+		p.Spec.Environments[1].FreezeWindows = []v1alpha1.FreezeWindow{{Schedule: "whenever"}}
+		return p
+	}
+
+	validator := &webhooks.PipelineValidator{}
+
+	t.Run("lets through changes other than to the spec", func(t *testing.T) {
+		old := invalid()
+		old.Finalizers = []string{v1alpha1.CleanupFinalizer}
+		_, err := validator.ValidateUpdate(context.Background(), old, invalid())
+		assert.NoError(t, err)
+	})
+
+	t.Run("lets through changes to a pipeline being deleted", func(t *testing.T) {
+		p := invalid()
+		p.Spec.Suspend = true
+		now := metav1.Now()
+		p.DeletionTimestamp = &now
+		_, err := validator.ValidateUpdate(context.Background(), invalid(), p)
+		assert.NoError(t, err)
+	})
+
+	t.Run("validates changes to the spec", func(t *testing.T) {
+		p := invalid()
+		p.Spec.Suspend = true
+		_, err := validator.ValidateUpdate(context.Background(), invalid(), p)
+		assert.ErrorContains(t, err, "spec.environments[1].freezeWindows[0]: Invalid value")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(p *v1alpha1.Pipeline)
+		wantErr []string
+	}{
+		{
+			name:   "valid",
+			mutate: func(p *v1alpha1.Pipeline) {},
+		},
+		{
+			name:    "no environments",
+			mutate:  func(p *v1alpha1.Pipeline) { p.Spec.Environments = nil },
+			wantErr: []string{"spec.environments: Required value"},
+		},
+		{
+			name:    "duplicate environment names",
+			mutate:  func(p *v1alpha1.Pipeline) { p.Spec.Environments[1].Name = "dev" },
+			wantErr: []string{`spec.environments[1].name: Duplicate value: "dev"`},
+		},
+		{
+			name:    "environment without targets",
+			mutate:  func(p *v1alpha1.Pipeline) { p.Spec.Environments[1].Targets = nil },
+			wantErr: []string{"spec.environments[1].targets: Required value"},
+		},
+		{
+			name:    "dependency cycle",
+			mutate:  func(p *v1alpha1.Pipeline) { p.Spec.Environments[0].DependsOn = []string{"prod"} },
+			wantErr: []string{"environments form a dependency cycle"},
+		},
+		{
+			name: "more than one strategy",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Promotion.Strategy.Notification = &v1alpha1.NotificationPromotion{}
+			},
+			wantErr: []string{"spec.promotion.strategy: Invalid value", "only one promotion strategy may be given"},
+		},
+		{
+			name: "no strategy in an environment's promotion",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Environments[1].Promotion = &v1alpha1.Promotion{Manual: true}
+			},
+			wantErr: []string{"spec.environments[1].promotion.strategy: Required value"},
+		},
+		{
+			name:    "unparseable app apiVersion",
+			mutate:  func(p *v1alpha1.Pipeline) { p.Spec.AppRef.APIVersion = "helm.toolkit.fluxcd.io/v2beta1/HelmRelease" },
+			wantErr: []string{"spec.appRef.apiVersion: Invalid value"},
+		},
+		{
+			name: "unparseable target app apiVersion",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Environments[0].Targets[0].AppRef = &v1alpha1.TargetAppReference{APIVersion: "a/b/c"}
+			},
+			wantErr: []string{"spec.environments[0].targets[0].appRef.apiVersion: Invalid value"},
+		},
+		{
+			name: "invalid GitHub URL",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Promotion.Strategy.PullRequest.URL = "ssh://git@github.com/example/podinfo"
+			},
+			wantErr: []string{"spec.promotion.strategy.pull-request.url: Invalid value", "not a valid github repository URL"},
+		},
+		{
+			name: "valid Bitbucket Server URL",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Promotion.Strategy.PullRequest.Type = v1alpha1.BitBucketServer
+				p.Spec.Promotion.Strategy.PullRequest.URL = "https://bitbucket.example.com/scm/example/podinfo.git"
+			},
+		},
+		{
+			name: "invalid Bitbucket Server URL",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Promotion.Strategy.PullRequest.Type = v1alpha1.BitBucketServer
+				p.Spec.Promotion.Strategy.PullRequest.URL = "https://bitbucket.example.com/podinfo"
+			},
+			wantErr: []string{"not a valid bitbucket-server repository URL"},
+		},
+		{
+			name: "valid Azure DevOps URL",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Promotion.Strategy.PullRequest.Type = v1alpha1.AzureDevOps
+				p.Spec.Promotion.Strategy.PullRequest.URL = "https://dev.azure.com/example/project/_git/podinfo"
+			},
+		},
+		{
+			name: "invalid Azure DevOps URL",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Promotion.Strategy.PullRequest.Type = v1alpha1.AzureDevOps
+				p.Spec.Promotion.Strategy.PullRequest.URL = "https://github.com/example/podinfo"
+			},
+			wantErr: []string{"not a valid azure-devops repository URL"},
+		},
+		{
+			name:    "unsupported provider",
+			mutate:  func(p *v1alpha1.Pipeline) { p.Spec.Promotion.Strategy.PullRequest.Type = "subversion" },
+			wantErr: []string{`spec.promotion.strategy.pull-request.type: Unsupported value: "subversion"`},
+		},
+		{
+			name: "invalid freeze window",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Environments[1].FreezeWindows = []v1alpha1.FreezeWindow{{Schedule: "whenever"}}
+			},
+			wantErr: []string{"spec.environments[1].freezeWindows[0]: Invalid value"},
+		},
+		{
+			name: "freeze window overlapping itself",
+			mutate: func(p *v1alpha1.Pipeline) {
+				p.Spec.Environments[1].FreezeWindows = []v1alpha1.FreezeWindow{{Schedule: "* * * * *", Duration: metav1.Duration{Duration: 24 * time.Hour}}}
+			},
+			wantErr: []string{"spec.environments[1].freezeWindows[0]: Invalid value", "longer than the 1m0s interval"},
+		},
+	}
+
+	validator := &webhooks.PipelineValidator{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validPipeline()
+			tt.mutate(p)
+
+			_, createErr := validator.ValidateCreate(context.Background(), p)
+			_, updateErr := validator.ValidateUpdate(context.Background(), validPipeline(), p)
+
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, createErr)
+				assert.NoError(t, updateErr)
+				return
+			}
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, createErr, want)
+				assert.ErrorContains(t, updateErr, want)
+			}
+		})
+	}
+}
+
+func TestValidateForDefaultController(t *testing.T) {
+	withClusterRef := func(kind string) *v1alpha1.Pipeline {
+		p := validPipeline()
+		p.Spec.Environments[1].Targets[0].ClusterRef = &v1alpha1.CrossNamespaceClusterReference{Kind: kind, Name: "prod"}
+		return p
+	}
+
+	t.Run("accepts GitopsCluster references", func(t *testing.T) {
+		_, err := (&webhooks.PipelineValidator{}).ValidateCreate(context.Background(), withClusterRef(v1alpha1.GitopsClusterKind))
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects other cluster kinds", func(t *testing.T) {
+		_, err := (&webhooks.PipelineValidator{}).ValidateCreate(context.Background(), withClusterRef(v1alpha1.CAPIClusterKind))
+		assert.ErrorContains(t, err, "spec.environments[1].targets[0].clusterRef.kind: Invalid value")
+	})
+
+	t.Run("rejects a service account", func(t *testing.T) {
+		p := validPipeline()
+		p.Spec.ServiceAccountName = "pipelines"
+		_, err := (&webhooks.PipelineValidator{}).ValidateCreate(context.Background(), p)
+		assert.ErrorContains(t, err, "spec.serviceAccountName: Forbidden")
+
+		_, err = (&webhooks.PipelineValidator{LevelTriggered: true}).ValidateCreate(context.Background(), p)
+		assert.NoError(t, err)
+	})
+
+	t.Run("accepts other cluster kinds with the level-triggered controller", func(t *testing.T) {
+		_, err := (&webhooks.PipelineValidator{LevelTriggered: true}).ValidateCreate(context.Background(), withClusterRef(v1alpha1.SecretClusterKind))
+		assert.NoError(t, err)
+	})
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -15,22 +17,40 @@ import (
 	"github.com/fluxcd/pkg/runtime/logger"
 	flag "github.com/spf13/pflag"
 	clusterctrlv1alpha1 "github.com/weaveworks/cluster-controller/api/v1alpha1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
 	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/api/v1beta1"
 	"github.com/weaveworks/pipeline-controller/controllers"
 	"github.com/weaveworks/pipeline-controller/controllers/leveltriggered"
+	"github.com/weaveworks/pipeline-controller/internal/clusteraccess"
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
+	"github.com/weaveworks/pipeline-controller/internal/kubeauth"
+	"github.com/weaveworks/pipeline-controller/internal/sharding"
+	"github.com/weaveworks/pipeline-controller/internal/storageversion"
+	"github.com/weaveworks/pipeline-controller/internal/tracing"
+	"github.com/weaveworks/pipeline-controller/internal/webhooks"
+	"github.com/weaveworks/pipeline-controller/pkg/targetstatus"
 	"github.com/weaveworks/pipeline-controller/server"
 	"github.com/weaveworks/pipeline-controller/server/strategy"
 	"github.com/weaveworks/pipeline-controller/server/strategy/notification"
 )
 
 const (
-	controllerName = "pipeline-controller"
+	controllerName  = "pipeline-controller"
+	pipelineCRDName = "pipelines.pipelines.weave.works"
+	// debugCachesPath is where the level-triggered controller's target caches are described, on the metrics server.
+	debugCachesPath = "/debug/caches"
 )
 
 var (
@@ -41,7 +61,10 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	utilruntime.Must(clusterctrlv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
 }
 
 func main() {
@@ -58,6 +81,20 @@ func main() {
 		promotionRetryMaxDelaySeconds     int
 		promotionRetryFailureThreshold    int
 		useLevelTriggeredController       bool
+		promotionRetryBackoff             time.Duration
+		targetStatusRulesFile             string
+		enableWebhooks                    bool
+		migrateStorageVersion             bool
+		tracingOpts                       tracing.Options
+		namespacedTargetCaches            bool
+		targetCacheSyncTimeout            time.Duration
+		trimTargetObjects                 bool
+		targetLabelSelector               string
+		targetFieldSelector               string
+		shardSelector                     string
+		shardKey                          string
+		requireServiceAccount             bool
+		noCrossNamespaceRefs              bool
 	)
 
 	// This is a feature flag, guarding the new level-triggered behaviour.
@@ -79,6 +116,24 @@ func main() {
 	flag.IntVar(&promotionRetryDelaySeconds, "promotion-retry-delay", server.DefaultRetryDelay, "Delay between promotion retries in seconds.")
 	flag.IntVar(&promotionRetryMaxDelaySeconds, "promotion-retry-max-delay", server.DefaultRetryMaxDelay, "Maximum delay between promotion retries.")
 	flag.IntVar(&promotionRetryFailureThreshold, "promotion-retry-threshold", server.DefaultRetryThreshold, "How many times a promotion should be retried.")
+	flag.DurationVar(&promotionRetryBackoff, "promotion-in-flight-backoff", leveltriggered.DefaultPromotionRetryBackoff, "How long the level-triggered controller waits for a promotion to take effect before running the promotion strategy again for the same revision, and before retrying a promotion that failed.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Serve the validating and conversion webhooks for Pipeline objects. This needs a certificate to be provided for the webhook server.")
+	flag.BoolVar(&migrateStorageVersion, "migrate-storage-version", false, "Rewrite all Pipeline objects in the storage version of the Pipeline CRD on start-up, then record that only that version is stored.")
+	flag.BoolVar(&namespacedTargetCaches, "namespaced-target-caches", false, "Watch the targets in each cluster with a cache per namespace rather than one for the whole cluster, so that cluster credentials only need namespaced RBAC. GitopsClusters can override this with the pipelines.weave.works/namespaced-cache annotation. Used by the level-triggered controller.")
+	flag.DurationVar(&targetCacheSyncTimeout, "target-cache-sync-timeout", leveltriggered.DefaultCacheSyncTimeout, "How long the level-triggered controller waits for a cache of targets to sync before recreating it, e.g. because the cluster was unreachable.")
+	flag.BoolVar(&trimTargetObjects, "trim-target-objects", false, "Cache only the metadata and status of target objects (and the container images of Deployments), to save memory. Target status rules can then only read from these. Used by the level-triggered controller.")
+	flag.StringVar(&targetLabelSelector, "target-label-selector", "", "Only cache target objects with labels matching this selector, e.g. 'pipelines.weave.works/app=true'. Used by the level-triggered controller.")
+	flag.StringVar(&targetFieldSelector, "target-field-selector", "", "Only cache target objects with fields matching this selector, e.g. 'metadata.namespace!=kube-system'. Used by the level-triggered controller.")
+	flag.StringVar(&shardSelector, "shard-selector", "", "Only reconcile Pipelines with labels matching this selector, e.g. 'pipelines.weave.works/shard=a', so that several controllers can split the Pipelines between them. Used by the level-triggered controller.")
+	flag.StringVar(&shardKey, "shard-key", "", "Only reconcile the Pipelines whose namespace and name hash to this shard, given as <index>/<count>, e.g. '0/3' for the first of three controllers. Used by the level-triggered controller.")
+	flag.BoolVar(&requireServiceAccount, "require-service-account", false, "Refuse to read the clusters, targets and credentials of a Pipeline that does not name a service account to impersonate in .spec.serviceAccountName.")
+	flag.BoolVar(&noCrossNamespaceRefs, "no-cross-namespace-refs", false, fmt.Sprintf("Refuse references from a Pipeline to clusters in other namespaces, unless the cluster lists the namespace of the Pipeline in its %s annotation.", v1alpha1.AllowedNamespacesAnnotation))
+	flag.StringVar(&targetStatusRulesFile, "target-status-rules-file", "", "Path to a YAML file with rules for reading the readiness and revision of target objects, used by the level-triggered controller.")
+
+	// Tracing
+	flag.StringVar(&tracingOpts.Exporter, "tracing-exporter", tracing.ExporterNone, fmt.Sprintf("Where to export OpenTelemetry traces of promotions to, one of %v.", tracing.Exporters))
+	flag.StringVar(&tracingOpts.OTLPEndpoint, "tracing-otlp-endpoint", "", "The host:port of the OTLP/gRPC collector traces are sent to with --tracing-exporter=otlp. Defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable.")
+	flag.BoolVar(&tracingOpts.OTLPInsecure, "tracing-otlp-insecure", false, "Connect to the OTLP collector without TLS.")
 
 	logOptions.BindFlags(flag.CommandLine)
 
@@ -87,13 +142,43 @@ func main() {
 	log := logger.NewLogger(logOptions)
 	ctrl.SetLogger(log)
 
+	shard, err := sharding.New(shardSelector, shardKey)
+	if err != nil {
+		setupLog.Error(err, "invalid shard")
+		os.Exit(1)
+	}
+	if shard.IsSharded() && !useLevelTriggeredController {
+		setupLog.Error(errors.New("sharding needs --enable-level-triggered"), "invalid shard")
+		os.Exit(1)
+	}
+	if requireServiceAccount && !useLevelTriggeredController {
+		// the default controller reads the clusters and targets of every Pipeline with its own identity.
+		setupLog.Error(errors.New("--require-service-account needs --enable-level-triggered"), "invalid flags")
+		os.Exit(1)
+	}
+
+	// each shard has its own leader. With a selector, only the shard's own Pipelines are cached; with a shard key, all
+	// Pipelines are cached, and the controller ignores those of other shards.
+	leaderElectionID := fmt.Sprintf("%s-leader-election", controllerName)
+	var cacheOpts cache.Options
+	if shard.IsSharded() {
+		leaderElectionID = fmt.Sprintf("%s-%s", leaderElectionID, shard.ID())
+		if shard.Selector != nil {
+			cacheOpts.ByObject = map[client.Object]cache.ByObject{
+				&v1alpha1.Pipeline{}: {Label: shard.Selector},
+			}
+		}
+		setupLog.Info("reconciling a shard of the Pipelines", "shard", shard.String())
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
+		Cache:                  cacheOpts,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       fmt.Sprintf("%s-leader-election", controllerName),
+		LeaderElectionID:       leaderElectionID,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -111,9 +196,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	clusterAccess := clusteraccess.Policy{NoCrossNamespaceRefs: noCrossNamespaceRefs}
+	impersonator := impersonation.New(mgr.GetClient(), mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper(), requireServiceAccount)
+
 	pullRequestStrategy, err := pullrequest.New(
 		mgr.GetClient(),
 		log.WithValues("strategy", "pullrequest"),
+		pullrequest.Impersonator(impersonator),
 	)
 	if err != nil {
 		setupLog.Error(err, "unable to create GitHub promotion strategy")
@@ -133,18 +222,58 @@ func main() {
 
 	var startErr error
 	if useLevelTriggeredController {
-		startErr = leveltriggered.NewPipelineReconciler(
+		var targetStatusRules []v1alpha1.TargetStatusRule
+		if targetStatusRulesFile != "" {
+			if targetStatusRules, err = targetstatus.LoadRules(targetStatusRulesFile); err != nil {
+				setupLog.Error(err, "unable to load target status rules")
+				os.Exit(1)
+			}
+		}
+		targetStatusResolver, err := targetstatus.NewResolver(targetStatusRules)
+		if err != nil {
+			setupLog.Error(err, "invalid target status rules")
+			os.Exit(1)
+		}
+
+		targetCacheSelectors, err := parseSelectors(targetLabelSelector, targetFieldSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid target selector")
+			os.Exit(1)
+		}
+
+		targetCacheOpts := []leveltriggered.Opt{
+			leveltriggered.WithPromotionRetryBackoff(promotionRetryBackoff),
+			leveltriggered.WithTargetStatusResolver(targetStatusResolver),
+			leveltriggered.WithNamespacedTargetCaches(namespacedTargetCaches),
+			leveltriggered.WithCacheSyncTimeout(targetCacheSyncTimeout),
+			leveltriggered.WithShard(shard),
+			leveltriggered.WithImpersonator(impersonator),
+			leveltriggered.WithClusterAccessPolicy(clusterAccess),
+			targetCacheSelectors,
+		}
+		if trimTargetObjects {
+			targetCacheOpts = append(targetCacheOpts, leveltriggered.WithTargetCacheTransform(targetstatus.Trim))
+		}
+
+		reconciler := leveltriggered.NewPipelineReconciler(
 			mgr.GetClient(),
 			mgr.GetScheme(),
 			controllerName,
 			eventRecorder,
 			stratReg,
-		).SetupWithManager(mgr)
+			targetCacheOpts...,
+		)
+		startErr = reconciler.SetupWithManager(mgr)
+		if startErr == nil {
+			startErr = mgr.AddMetricsExtraHandler(debugCachesPath,
+				kubeauth.Middleware(mgr.GetClient(), ctrl.Log.WithName("debug"), reconciler.DebugHandler()))
+		}
 	} else {
 		startErr = controllers.NewPipelineReconciler(
 			mgr.GetClient(),
 			mgr.GetScheme(),
 			controllerName,
+			controllers.WithClusterAccessPolicy(clusterAccess),
 		).SetupWithManager(mgr)
 	}
 
@@ -153,6 +282,25 @@ func main() {
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		if err := (&webhooks.PipelineValidator{LevelTriggered: useLevelTriggeredController}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pipeline")
+			os.Exit(1)
+		}
+	}
+
+	if migrateStorageVersion {
+		migrationClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+		if err != nil {
+			setupLog.Error(err, "unable to create client for storage version migration")
+			os.Exit(1)
+		}
+		if err := mgr.Add(storageversion.NewMigrator(migrationClient, pipelineCRDName, log.WithName("storage-version"))); err != nil {
+			setupLog.Error(err, "unable to set up storage version migration")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -164,14 +312,49 @@ func main() {
 
 	ctx := ctrl.SetupSignalHandler()
 
-	promServer, err := server.NewPromotionServer(
-		mgr.GetClient(),
+	shutdownTracing, err := tracing.Setup(ctx, tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		// the signal handler's context is done by now, so spans are flushed with a fresh one.
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "problem shutting down tracing")
+		}
+	}()
+
+	promServerOpts := []server.Opt{
 		server.WithRateLimit(promotionRateLimit, time.Duration(promotionRateLimitIntervalSeconds)*time.Second),
 		server.WithRetry(promotionRetryDelaySeconds, promotionRetryMaxDelaySeconds, promotionRetryFailureThreshold),
 		server.Logger(log.WithName("promotion")),
 		server.ListenAddr(promServerAddr),
 		server.StrategyRegistry(stratReg),
-	)
+	}
+	if useLevelTriggeredController {
+		// the level-triggered controller promotes approved revisions itself
+		promServerOpts = append(promServerOpts, server.WithRecordApprovalOnly())
+	}
+
+	// the promotion server is reached through a Service that may pick any shard, so it must find every Pipeline, not
+	// just those in the shard's cache.
+	promServerClient := mgr.GetClient()
+	if shard.Selector != nil {
+		promServerClient, err = client.New(mgr.GetConfig(), client.Options{
+			Scheme: mgr.GetScheme(),
+			Mapper: mgr.GetRESTMapper(),
+			Cache: &client.CacheOptions{
+				Reader:     mgr.GetCache(),
+				DisableFor: []client.Object{&v1alpha1.Pipeline{}},
+			},
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to create promotion server client")
+			os.Exit(1)
+		}
+	}
+
+	promServer, err := server.NewPromotionServer(promServerClient, promServerOpts...)
 	if err != nil {
 		setupLog.Error(err, "failed setting up promotion server")
 		os.Exit(1)
@@ -189,3 +372,23 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseSelectors parses the label and field selectors for target caches given as flags, either of which may be empty.
+func parseSelectors(labelSelector, fieldSelector string) (leveltriggered.Opt, error) {
+	var (
+		ls  labels.Selector
+		fs  fields.Selector
+		err error
+	)
+	if labelSelector != "" {
+		if ls, err = labels.Parse(labelSelector); err != nil {
+			return nil, fmt.Errorf("failed parsing label selector: %w", err)
+		}
+	}
+	if fieldSelector != "" {
+		if fs, err = fields.ParseSelector(fieldSelector); err != nil {
+			return nil, fmt.Errorf("failed parsing field selector: %w", err)
+		}
+	}
+	return leveltriggered.WithTargetCacheSelectors(ls, fs), nil
+}
@@ -8,6 +8,8 @@ import (
 const (
 	ReadyCondition            = "Ready"
 	PromotionPendingCondition = "PromotionPending"
+	RolledBackCondition       = "RolledBack"
+	ConvergedCondition        = "Converged"
 )
 
 func IsReady(cs []metav1.Condition) bool {
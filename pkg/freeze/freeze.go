@@ -0,0 +1,122 @@
+package freeze
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+// maxChainedWindows bounds how many back-to-back or overlapping windows are followed when working out when a freeze ends,
+// so that windows covering all of time don't loop forever.
+const maxChainedWindows = 1000
+
+// maxSampledOccurrences is how many occurrences of a schedule are looked at to find its interval.
+const maxSampledOccurrences = 1000
+
+type window struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// Validate returns an error if the freeze window given cannot be used. A window must not last longer than the shortest
+// interval between occurrences of its schedule, since it would then overlap itself; a longer freeze can be had with a
+// less frequent schedule.
+func Validate(w v1alpha1.FreezeWindow) error {
+	p, err := parse(w)
+	if err != nil {
+		return err
+	}
+
+	if interval := minInterval(p.schedule, time.Now()); interval > 0 && p.duration > interval {
+		return fmt.Errorf("freeze window duration %s is longer than the %s interval of its schedule %q", p.duration, interval, w.Schedule)
+	}
+	return nil
+}
+
+// Check returns whether the time given falls within any of the freeze windows given, and if so, when the freeze ends.
+// Overlapping and back-to-back windows are treated as a single freeze.
+func Check(windows []v1alpha1.FreezeWindow, now time.Time) (bool, time.Time, error) {
+	parsed := make([]window, 0, len(windows))
+	for _, w := range windows {
+		p, err := parse(w)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+		parsed = append(parsed, p)
+	}
+
+	var until time.Time
+	t := now
+	for i := 0; i < maxChainedWindows; i++ {
+		end, ok := activeUntil(parsed, t)
+		if !ok {
+			break
+		}
+		until, t = end, end
+	}
+
+	return !until.IsZero(), until, nil
+}
+
+// activeUntil returns the latest end of the windows that are active at the time given, and false if there are none.
+//
+// Only the first occurrence of each window that is active at the time given is looked at. A window can only overlap
+// itself if it lasts longer than the interval of its schedule, which Validate rules out; if it does anyway, the later
+// occurrences are picked up by Check following on from the end of the first.
+func activeUntil(windows []window, t time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, w := range windows {
+		// the first start after t-duration gives an occurrence that is active at t, if it's not after t.
+		if start := w.schedule.Next(t.Add(-w.duration)); !start.After(t) {
+			if e := start.Add(w.duration); e.After(end) {
+				end = e
+			}
+		}
+	}
+
+	return end, !end.IsZero()
+}
+
+// minInterval returns the shortest interval between the occurrences of the schedule given, sampled from the time given,
+// or zero if the schedule has fewer than two occurrences.
+func minInterval(schedule cron.Schedule, from time.Time) time.Duration {
+	var interval time.Duration
+	prev := schedule.Next(from)
+	for i := 0; i < maxSampledOccurrences && !prev.IsZero(); i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if d := next.Sub(prev); interval == 0 || d < interval {
+			interval = d
+		}
+		prev = next
+	}
+
+	return interval
+}
+
+func parse(w v1alpha1.FreezeWindow) (window, error) {
+	if w.Duration.Duration <= 0 {
+		return window{}, errors.New("freeze window duration must be positive")
+	}
+
+	tz := w.TimeZone
+	if tz == "" {
+		tz = "UTC"
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return window{}, fmt.Errorf("invalid freeze window time zone %q: %w", w.TimeZone, err)
+	}
+
+	schedule, err := cron.ParseStandard("CRON_TZ=" + tz + " " + w.Schedule)
+	if err != nil {
+		return window{}, fmt.Errorf("invalid freeze window schedule %q: %w", w.Schedule, err)
+	}
+
+	return window{schedule: schedule, duration: w.Duration.Duration}, nil
+}
@@ -0,0 +1,157 @@
+package freeze_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/pkg/freeze"
+)
+
+func TestCheck(t *testing.T) {
+	// 6pm Friday until 8am Monday.
+	weekend := v1alpha1.FreezeWindow{
+		Schedule: "0 18 * * 5",
+		Duration: metav1.Duration{Duration: 62 * time.Hour},
+	}
+	// the last hour of Monday, New York time.
+	releaseDay := v1alpha1.FreezeWindow{
+		Schedule: "0 23 * * 1",
+		Duration: metav1.Duration{Duration: time.Hour},
+		TimeZone: "America/New_York",
+	}
+
+	tests := []struct {
+		name       string
+		windows    []v1alpha1.FreezeWindow
+		now        time.Time
+		wantFrozen bool
+		wantUntil  time.Time
+	}{
+		{
+			name:    "no windows",
+			windows: nil,
+			now:     time.Date(2023, 11, 4, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "before the window",
+			windows: []v1alpha1.FreezeWindow{weekend},
+			now:     time.Date(2023, 11, 3, 17, 59, 0, 0, time.UTC),
+		},
+		{
+			name:       "at the start of the window",
+			windows:    []v1alpha1.FreezeWindow{weekend},
+			now:        time.Date(2023, 11, 3, 18, 0, 0, 0, time.UTC),
+			wantFrozen: true,
+			wantUntil:  time.Date(2023, 11, 6, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "during the window",
+			windows:    []v1alpha1.FreezeWindow{weekend},
+			now:        time.Date(2023, 11, 5, 12, 0, 0, 0, time.UTC),
+			wantFrozen: true,
+			wantUntil:  time.Date(2023, 11, 6, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "at the end of the window",
+			windows: []v1alpha1.FreezeWindow{weekend},
+			now:     time.Date(2023, 11, 6, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "in the window's time zone",
+			windows:    []v1alpha1.FreezeWindow{releaseDay},
+			now:        time.Date(2023, 11, 7, 4, 30, 0, 0, time.UTC),
+			wantFrozen: true,
+			wantUntil:  time.Date(2023, 11, 7, 5, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "back-to-back windows",
+			windows: []v1alpha1.FreezeWindow{
+				weekend,
+				{Schedule: "0 8 * * 1", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			},
+			now:        time.Date(2023, 11, 5, 12, 0, 0, 0, time.UTC),
+			wantFrozen: true,
+			wantUntil:  time.Date(2023, 11, 6, 10, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frozen, until, err := freeze.Check(tt.windows, tt.now)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantFrozen, frozen)
+			assert.True(t, tt.wantUntil.Equal(until), "expected %s, got %s", tt.wantUntil, until)
+		})
+	}
+}
+
+// Windows that overlap themselves can't be created, but can exist from before they were ruled out. Checking them must
+// not walk through every occurrence of the schedule.
+func TestCheck_dense_schedule(t *testing.T) {
+	windows := []v1alpha1.FreezeWindow{{Schedule: "* * * * *", Duration: metav1.Duration{Duration: 720 * time.Hour}}}
+	now := time.Date(2023, 11, 4, 12, 0, 30, 0, time.UTC)
+
+	start := time.Now()
+	frozen, until, err := freeze.Check(windows, now)
+	assert.NoError(t, err)
+	assert.True(t, frozen)
+	assert.True(t, until.After(now), "expected the freeze to end after %s, got %s", now, until)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  v1alpha1.FreezeWindow
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			window: v1alpha1.FreezeWindow{Schedule: "0 18 * * 5", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Europe/London"},
+		},
+		{
+			name:    "invalid schedule",
+			window:  v1alpha1.FreezeWindow{Schedule: "every friday", Duration: metav1.Duration{Duration: time.Hour}},
+			wantErr: `invalid freeze window schedule "every friday"`,
+		},
+		{
+			name:    "invalid time zone",
+			window:  v1alpha1.FreezeWindow{Schedule: "0 18 * * 5", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Mars/Olympus_Mons"},
+			wantErr: `invalid freeze window time zone "Mars/Olympus_Mons"`,
+		},
+		{
+			name:    "no duration",
+			window:  v1alpha1.FreezeWindow{Schedule: "0 18 * * 5"},
+			wantErr: "freeze window duration must be positive",
+		},
+		{
+			name:   "as long as the interval",
+			window: v1alpha1.FreezeWindow{Schedule: "0 * * * *", Duration: metav1.Duration{Duration: time.Hour}},
+		},
+		{
+			name:    "longer than the interval",
+			window:  v1alpha1.FreezeWindow{Schedule: "* * * * *", Duration: metav1.Duration{Duration: 24 * time.Hour}},
+			wantErr: "longer than the 1m0s interval",
+		},
+		{
+			name:    "longer than the shortest of irregular intervals",
+			window:  v1alpha1.FreezeWindow{Schedule: "0 9 * * 1-5", Duration: metav1.Duration{Duration: 48 * time.Hour}},
+			wantErr: "longer than the 24h0m0s interval",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := freeze.Validate(tt.window)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
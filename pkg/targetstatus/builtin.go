@@ -0,0 +1,122 @@
+package targetstatus
+
+import (
+	"errors"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/weaveworks/pipeline-controller/pkg/conditions"
+)
+
+// builtin returns the built-in Func for the kind given. Anything not otherwise known is assumed to be a Flux-like
+// object, which is also how Flux Kustomizations are treated.
+func builtin(gvk schema.GroupVersionKind) Func {
+	switch {
+	case gvk.Group == "helm.toolkit.fluxcd.io" && gvk.Kind == "HelmRelease" && (gvk.Version == "v2" || gvk.Version == "v2beta2"):
+		return helmReleaseStatus
+	case gvk.Group == "apps" && gvk.Kind == "Deployment":
+		return deploymentStatus
+	default:
+		return fluxStatus
+	}
+}
+
+// fluxStatus assumes a Flux-like object; specifically with
+//   - a Ready condition
+//   - a .status.lastAppliedRevision
+func fluxStatus(obj *unstructured.Unstructured) (Status, error) {
+	return readyConditionAnd(obj, func() (string, bool) {
+		rev, ok, err := unstructured.NestedString(obj.Object, "status", "lastAppliedRevision")
+		return rev, ok && err == nil
+	}, ".status.lastAppliedRevision")
+}
+
+// helmReleaseStatus handles HelmRelease v2beta2 and later, where the chart version of the latest release is recorded in
+// .status.history.
+func helmReleaseStatus(obj *unstructured.Unstructured) (Status, error) {
+	return readyConditionAnd(obj, func() (string, bool) {
+		history, ok, err := unstructured.NestedSlice(obj.Object, "status", "history")
+		if !ok || err != nil || len(history) == 0 {
+			return "", false
+		}
+		latest, ok := history[0].(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		rev, ok, err := unstructured.NestedString(latest, "chartVersion")
+		return rev, ok && err == nil && rev != ""
+	}, ".status.history[0].chartVersion")
+}
+
+// deploymentStatus treats a Deployment as ready when it's Available and its latest generation has been observed, and
+// takes the image tag (or digest) of its first container as the revision.
+func deploymentStatus(obj *unstructured.Unstructured) (Status, error) {
+	var status Status
+
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	conds, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	status.Ready = observed >= obj.GetGeneration() && conditionIsTrue(conds, "Available")
+
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	if len(containers) > 0 {
+		if container, ok := containers[0].(map[string]interface{}); ok {
+			image, _, _ := unstructured.NestedString(container, "image")
+			status.Revision = imageTag(image)
+		}
+	}
+
+	if status.Ready && status.Revision == "" {
+		return Status{}, errors.New("unable to find an image tag in ready Deployment")
+	}
+
+	return status, nil
+}
+
+// readyConditionAnd gets the readiness from the Ready condition of the object, and the revision using the func given.
+func readyConditionAnd(obj *unstructured.Unstructured, revision func() (string, bool), revisionPath string) (Status, error) {
+	var status Status
+
+	conds, ok, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if !ok || err != nil {
+		return status, nil
+	}
+	status.Ready = conditions.IsReadyUnstructured(conds)
+
+	rev, ok := revision()
+	if !ok {
+		// It's not an error to lack a Ready condition (new objects will lack any conditions), and it's not an error to lack a revision
+		// (maybe it hasn't got that far yet); but it is an error to have a ready condition of true and lack a revision, since that means
+		// the object is not a usable target.
+		if status.Ready {
+			return Status{}, errors.New("unable to find " + revisionPath + " in ready target object")
+		}
+		return status, nil
+	}
+	status.Revision = rev
+
+	return status, nil
+}
+
+func conditionIsTrue(conds []interface{}, typ string) bool {
+	for _, obj := range conds {
+		if cond, ok := obj.(map[string]interface{}); ok && cond["type"] == typ {
+			return cond["status"] == string(metav1.ConditionTrue)
+		}
+	}
+	return false
+}
+
+// imageTag returns the digest or tag of the image reference given, or an empty string if it has neither.
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	// a colon before the last slash belongs to a registry host:port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package targetstatus
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+)
+
+const (
+	// DefaultReadyExpression is used for rules that don't give a readiness expression.
+	DefaultReadyExpression = `{.status.conditions[?(@.type=="Ready")].status}`
+	// DefaultRevisionExpression is used for rules that don't give a revision expression.
+	DefaultRevisionExpression = `{.status.lastAppliedRevision}`
+)
+
+// Status is the readiness and revision of an app object.
+type Status struct {
+	Ready    bool
+	Revision string
+}
+
+// Func gets the status of an app object. An error means the object is not usable as a target.
+type Func func(obj *unstructured.Unstructured) (Status, error)
+
+// Resolver finds the Func to use for an app object, given the rules from a pipeline, the rules configured for the
+// controller, and the built-in rules, in that order of precedence.
+type Resolver struct {
+	rules map[schema.GroupVersionKind]Func
+}
+
+// NewResolver returns a Resolver using the rules given in addition to the built-in rules.
+func NewResolver(rules []v1alpha1.TargetStatusRule) (*Resolver, error) {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resolver{rules: compiled}, nil
+}
+
+// For returns the Func to use for app objects of the kind given, taking into account the pipeline's rules.
+func (r *Resolver) For(pipelineRules []v1alpha1.TargetStatusRule, gvk schema.GroupVersionKind) (Func, error) {
+	for _, rule := range pipelineRules {
+		if ruleGVK(rule) == gvk {
+			return FromRule(rule)
+		}
+	}
+
+	if r != nil {
+		if fn, ok := r.rules[gvk]; ok {
+			return fn, nil
+		}
+	}
+
+	return builtin(gvk), nil
+}
+
+// FromRule returns a Func that evaluates the JSONPath expressions of the rule given.
+func FromRule(rule v1alpha1.TargetStatusRule) (Func, error) {
+	readyExpr := rule.Ready
+	if readyExpr == "" {
+		readyExpr = DefaultReadyExpression
+	}
+	ready, err := parseJSONPath("ready", readyExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	revisionExpr := rule.Revision
+	if revisionExpr == "" {
+		revisionExpr = DefaultRevisionExpression
+	}
+	revision, err := parseJSONPath("revision", revisionExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(obj *unstructured.Unstructured) (Status, error) {
+		var status Status
+
+		readyValue, err := evaluate(ready, obj)
+		if err != nil {
+			return status, err
+		}
+		status.Ready = strings.EqualFold(readyValue, "true")
+
+		status.Revision, err = evaluate(revision, obj)
+		if err != nil {
+			return Status{}, err
+		}
+		// It's not an error to lack a revision while not ready (maybe it hasn't got that far yet), but it is an error
+		// to be ready without a revision, since that means the object is not a usable target.
+		if status.Ready && status.Revision == "" {
+			return Status{}, fmt.Errorf("unable to find revision %s in ready target object", revisionExpr)
+		}
+
+		return status, nil
+	}, nil
+}
+
+// LoadRules reads a list of rules from the YAML or JSON file given.
+func LoadRules(path string) ([]v1alpha1.TargetStatusRule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading target status rules: %w", err)
+	}
+
+	var rules []v1alpha1.TargetStatusRule
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return nil, fmt.Errorf("failed parsing target status rules from %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+func compileRules(rules []v1alpha1.TargetStatusRule) (map[schema.GroupVersionKind]Func, error) {
+	compiled := map[schema.GroupVersionKind]Func{}
+	for _, rule := range rules {
+		fn, err := FromRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		compiled[ruleGVK(rule)] = fn
+	}
+
+	return compiled, nil
+}
+
+func ruleGVK(rule v1alpha1.TargetStatusRule) schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(rule.APIVersion, rule.Kind)
+}
+
+func parseJSONPath(name, expr string) (*jsonpath.JSONPath, error) {
+	// accept the relaxed form `.status.foo` as well as `{.status.foo}`, like kubectl does.
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+
+	jp := jsonpath.New(name).AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return nil, fmt.Errorf("invalid %s expression %q: %w", name, expr, err)
+	}
+
+	return jp, nil
+}
+
+func evaluate(jp *jsonpath.JSONPath, obj *unstructured.Unstructured) (string, error) {
+	var buf bytes.Buffer
+	if err := jp.Execute(&buf, obj.Object); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
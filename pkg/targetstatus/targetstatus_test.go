@@ -0,0 +1,240 @@
+package targetstatus_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/pkg/targetstatus"
+)
+
+func readyCondition(status string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "Ready",
+		"status": status,
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		name    string
+		gvk     schema.GroupVersionKind
+		obj     map[string]interface{}
+		want    targetstatus.Status
+		wantErr string
+	}{
+		{
+			name: "Kustomization without conditions",
+			gvk:  schema.GroupVersionKind{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Kind: "Kustomization"},
+			obj:  map[string]interface{}{},
+			want: targetstatus.Status{},
+		},
+		{
+			name: "ready Kustomization",
+			gvk:  schema.GroupVersionKind{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Kind: "Kustomization"},
+			obj: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions":          []interface{}{readyCondition("True")},
+					"lastAppliedRevision": "main@sha1:abc",
+				},
+			},
+			want: targetstatus.Status{Ready: true, Revision: "main@sha1:abc"},
+		},
+		{
+			name: "ready Kustomization without revision",
+			gvk:  schema.GroupVersionKind{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Kind: "Kustomization"},
+			obj: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []interface{}{readyCondition("True")},
+				},
+			},
+			wantErr: "unable to find .status.lastAppliedRevision in ready target object",
+		},
+		{
+			name: "HelmRelease v2beta1 uses lastAppliedRevision",
+			gvk:  schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Version: "v2beta1", Kind: "HelmRelease"},
+			obj: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions":          []interface{}{readyCondition("True")},
+					"lastAppliedRevision": "1.0.0",
+				},
+			},
+			want: targetstatus.Status{Ready: true, Revision: "1.0.0"},
+		},
+		{
+			name: "HelmRelease v2 uses the chart version from the history",
+			gvk:  schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Version: "v2", Kind: "HelmRelease"},
+			obj: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []interface{}{readyCondition("True")},
+					"history": []interface{}{
+						map[string]interface{}{"chartVersion": "1.2.0"},
+						map[string]interface{}{"chartVersion": "1.1.0"},
+					},
+				},
+			},
+			want: targetstatus.Status{Ready: true, Revision: "1.2.0"},
+		},
+		{
+			name: "unready HelmRelease v2beta2 without history",
+			gvk:  schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Version: "v2beta2", Kind: "HelmRelease"},
+			obj: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []interface{}{readyCondition("False")},
+				},
+			},
+			want: targetstatus.Status{},
+		},
+		{
+			name: "available Deployment",
+			gvk:  schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			obj: map[string]interface{}{
+				"metadata": map[string]interface{}{"generation": int64(2)},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{"image": "registry:5000/podinfo:6.5.0"},
+							},
+						},
+					},
+				},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(2),
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Available", "status": "True"},
+					},
+				},
+			},
+			want: targetstatus.Status{Ready: true, Revision: "6.5.0"},
+		},
+		{
+			name: "Deployment with unobserved generation",
+			gvk:  schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			obj: map[string]interface{}{
+				"metadata": map[string]interface{}{"generation": int64(3)},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{"image": "podinfo@sha256:abc"},
+							},
+						},
+					},
+				},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(2),
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Available", "status": "True"},
+					},
+				},
+			},
+			want: targetstatus.Status{Ready: false, Revision: "sha256:abc"},
+		},
+	}
+
+	resolver, err := targetstatus.NewResolver(nil)
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := resolver.For(nil, tt.gvk)
+			require.NoError(t, err)
+
+			status, err := fn(&unstructured.Unstructured{Object: tt.obj})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, status)
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "App"}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"phase":   "Deployed",
+			"healthy": true,
+			"version": "2.0.0",
+		},
+	}}
+
+	configured := []v1alpha1.TargetStatusRule{{
+		APIVersion: "example.com/v1",
+		Kind:       "App",
+		Ready:      ".status.healthy",
+		Revision:   "{.status.version}",
+	}}
+	resolver, err := targetstatus.NewResolver(configured)
+	require.NoError(t, err)
+
+	t.Run("uses the configured rule", func(t *testing.T) {
+		fn, err := resolver.For(nil, gvk)
+		require.NoError(t, err)
+		status, err := fn(obj)
+		require.NoError(t, err)
+		assert.Equal(t, targetstatus.Status{Ready: true, Revision: "2.0.0"}, status)
+	})
+
+	t.Run("pipeline rules take precedence", func(t *testing.T) {
+		fn, err := resolver.For([]v1alpha1.TargetStatusRule{{
+			APIVersion: "example.com/v1",
+			Kind:       "App",
+			Ready:      `{.status.phase}`,
+			Revision:   "{.status.version}",
+		}}, gvk)
+		require.NoError(t, err)
+		status, err := fn(obj)
+		require.NoError(t, err)
+		assert.Equal(t, targetstatus.Status{Ready: false, Revision: "2.0.0"}, status)
+	})
+
+	t.Run("ready without revision is an error", func(t *testing.T) {
+		fn, err := resolver.For([]v1alpha1.TargetStatusRule{{
+			APIVersion: "example.com/v1",
+			Kind:       "App",
+			Ready:      ".status.healthy",
+			Revision:   ".status.missing",
+		}}, gvk)
+		require.NoError(t, err)
+		_, err = fn(obj)
+		assert.EqualError(t, err, "unable to find revision .status.missing in ready target object")
+	})
+
+	t.Run("invalid expressions are rejected", func(t *testing.T) {
+		_, err := targetstatus.NewResolver([]v1alpha1.TargetStatusRule{{
+			APIVersion: "example.com/v1",
+			Kind:       "App",
+			Ready:      "{.status[",
+		}})
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+- apiVersion: example.com/v1
+  kind: App
+  ready: .status.healthy
+  revision: .status.version
+`), 0o600))
+
+	rules, err := targetstatus.LoadRules(path)
+	require.NoError(t, err)
+	assert.Equal(t, []v1alpha1.TargetStatusRule{{
+		APIVersion: "example.com/v1",
+		Kind:       "App",
+		Ready:      ".status.healthy",
+		Revision:   ".status.version",
+	}}, rules)
+}
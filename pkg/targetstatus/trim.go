@@ -0,0 +1,71 @@
+package targetstatus
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// lastAppliedConfigAnnotation is set by `kubectl apply`, and holds a copy of the whole object as last applied.
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Trim drops the parts of a target object that neither the built-in status funcs nor rules reading from the status
+// need, so that caches of target objects take less memory. What's kept is the object's metadata, without its managed
+// fields and last applied configuration; its status; and, for Deployments, the images of the containers in its pod
+// template. Objects that are not *unstructured.Unstructured are returned as they are.
+//
+// It has the signature of a cache transform func (k8s.io/client-go/tools/cache.TransformFunc).
+func Trim(in interface{}) (interface{}, error) {
+	obj, ok := in.(*unstructured.Unstructured)
+	if !ok {
+		return in, nil
+	}
+
+	trimmed := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	trimmed.SetAPIVersion(obj.GetAPIVersion())
+	trimmed.SetKind(obj.GetKind())
+
+	if metadata, ok := obj.Object["metadata"].(map[string]interface{}); ok {
+		trimmedMetadata := make(map[string]interface{}, len(metadata))
+		for k, v := range metadata {
+			if k != "managedFields" {
+				trimmedMetadata[k] = v
+			}
+		}
+		trimmed.Object["metadata"] = trimmedMetadata
+		if annotations := obj.GetAnnotations(); annotations != nil {
+			if _, ok := annotations[lastAppliedConfigAnnotation]; ok {
+				trimmedAnnotations := make(map[string]string, len(annotations))
+				for k, v := range annotations {
+					if k != lastAppliedConfigAnnotation {
+						trimmedAnnotations[k] = v
+					}
+				}
+				trimmed.SetAnnotations(trimmedAnnotations)
+			}
+		}
+	}
+
+	if status, ok := obj.Object["status"]; ok {
+		trimmed.Object["status"] = status
+	}
+
+	gvk := obj.GroupVersionKind()
+	if gvk.Group == "apps" && gvk.Kind == "Deployment" {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		images := make([]interface{}, 0, len(containers))
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			images = append(images, map[string]interface{}{
+				"name":  container["name"],
+				"image": container["image"],
+			})
+		}
+		if err := unstructured.SetNestedSlice(trimmed.Object, images, "spec", "template", "spec", "containers"); err != nil {
+			return nil, err
+		}
+	}
+
+	return trimmed, nil
+}
@@ -0,0 +1,113 @@
+package targetstatus_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/weaveworks/pipeline-controller/pkg/targetstatus"
+)
+
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "keeps metadata and status",
+			obj: map[string]interface{}{
+				"apiVersion": "helm.toolkit.fluxcd.io/v2beta1",
+				"kind":       "HelmRelease",
+				"metadata": map[string]interface{}{
+					"name":          "podinfo",
+					"namespace":     "default",
+					"generation":    int64(3),
+					"managedFields": []interface{}{map[string]interface{}{"manager": "helm-controller"}},
+					"annotations": map[string]interface{}{
+						"kubectl.kubernetes.io/last-applied-configuration": `{"spec":{}}`,
+						"example.com/owner": "team-a",
+					},
+				},
+				"spec": map[string]interface{}{
+					"values": map[string]interface{}{"replicaCount": int64(3)},
+				},
+				"status": map[string]interface{}{
+					"lastAppliedRevision": "6.0.1",
+					"conditions":          []interface{}{readyCondition("True")},
+				},
+			},
+			want: map[string]interface{}{
+				"apiVersion": "helm.toolkit.fluxcd.io/v2beta1",
+				"kind":       "HelmRelease",
+				"metadata": map[string]interface{}{
+					"name":        "podinfo",
+					"namespace":   "default",
+					"generation":  int64(3),
+					"annotations": map[string]interface{}{"example.com/owner": "team-a"},
+				},
+				"status": map[string]interface{}{
+					"lastAppliedRevision": "6.0.1",
+					"conditions":          []interface{}{readyCondition("True")},
+				},
+			},
+		},
+		{
+			name: "keeps the container images of a Deployment",
+			obj: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "podinfo", "namespace": "default"},
+				"spec": map[string]interface{}{
+					"replicas": int64(2),
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{
+									"name":  "podinfo",
+									"image": "ghcr.io/stefanprodan/podinfo:6.0.1",
+									"env":   []interface{}{map[string]interface{}{"name": "LEVEL", "value": "debug"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "podinfo", "namespace": "default"},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{
+									"name":  "podinfo",
+									"image": "ghcr.io/stefanprodan/podinfo:6.0.1",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := targetstatus.Trim(&unstructured.Unstructured{Object: tt.obj})
+			require.NoError(t, err)
+			trimmed, ok := out.(*unstructured.Unstructured)
+			require.True(t, ok)
+			assert.Equal(t, tt.want, trimmed.Object)
+		})
+	}
+
+	t.Run("leaves other values alone", func(t *testing.T) {
+		out, err := targetstatus.Trim("not an object")
+		require.NoError(t, err)
+		assert.Equal(t, "not an object", out)
+	})
+}
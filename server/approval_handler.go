@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 
 	"github.com/fluxcd/pkg/runtime/logger"
 	"github.com/go-logr/logr"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	pipelinev1alpha1 "github.com/weaveworks/pipeline-controller/api/v1alpha1"
@@ -16,17 +18,35 @@ import (
 )
 
 type DefaultApprovalHandler struct {
-	log      logr.Logger
-	c        client.Client
-	stratReg strategy.StrategyRegistry
+	log        logr.Logger
+	c          client.Client
+	stratReg   strategy.StrategyRegistry
+	recordOnly bool
 }
 
-func NewDefaultApprovalHandler(log logr.Logger, stratReg strategy.StrategyRegistry, c client.Client) DefaultApprovalHandler {
-	return DefaultApprovalHandler{
+// ApprovalHandlerOpt is an option for NewDefaultApprovalHandler.
+type ApprovalHandlerOpt func(h *DefaultApprovalHandler)
+
+// RecordApprovalOnly makes the handler record the approved revision in the pipeline's status instead of running the
+// promotion strategy itself. This is for when the level-triggered controller carries out promotions.
+func RecordApprovalOnly() ApprovalHandlerOpt {
+	return func(h *DefaultApprovalHandler) {
+		h.recordOnly = true
+	}
+}
+
+func NewDefaultApprovalHandler(log logr.Logger, stratReg strategy.StrategyRegistry, c client.Client, opts ...ApprovalHandlerOpt) DefaultApprovalHandler {
+	h := DefaultApprovalHandler{
 		log:      log,
 		c:        c,
 		stratReg: stratReg,
 	}
+
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	return h
 }
 
 func (h DefaultApprovalHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -85,6 +105,14 @@ func (h DefaultApprovalHandler) ServeHTTP(rw http.ResponseWriter, r *http.Reques
 		return
 	}
 	promotion.Environment = promEnv
+	promotion.ServiceAccountName = pipeline.Spec.ServiceAccountName
+
+	if pipeline.Spec.IsSuspended(env) {
+		h.log.V(logger.InfoLevel).Info("promotion is suspended", "env", env, "revision", revision)
+		rw.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(rw, "promotions to environment %s are suspended", env)
+		return
+	}
 
 	promSpec := pipeline.Spec.GetPromotion(promEnv.Name)
 
@@ -95,9 +123,32 @@ func (h DefaultApprovalHandler) ServeHTTP(rw http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if h.recordOnly {
+		h.log.Info("approving promotion", "app", pipeline.Spec.AppRef, "target environment", env, "revision", revision)
+		if err := updateStatus(r.Context(), h.c, &pipeline, func(status *pipelinev1alpha1.PipelineStatus) {
+			status.SetApprovedRevision(env, revision)
+		}); err != nil {
+			h.log.Error(err, "error recording approval")
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "error approving promotion, please consult the promotion server's logs")
+			return
+		}
+
+		// the promotion itself is carried out by the controller
+		rw.WriteHeader(http.StatusAccepted)
+		return
+	}
+
 	h.log.Info("promoting app", "app", pipeline.Spec.AppRef, "source environment", env, "target environment", promotion.Environment.Name)
 
+	startedAt := metav1.Now()
 	res, err := h.promote(r.Context(), promSpec, promotion)
+
+	record := newPromotionRecord(strings.Join(pipeline.Spec.GetDependencies(env), ","), *promSpec, promotion, startedAt, res, err)
+	if recErr := recordPromotion(r.Context(), h.c, pipeline, record); recErr != nil {
+		h.log.Error(recErr, "error recording promotion history", "env", env)
+	}
+
 	if err != nil {
 		h.log.Error(err, "error promoting application")
 		rw.WriteHeader(http.StatusInternalServerError)
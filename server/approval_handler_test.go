@@ -146,6 +146,79 @@ func TestApprovalResetsWaitingApproval(t *testing.T) {
 	g.Expect(updatedPipeline.Status.Environments["prod"].WaitingApproval.Revision).To(Equal(""))
 }
 
+func TestApprovalRecordsHistory(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	p := createTestPipelineWithPromotion(g, t)
+
+	setWaitingApproval(g, t, p)
+
+	strat := introspectableStrategy{
+		location: "success",
+	}
+	stratReg := strategy.StrategyRegistry{&strat}
+
+	h := server.NewDefaultApprovalHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient)
+	resp := requestTo(g, h, http.MethodPost, "/default/app/prod/5.0.0", nil, nil)
+	g.Expect(resp.Code).To(Equal(http.StatusCreated))
+
+	updatedPipeline := v1alpha1.Pipeline{}
+	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+
+	history := updatedPipeline.Status.Environments["prod"].PromotionHistory
+	g.Expect(history).To(HaveLen(1))
+	g.Expect(history[0].SourceEnvironment).To(Equal("dev"))
+	g.Expect(history[0].TargetEnvironment).To(Equal("prod"))
+	g.Expect(history[0].Revision).To(Equal("5.0.0"))
+	g.Expect(history[0].Outcome).To(Equal(v1alpha1.PromotionSucceeded))
+	g.Expect(history[0].Location).To(Equal("success"))
+}
+
+func TestApprovalRecordOnly(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	p := createTestPipelineWithPromotion(g, t)
+
+	setWaitingApproval(g, t, p)
+
+	strat := introspectableStrategy{
+		location: "success",
+	}
+	stratReg := strategy.StrategyRegistry{&strat}
+
+	h := server.NewDefaultApprovalHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, server.RecordApprovalOnly())
+	resp := requestTo(g, h, http.MethodPost, "/default/app/prod/5.0.0", nil, nil)
+	g.Expect(resp.Code).To(Equal(http.StatusAccepted))
+	g.Expect(strat.promotions).To(BeEmpty())
+
+	updatedPipeline := v1alpha1.Pipeline{}
+	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+
+	g.Expect(updatedPipeline.Status.Environments["prod"].ApprovedRevision).To(Equal("5.0.0"))
+	g.Expect(updatedPipeline.Status.Environments["prod"].WaitingApproval.Revision).To(Equal(""))
+}
+
+func TestApprovalSuspended(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	p := buildTestPipeline()
+	p.Spec.Promotion = &v1alpha1.Promotion{
+		Strategy: v1alpha1.Strategy{
+			Notification: &v1alpha1.NotificationPromotion{},
+		},
+	}
+	p.Spec.Environments[1].Suspend = true
+	p = createPipeline(g, t, p)
+
+	setWaitingApproval(g, t, p)
+
+	strat := introspectableStrategy{}
+	stratReg := strategy.StrategyRegistry{&strat}
+
+	h := server.NewDefaultApprovalHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient)
+	resp := requestTo(g, h, http.MethodPost, "/default/app/prod/5.0.0", nil, nil)
+	g.Expect(resp.Code).To(Equal(http.StatusConflict))
+	g.Expect(resp.Body.String()).To(Equal("promotions to environment prod are suspended"))
+	g.Expect(strat.promotions).To(BeEmpty())
+}
+
 func setWaitingApproval(g *WithT, t *testing.T, p v1alpha1.Pipeline) v1alpha1.Pipeline {
 	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &p)).To(Succeed())
 
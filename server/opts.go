@@ -52,3 +52,12 @@ func WithRetry(delay, maxDelay, threshold int) Opt {
 		return nil
 	}
 }
+
+// WithRecordApprovalOnly makes the default approval handler record approvals in the pipeline's status, leaving the
+// promotion to the level-triggered controller.
+func WithRecordApprovalOnly() Opt {
+	return func(s *PromotionServer) error {
+		s.recordApprovalOnly = true
+		return nil
+	}
+}
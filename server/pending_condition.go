@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pipelinev1alpha1 "github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/pkg/conditions"
+)
+
+// setPendingCondition marks promotion of the pipeline as pending for the reason given, e.g. because of a freeze.
+func setPendingCondition(ctx context.Context, c client.Client, pipeline pipelinev1alpha1.Pipeline, reason, message string) error {
+	return updateStatus(ctx, c, &pipeline, func(status *pipelinev1alpha1.PipelineStatus) {
+		apimeta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    conditions.PromotionPendingCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: trimString(message, pipelinev1alpha1.MaxConditionMessageLength),
+		})
+	})
+}
+
+// clearPendingCondition removes the pending condition from the pipeline if it was set by the promotion webhook, i.e.,
+// for one of the reasons given.
+func clearPendingCondition(ctx context.Context, c client.Client, pipeline pipelinev1alpha1.Pipeline, reasons ...string) error {
+	if !isPendingFor(pipeline.Status, reasons) {
+		return nil
+	}
+
+	return updateStatus(ctx, c, &pipeline, func(status *pipelinev1alpha1.PipelineStatus) {
+		if isPendingFor(*status, reasons) {
+			apimeta.RemoveStatusCondition(&status.Conditions, conditions.PromotionPendingCondition)
+		}
+	})
+}
+
+func isPendingFor(status pipelinev1alpha1.PipelineStatus, reasons []string) bool {
+	cond := apimeta.FindStatusCondition(status.Conditions, conditions.PromotionPendingCondition)
+	if cond == nil {
+		return false
+	}
+
+	for _, reason := range reasons {
+		if cond.Reason == reason {
+			return true
+		}
+	}
+
+	return false
+}
@@ -8,15 +8,21 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"strings"
+	"time"
 
 	events "github.com/fluxcd/pkg/apis/event/v1beta1"
 	"github.com/fluxcd/pkg/runtime/logger"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	pipelinev1alpha1 "github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/tracing"
+	"github.com/weaveworks/pipeline-controller/pkg/freeze"
 	"github.com/weaveworks/pipeline-controller/pkg/retry"
 	"github.com/weaveworks/pipeline-controller/server/strategy"
 )
@@ -61,6 +67,14 @@ func (h DefaultPromotionHandler) ServeHTTP(rw http.ResponseWriter, r *http.Reque
 	}
 	env := pathMatches[3]
 
+	ctx, span := tracing.Start(r.Context(), "DefaultPromotionHandler.ServeHTTP",
+		attribute.String("pipeline.namespace", promotion.PipelineNamespace),
+		attribute.String("pipeline.name", promotion.PipelineName),
+		attribute.String("pipeline.source_environment", env),
+	)
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		h.log.V(logger.DebugLevel).Error(err, "reading request body")
@@ -98,52 +112,163 @@ func (h DefaultPromotionHandler) ServeHTTP(rw http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	promEnv, err := lookupNextEnvironment(pipeline, env, ev.InvolvedObject)
+	promEnvs, err := lookupNextEnvironments(pipeline, env, ev.InvolvedObject)
 	if err != nil {
-		h.log.Error(err, "error looking up next environment")
+		h.log.Error(err, "error looking up next environments")
 		rw.WriteHeader(http.StatusUnprocessableEntity)
 		template.HTMLEscape(rw, []byte(err.Error()))
 		return
 	}
-	promotion.Environment = *promEnv
 
-	promSpec := pipeline.Spec.GetPromotion(promEnv.Name)
-
-	if promSpec == nil {
-		h.log.Error(err, "no promotion configured in Pipeline resource")
+	// Keep track of the revision each environment reports, so that an environment depending on more than one other environment
+	// is only promoted to once all of them have reached the same revision.
+	if err := updateStatus(r.Context(), h.c, &pipeline, func(status *pipelinev1alpha1.PipelineStatus) {
+		status.SetLastReportedRevision(env, promotion.Version)
+	}); err != nil {
+		h.log.Error(err, "error recording reported revision", "env", env)
 		rw.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(rw, "error promoting application, please consult the promotion server's logs")
 		return
 	}
 
-	if promSpec.Manual {
-		if err := h.setWaitingApproval(r.Context(), pipeline, promEnv.Name, promotion.Version); err != nil {
-			h.log.Error(err, "error setting waiting approval", "env", promEnv.Name)
+	var (
+		candidates int
+		locations  []string
+		failed     bool
+		frozen     []string
+		suspended  []string
+	)
+
+	for _, promEnv := range promEnvs {
+		if !dependenciesReached(pipeline, promEnv.Name, promotion.Version) {
+			h.log.Info("not all dependencies have reached the revision yet", "target environment", promEnv.Name, "revision", promotion.Version)
+			continue
+		}
+		candidates++
+
+		// the revision reported above is still recorded, so that promotion can carry on from where it was once resumed.
+		if pipeline.Spec.IsSuspended(promEnv.Name) {
+			h.log.Info("promotion is suspended", "target environment", promEnv.Name, "revision", promotion.Version)
+			suspended = append(suspended, promEnv.Name)
+			continue
+		}
+
+		promotion.Environment = promEnv
+		promotion.ServiceAccountName = pipeline.Spec.ServiceAccountName
+
+		promSpec := pipeline.Spec.GetPromotion(promEnv.Name)
+
+		if promSpec == nil {
+			h.log.Error(err, "no promotion configured in Pipeline resource")
 			rw.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(rw, "error promoting application, please consult the promotion server's logs")
 			return
 		}
 
-		rw.WriteHeader(http.StatusNoContent)
-		return
-	}
+		if promSpec.Manual {
+			if err := h.setWaitingApproval(r.Context(), pipeline, promEnv.Name, promotion.Version); err != nil {
+				h.log.Error(err, "error setting waiting approval", "env", promEnv.Name)
+				rw.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(rw, "error promoting application, please consult the promotion server's logs")
+				return
+			}
 
-	h.log.Info("promoting app", "app", pipeline.Spec.AppRef, "source environment", env, "target environment", promotion.Environment.Name)
+			continue
+		}
 
-	res, err := h.promote(r.Context(), promSpec, promotion)
-	if err != nil {
-		h.log.Error(err, "error promoting application")
+		// nothing is promoted during a freeze. The caller is told which environments are frozen, but not with an error,
+		// since a retry would run the strategies again for the environments that were promoted.
+		isFrozen, until, err := freeze.Check(pipeline.Spec.GetFreezeWindows(promEnv.Name), time.Now())
+		if err != nil {
+			h.log.Error(err, "error checking freeze windows", "env", promEnv.Name)
+			rw.WriteHeader(http.StatusUnprocessableEntity)
+			template.HTMLEscape(rw, []byte(err.Error()))
+			return
+		}
+		if isFrozen {
+			h.log.Info("promotion is frozen", "target environment", promEnv.Name, "revision", promotion.Version, "until", until)
+			message := fmt.Sprintf("Promotion of revision %s to environment %s is frozen until %s", promotion.Version, promEnv.Name, until.UTC().Format(time.RFC3339))
+			if err := setPendingCondition(r.Context(), h.c, pipeline, pipelinev1alpha1.FrozenReason, message); err != nil {
+				h.log.Error(err, "error setting frozen condition", "env", promEnv.Name)
+			}
+			frozen = append(frozen, fmt.Sprintf("promotion to environment %s is frozen until %s", promEnv.Name, until.UTC().Format(time.RFC3339)))
+			continue
+		}
+
+		// a caller retrying after the promotion to another environment failed gets the same response for this one, without
+		// the strategy being run again.
+		if record := succeededPromotion(pipeline, promEnv.Name, promotion.Version); record != nil {
+			h.log.Info("revision already promoted", "target environment", promEnv.Name, "revision", promotion.Version)
+			if record.Location != "" {
+				locations = append(locations, record.Location)
+			}
+			continue
+		}
+
+		h.log.Info("promoting app", "app", pipeline.Spec.AppRef, "source environment", env, "target environment", promotion.Environment.Name)
+
+		startedAt := metav1.Now()
+		res, err := h.promote(r.Context(), promSpec, promotion)
+
+		// failing to record the promotion is not reported to the caller, since that would lead to the promotion being retried.
+		record := newPromotionRecord(env, *promSpec, promotion, startedAt, res, err)
+		if recErr := recordPromotion(r.Context(), h.c, pipeline, record); recErr != nil {
+			h.log.Error(recErr, "error recording promotion history", "env", promEnv.Name)
+		}
+
+		if err != nil {
+			h.log.Error(err, "error promoting application", "env", promEnv.Name)
+			failed = true
+			continue
+		}
+
+		if res.Location != "" {
+			locations = append(locations, res.Location)
+		}
+	}
+
+	if failed {
 		rw.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(rw, "error promoting application, please consult the promotion server's logs")
 		return
 	}
 
-	if res.Location != "" {
-		rw.Header().Add("Location", res.Location)
+	for _, location := range locations {
+		rw.Header().Add("Location", location)
+	}
+
+	if len(suspended) > 0 {
+		envs := strings.Join(suspended, ", ")
+		if err := setPendingCondition(r.Context(), h.c, pipeline, pipelinev1alpha1.SuspendedReason, fmt.Sprintf("Promotions to environment %s are suspended", envs)); err != nil {
+			h.log.Error(err, "error setting suspended condition")
+		}
+		// it's only a conflict if there was nothing else to do.
+		if len(suspended) == candidates {
+			rw.WriteHeader(http.StatusConflict)
+			template.HTMLEscape(rw, []byte(fmt.Sprintf("promotions to environment %s are suspended", envs)))
+			return
+		}
+	} else if len(frozen) == 0 {
+		if err := clearPendingCondition(r.Context(), h.c, pipeline, pipelinev1alpha1.FrozenReason, pipelinev1alpha1.SuspendedReason); err != nil {
+			h.log.Error(err, "error clearing pending condition")
+		}
+	}
+
+	// the environments that were skipped are listed in the body, alongside the locations of those promoted to.
+	skipped := frozen
+	for _, env := range suspended {
+		skipped = append(skipped, fmt.Sprintf("promotion to environment %s is suspended", env))
+	}
+
+	switch {
+	case len(locations) > 0:
 		rw.WriteHeader(http.StatusCreated)
-	} else {
+	case len(skipped) > 0:
+		rw.WriteHeader(http.StatusAccepted)
+	default:
 		rw.WriteHeader(http.StatusNoContent)
 	}
+	template.HTMLEscape(rw, []byte(strings.Join(skipped, "\n")))
 }
 
 func (h DefaultPromotionHandler) setWaitingApproval(ctx context.Context, pipeline pipelinev1alpha1.Pipeline, env string, revision string) error {
@@ -162,7 +287,13 @@ func (h DefaultPromotionHandler) promote(ctx context.Context, promotionSpec *pip
 		return nil, fmt.Errorf("no promotion configured in Pipeline resource")
 	}
 
-	var res *strategy.PromotionResult
+	ctx, span := tracing.Start(ctx, "retry.Exponential", tracing.PromotionAttributes(
+		prom.PipelineNamespace, prom.PipelineName, prom.Environment.Name, prom.Version)...)
+
+	var (
+		res     *strategy.PromotionResult
+		attempt int
+	)
 
 	err := retry.Exponential(
 		retry.WithRetries(h.retry.Threshold),
@@ -174,47 +305,66 @@ func (h DefaultPromotionHandler) promote(ctx context.Context, promotionSpec *pip
 			return false
 		}),
 		retry.WithFn(func() error {
+			attempt++
+			ctx, span := tracing.Start(ctx, "strategy.Promote", attribute.Int("retry.attempt", attempt))
+
 			strat, err := h.stratReg.Get(*promotionSpec)
 			if err != nil {
-				return fmt.Errorf("error getting strategy from registry: %w", err)
+				return tracing.End(span, fmt.Errorf("error getting strategy from registry: %w", err))
 			}
 
 			res, err = strat.Promote(ctx, *promotionSpec, prom)
-			return err
+			return tracing.End(span, err)
 		}),
 	)
 
-	return res, err
+	return res, tracing.End(span, err)
 }
 
-// lookupNextEnvironment searches the pipeline for the given environment name and returns the subsequent environment. The given pipeline's appRef
-// needs to match the given object reference and the environment pointed to by "env" needs to have at least one target with the appRef's namespace.
-// This ensures that promotion can only be triggered by objects residing in a namespace that is part of an environment's target.
-func lookupNextEnvironment(pipeline pipelinev1alpha1.Pipeline, env string, appRef corev1.ObjectReference) (*pipelinev1alpha1.Environment, error) {
+// lookupNextEnvironments searches the pipeline for the given environment name and returns the environments depending on it. The environment
+// pointed to by "env" needs to have at least one target with the given object reference's namespace whose appRef (the pipeline's appRef, with
+// any overrides from the target applied) matches the object reference. This ensures that promotion can only be triggered by objects residing in
+// a namespace that is part of an environment's target.
+func lookupNextEnvironments(pipeline pipelinev1alpha1.Pipeline, env string, appRef corev1.ObjectReference) ([]pipelinev1alpha1.Environment, error) {
+	if err := pipeline.Spec.ValidateDependencies(); err != nil {
+		return nil, err
+	}
+
 	var sourceEnv *pipelinev1alpha1.Environment
-	var promEnv *pipelinev1alpha1.Environment
 	for idx, pEnv := range pipeline.Spec.Environments {
 		if pEnv.Name == env {
-			if idx == len(pipeline.Spec.Environments)-1 {
-				return nil, fmt.Errorf("cannot promote beyond last environment %s", pEnv.Name)
-			}
 			sourceEnv = &pipeline.Spec.Environments[idx]
-			promEnv = &pipeline.Spec.Environments[idx+1]
 			break
 		}
 	}
-	if promEnv == nil {
+	if sourceEnv == nil {
 		return nil, fmt.Errorf("app %s/%s has no environment %s defined", pipeline.Namespace, pipeline.Name, env)
 	}
-	if len(promEnv.Targets) == 0 {
-		return nil, fmt.Errorf("environment %s has no targets", promEnv.Name)
+
+	promEnvs := pipeline.Spec.GetDependents(env)
+	if len(promEnvs) == 0 {
+		return nil, fmt.Errorf("cannot promote beyond last environment %s", env)
+	}
+	for _, promEnv := range promEnvs {
+		if len(promEnv.Targets) == 0 {
+			return nil, fmt.Errorf("environment %s has no targets", promEnv.Name)
+		}
 	}
 
-	if pipeline.Spec.AppRef.APIVersion != appRef.APIVersion ||
-		pipeline.Spec.AppRef.Kind != appRef.Kind ||
-		pipeline.Spec.AppRef.Name != appRef.Name ||
-		!namespaceInTargets(sourceEnv.Targets, appRef.Namespace) {
+	if !appInTargets(pipeline.Spec.AppRef, sourceEnv.Targets, appRef) {
 		return nil, fmt.Errorf("involved object does not match Pipeline definition")
 	}
-	return promEnv, nil
+	return promEnvs, nil
+}
+
+// dependenciesReached returns true if all the environments the given environment depends on have last reported the revision given.
+func dependenciesReached(pipeline pipelinev1alpha1.Pipeline, env string, revision string) bool {
+	for _, dep := range pipeline.Spec.GetDependencies(env) {
+		status, ok := pipeline.Status.Environments[dep]
+		if !ok || status == nil || status.LastReportedRevision != revision {
+			return false
+		}
+	}
+
+	return true
 }
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	events "github.com/fluxcd/pkg/apis/event/v1beta1"
 	"github.com/fluxcd/pkg/apis/meta"
@@ -17,11 +18,13 @@ import (
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
 	"github.com/weaveworks/pipeline-controller/internal/testingutils"
+	"github.com/weaveworks/pipeline-controller/pkg/conditions"
 	"github.com/weaveworks/pipeline-controller/server"
 	"github.com/weaveworks/pipeline-controller/server/strategy"
 )
@@ -47,9 +50,10 @@ func marshalEvent(g *WithT, ev events.Event) []byte {
 }
 
 type introspectableStrategy struct {
-	promotion strategy.Promotion
-	location  string
-	err       error
+	promotion  strategy.Promotion
+	promotions []strategy.Promotion
+	location   string
+	err        error
 }
 
 func (s *introspectableStrategy) Handles(p v1alpha1.Promotion) bool {
@@ -58,6 +62,7 @@ func (s *introspectableStrategy) Handles(p v1alpha1.Promotion) bool {
 
 func (s *introspectableStrategy) Promote(ctx context.Context, promSpec v1alpha1.Promotion, prom strategy.Promotion) (*strategy.PromotionResult, error) {
 	s.promotion = prom
+	s.promotions = append(s.promotions, prom)
 	if s.err != nil {
 		return nil, s.err
 	}
@@ -292,6 +297,120 @@ func TestPromotionInvolvedObjectDoesntMatch(t *testing.T) {
 	}
 }
 
+func TestPromotionWithTargetAppRef(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+
+	p := buildTestPipeline()
+	p.Spec.Environments[0].Targets = []v1alpha1.Target{{
+		Namespace: "default",
+		AppRef: &v1alpha1.TargetAppReference{
+			Name: "app-dev",
+		},
+	}}
+	p.Spec.Promotion = &v1alpha1.Promotion{
+		Strategy: v1alpha1.Strategy{
+			Notification: &v1alpha1.NotificationPromotion{},
+		},
+	}
+	createPipeline(g, t, p)
+
+	strat := introspectableStrategy{}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	t.Run("accepts the overridden name", func(t *testing.T) {
+		ev := createEvent()
+		ev.InvolvedObject.Name = "app-dev"
+		resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, ev))
+		g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+		g.Expect(strat.promotion.Environment.Name).To(Equal("prod"))
+	})
+
+	t.Run("rejects the pipeline's app name", func(t *testing.T) {
+		resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+		g.Expect(resp.Code).To(Equal(http.StatusUnprocessableEntity))
+		g.Expect(resp.Body.String()).To(Equal("involved object does not match Pipeline definition"))
+	})
+}
+
+func TestPromotionWithDependencies(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+
+	targets := []v1alpha1.Target{{
+		Namespace: "default",
+	}}
+	p := buildTestPipeline()
+	p.Spec.Environments = []v1alpha1.Environment{
+		{
+			Name:    "dev",
+			Targets: targets,
+		},
+		{
+			Name:      "staging-eu",
+			Targets:   targets,
+			DependsOn: []string{"dev"},
+		},
+		{
+			Name:      "staging-us",
+			Targets:   targets,
+			DependsOn: []string{"dev"},
+		},
+		{
+			Name:      "prod",
+			Targets:   targets,
+			DependsOn: []string{"staging-eu", "staging-us"},
+		},
+	}
+	p.Spec.Promotion = &v1alpha1.Promotion{
+		Strategy: v1alpha1.Strategy{
+			Notification: &v1alpha1.NotificationPromotion{},
+		},
+	}
+	createPipeline(g, t, p)
+
+	strat := introspectableStrategy{}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	promotedEnvs := func() []string {
+		var envs []string
+		for _, prom := range strat.promotions {
+			envs = append(envs, prom.Environment.Name)
+		}
+		strat.promotions = nil
+		return envs
+	}
+
+	t.Run("fans out to all dependents", func(t *testing.T) {
+		resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+		g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+		g.Expect(promotedEnvs()).To(Equal([]string{"staging-eu", "staging-us"}))
+	})
+
+	t.Run("waits for all dependencies to report the revision", func(t *testing.T) {
+		resp := requestTo(g, h, http.MethodPost, "/default/app/staging-eu", nil, marshalEvent(g, createEvent()))
+		g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+		g.Expect(promotedEnvs()).To(BeEmpty())
+
+		resp = requestTo(g, h, http.MethodPost, "/default/app/staging-us", nil, marshalEvent(g, createEvent()))
+		g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+		g.Expect(promotedEnvs()).To(Equal([]string{"prod"}))
+	})
+}
+
+func TestPromotionWithDependencyCycle(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+
+	p := buildTestPipeline()
+	p.Spec.Environments[0].DependsOn = []string{"prod"}
+	createPipeline(g, t, p)
+
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), nil, k8sClient, testRetryOpts())
+	resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+	g.Expect(resp.Code).To(Equal(http.StatusUnprocessableEntity))
+	g.Expect(resp.Body.String()).To(Equal("environments form a dependency cycle: dev -&gt; prod -&gt; dev"))
+}
+
 func TestPromotionBeyondLastEnv(t *testing.T) {
 	g := testingutils.NewGomegaWithT(t)
 	createTestPipeline(g, t)
@@ -386,6 +505,370 @@ func TestPromotionFails(t *testing.T) {
 	g.Expect(strat.promotion).To(Equal(expectedProm))
 }
 
+func TestPromotionRecordsHistory(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	p := createTestPipelineWithPromotion(g, t)
+
+	strat := introspectableStrategy{
+		location: "success",
+	}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+	g.Expect(resp.Code).To(Equal(http.StatusCreated))
+
+	strat.err = fmt.Errorf("this didn't work")
+	ev := createEvent()
+	ev.Metadata["revision"] = "5.0.1"
+	resp = requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, ev))
+	g.Expect(resp.Code).To(Equal(http.StatusInternalServerError))
+
+	updatedPipeline := v1alpha1.Pipeline{}
+	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+
+	history := updatedPipeline.Status.Environments["prod"].PromotionHistory
+	g.Expect(history).To(HaveLen(2))
+
+	// newest first
+	g.Expect(history[0].Revision).To(Equal("5.0.1"))
+	g.Expect(history[0].Outcome).To(Equal(v1alpha1.PromotionFailed))
+	g.Expect(history[0].Error).To(Equal("this didn't work"))
+
+	g.Expect(history[1].SourceEnvironment).To(Equal("dev"))
+	g.Expect(history[1].TargetEnvironment).To(Equal("prod"))
+	g.Expect(history[1].Revision).To(Equal("5.0.0"))
+	g.Expect(history[1].Strategy).To(Equal("pull-request"))
+	g.Expect(history[1].Outcome).To(Equal(v1alpha1.PromotionSucceeded))
+	g.Expect(history[1].Location).To(Equal("success"))
+	g.Expect(history[1].StartedAt.IsZero()).To(BeFalse())
+	g.Expect(history[1].CompletedAt.IsZero()).To(BeFalse())
+}
+
+func TestPromotionRetriedAfterPartialFailure(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+
+	targets := []v1alpha1.Target{{
+		Namespace: "default",
+	}}
+	p := buildTestPipeline()
+	p.Spec.Environments = []v1alpha1.Environment{
+		{
+			Name:    "dev",
+			Targets: targets,
+		},
+		{
+			Name:      "staging-eu",
+			Targets:   targets,
+			DependsOn: []string{"dev"},
+		},
+		{
+			Name:      "staging-us",
+			Targets:   targets,
+			DependsOn: []string{"dev"},
+		},
+	}
+	p.Spec.Promotion = &v1alpha1.Promotion{
+		Strategy: v1alpha1.Strategy{
+			Notification: &v1alpha1.NotificationPromotion{},
+		},
+	}
+	createPipeline(g, t, p)
+
+	strat := failingEnvStrategy{failEnv: "staging-us"}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+	g.Expect(resp.Code).To(Equal(http.StatusInternalServerError))
+	g.Expect(strat.promoted).To(Equal([]string{"staging-eu", "staging-us"}))
+
+	// the retry only runs the strategy for the environment that failed.
+	strat.promoted, strat.failEnv = nil, ""
+	resp = requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+	g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+	g.Expect(strat.promoted).To(Equal([]string{"staging-us"}))
+}
+
+func TestPromotionOfEarlierRevision(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	createTestPipelineWithPromotion(g, t)
+
+	strat := failingEnvStrategy{}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	// going back to a revision promoted before another one, e.g. on a revert, promotes it again.
+	for _, revision := range []string{"5.0.0", "5.0.1", "5.0.0"} {
+		ev := createEvent()
+		ev.Metadata["revision"] = revision
+		resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, ev))
+		g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+	}
+	g.Expect(strat.promoted).To(Equal([]string{"prod", "prod", "prod"}))
+}
+
+// failingEnvStrategy fails promotions into one environment, and records the environments promoted to.
+type failingEnvStrategy struct {
+	failEnv  string
+	promoted []string
+}
+
+func (s *failingEnvStrategy) Handles(p v1alpha1.Promotion) bool {
+	return true
+}
+
+func (s *failingEnvStrategy) Promote(ctx context.Context, promSpec v1alpha1.Promotion, prom strategy.Promotion) (*strategy.PromotionResult, error) {
+	s.promoted = append(s.promoted, prom.Environment.Name)
+	if prom.Environment.Name == s.failEnv {
+		return nil, fmt.Errorf("promotion to %s failed", s.failEnv)
+	}
+	return &strategy.PromotionResult{}, nil
+}
+
+func TestPromotionHistoryIsBounded(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+	p := createTestPipelineWithPromotion(g, t)
+
+	strat := introspectableStrategy{}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	for i := 0; i < v1alpha1.MaxPromotionHistory+2; i++ {
+		ev := createEvent()
+		ev.Metadata["revision"] = fmt.Sprintf("5.0.%d", i)
+		resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, ev))
+		g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+	}
+
+	updatedPipeline := v1alpha1.Pipeline{}
+	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+
+	history := updatedPipeline.Status.Environments["prod"].PromotionHistory
+	g.Expect(history).To(HaveLen(v1alpha1.MaxPromotionHistory))
+	g.Expect(history[0].Revision).To(Equal(fmt.Sprintf("5.0.%d", v1alpha1.MaxPromotionHistory+1)))
+	g.Expect(history[len(history)-1].Revision).To(Equal("5.0.2"))
+}
+
+func TestPromotionFrozen(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+
+	p := buildTestPipeline()
+	p.Spec.Promotion = &v1alpha1.Promotion{
+		Strategy: v1alpha1.Strategy{
+			Notification: &v1alpha1.NotificationPromotion{},
+		},
+	}
+	// a window starting every hour and lasting an hour is always in force.
+	p.Spec.Environments[1].FreezeWindows = []v1alpha1.FreezeWindow{{
+		Schedule: "0 * * * *",
+		Duration: metav1.Duration{Duration: time.Hour},
+	}}
+	p = createPipeline(g, t, p)
+
+	strat := introspectableStrategy{}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+	g.Expect(resp.Code).To(Equal(http.StatusAccepted))
+	g.Expect(resp.Body.String()).To(HavePrefix("promotion to environment prod is frozen until "))
+	g.Expect(strat.promotions).To(BeEmpty())
+
+	var updatedPipeline v1alpha1.Pipeline
+	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+	cond := apimeta.FindStatusCondition(updatedPipeline.Status.Conditions, conditions.PromotionPendingCondition)
+	g.Expect(cond).NotTo(BeNil())
+	g.Expect(cond.Reason).To(Equal(v1alpha1.FrozenReason))
+
+	// once there's no freeze, the promotion goes ahead and the condition is cleared.
+	updatedPipeline.Spec.Environments[1].FreezeWindows = nil
+	g.Expect(k8sClient.Update(context.Background(), &updatedPipeline)).To(Succeed())
+
+	resp = requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+	g.Expect(resp.Code).To(Equal(http.StatusNoContent))
+	g.Expect(strat.promotions).To(HaveLen(1))
+
+	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+	g.Expect(apimeta.FindStatusCondition(updatedPipeline.Status.Conditions, conditions.PromotionPendingCondition)).To(BeNil())
+}
+
+func TestPromotionPartlyFrozen(t *testing.T) {
+	g := testingutils.NewGomegaWithT(t)
+
+	targets := []v1alpha1.Target{{
+		Namespace: "default",
+	}}
+	p := buildTestPipeline()
+	p.Spec.Environments = []v1alpha1.Environment{
+		{
+			Name:    "dev",
+			Targets: targets,
+		},
+		{
+			Name:      "staging",
+			Targets:   targets,
+			DependsOn: []string{"dev"},
+		},
+		{
+			Name:      "prod",
+			Targets:   targets,
+			DependsOn: []string{"dev"},
+			FreezeWindows: []v1alpha1.FreezeWindow{{
+				Schedule: "0 * * * *",
+				Duration: metav1.Duration{Duration: time.Hour},
+			}},
+		},
+	}
+	p.Spec.Promotion = &v1alpha1.Promotion{
+		Strategy: v1alpha1.Strategy{
+			Notification: &v1alpha1.NotificationPromotion{},
+		},
+	}
+	createPipeline(g, t, p)
+
+	strat := introspectableStrategy{location: "https://example.com/pulls/1"}
+	stratReg := strategy.StrategyRegistry{&strat}
+	h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+	// the frozen environment is reported without an error, so that the caller doesn't retry the promotion to the other,
+	// which is reported with its location.
+	resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+	g.Expect(resp.Code).To(Equal(http.StatusCreated))
+	g.Expect(resp.Header().Values("Location")).To(Equal([]string{"https://example.com/pulls/1"}))
+	g.Expect(resp.Body.String()).To(HavePrefix("promotion to environment prod is frozen until "))
+	g.Expect(strat.promotions).To(HaveLen(1))
+	g.Expect(strat.promotions[0].Environment.Name).To(Equal("staging"))
+}
+
+func TestPromotionSuspended(t *testing.T) {
+	tests := []struct {
+		name    string
+		suspend func(p *v1alpha1.Pipeline)
+	}{
+		{
+			name:    "pipeline suspended",
+			suspend: func(p *v1alpha1.Pipeline) { p.Spec.Suspend = true },
+		},
+		{
+			name:    "environment suspended",
+			suspend: func(p *v1alpha1.Pipeline) { p.Spec.Environments[1].Suspend = true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testingutils.NewGomegaWithT(t)
+
+			p := buildTestPipeline()
+			p.Spec.Promotion = &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			}
+			tt.suspend(&p)
+			p = createPipeline(g, t, p)
+
+			strat := introspectableStrategy{}
+			stratReg := strategy.StrategyRegistry{&strat}
+			h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+			resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+			g.Expect(resp.Code).To(Equal(http.StatusConflict))
+			g.Expect(resp.Body.String()).To(Equal("promotions to environment prod are suspended"))
+			g.Expect(strat.promotions).To(BeEmpty())
+
+			// the reported revision is still recorded
+			var updatedPipeline v1alpha1.Pipeline
+			g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+			g.Expect(updatedPipeline.Status.Environments["dev"].LastReportedRevision).To(Equal("5.0.0"))
+			cond := apimeta.FindStatusCondition(updatedPipeline.Status.Conditions, conditions.PromotionPendingCondition)
+			g.Expect(cond).NotTo(BeNil())
+			g.Expect(cond.Reason).To(Equal(v1alpha1.SuspendedReason))
+		})
+	}
+}
+
+func TestPromotionPartlySuspended(t *testing.T) {
+	targets := []v1alpha1.Target{{
+		Namespace: "default",
+	}}
+	alwaysFrozen := []v1alpha1.FreezeWindow{{
+		Schedule: "0 * * * *",
+		Duration: metav1.Duration{Duration: time.Hour},
+	}}
+
+	tests := []struct {
+		name          string
+		stagingFrozen bool
+		expectedCode  int
+		expectedBody  []string
+	}{
+		{
+			name:         "other environment promoted",
+			expectedCode: http.StatusCreated,
+			expectedBody: []string{"promotion to environment prod is suspended"},
+		},
+		{
+			name:          "other environment frozen",
+			stagingFrozen: true,
+			expectedCode:  http.StatusAccepted,
+			expectedBody:  []string{"promotion to environment staging is frozen until ", "promotion to environment prod is suspended"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testingutils.NewGomegaWithT(t)
+
+			p := buildTestPipeline()
+			p.Spec.Environments = []v1alpha1.Environment{
+				{
+					Name:    "dev",
+					Targets: targets,
+				},
+				{
+					Name:      "staging",
+					Targets:   targets,
+					DependsOn: []string{"dev"},
+				},
+				{
+					Name:      "prod",
+					Targets:   targets,
+					DependsOn: []string{"dev"},
+					Suspend:   true,
+				},
+			}
+			if tt.stagingFrozen {
+				p.Spec.Environments[1].FreezeWindows = alwaysFrozen
+			}
+			p.Spec.Promotion = &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					Notification: &v1alpha1.NotificationPromotion{},
+				},
+			}
+			p = createPipeline(g, t, p)
+
+			strat := introspectableStrategy{location: "https://example.com/pulls/1"}
+			stratReg := strategy.StrategyRegistry{&strat}
+			h := server.NewDefaultPromotionHandler(logger.NewLogger(logger.Options{LogLevel: "trace"}), stratReg, k8sClient, testRetryOpts())
+
+			resp := requestTo(g, h, http.MethodPost, "/default/app/dev", nil, marshalEvent(g, createEvent()))
+			g.Expect(resp.Code).To(Equal(tt.expectedCode))
+			for _, expected := range tt.expectedBody {
+				g.Expect(resp.Body.String()).To(ContainSubstring(expected))
+			}
+
+			// the suspended environment is reported in the status, whatever happened to the other.
+			var updatedPipeline v1alpha1.Pipeline
+			g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(&p), &updatedPipeline)).To(Succeed())
+			cond := apimeta.FindStatusCondition(updatedPipeline.Status.Conditions, conditions.PromotionPendingCondition)
+			g.Expect(cond).NotTo(BeNil())
+			g.Expect(cond.Reason).To(Equal(v1alpha1.SuspendedReason))
+		})
+	}
+}
+
 func TestPromotionWithoutLocation(t *testing.T) {
 	g := testingutils.NewGomegaWithT(t)
 	createTestPipelineWithPromotion(g, t)
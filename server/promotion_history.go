@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pipelinev1alpha1 "github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/metrics"
+	"github.com/weaveworks/pipeline-controller/server/strategy"
+)
+
+// newPromotionRecord returns a record of the promotion given, started at the given time and completed now. A
+// non-nil error marks the promotion as failed.
+func newPromotionRecord(sourceEnv string, promSpec pipelinev1alpha1.Promotion, prom strategy.Promotion, startedAt metav1.Time, res *strategy.PromotionResult, err error) pipelinev1alpha1.PromotionRecord {
+	record := pipelinev1alpha1.PromotionRecord{
+		SourceEnvironment: sourceEnv,
+		TargetEnvironment: prom.Environment.Name,
+		Revision:          prom.Version,
+		Strategy:          promSpec.Strategy.Type(),
+		StartedAt:         startedAt,
+		CompletedAt:       metav1.Now(),
+		Outcome:           pipelinev1alpha1.PromotionSucceeded,
+	}
+
+	if err != nil {
+		record.Outcome = pipelinev1alpha1.PromotionFailed
+		record.Error = trimString(err.Error(), pipelinev1alpha1.MaxConditionMessageLength)
+	}
+	if res != nil {
+		record.Location = res.Location
+	}
+
+	return record
+}
+
+// recordPromotion adds the given record to the promotion history in the status of the pipeline, and to the promotion
+// metrics.
+func recordPromotion(ctx context.Context, c client.Client, pipeline pipelinev1alpha1.Pipeline, record pipelinev1alpha1.PromotionRecord) error {
+	metrics.RecordPromotion(record)
+	return updateStatus(ctx, c, &pipeline, func(status *pipelinev1alpha1.PipelineStatus) {
+		status.AddPromotionRecord(record)
+	})
+}
+
+// succeededPromotion returns the record of the last successful promotion into the environment given if it promoted the
+// revision given, or nil otherwise. Only the last one counts, so that a revision promoted again after another one, e.g.
+// when a change is reverted, is not taken for a retry.
+func succeededPromotion(pipeline pipelinev1alpha1.Pipeline, env, revision string) *pipelinev1alpha1.PromotionRecord {
+	status, ok := pipeline.Status.Environments[env]
+	if !ok || status == nil {
+		return nil
+	}
+	for i, record := range status.PromotionHistory {
+		if record.Outcome != pipelinev1alpha1.PromotionSucceeded {
+			continue
+		}
+		if record.Revision == revision && !record.Rollback {
+			return &status.PromotionHistory[i]
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// updateStatus fetches the latest version of the pipeline given, applies the given mutation to its status and updates it,
+// retrying on conflicts. The pipeline is left with the updated value.
+func updateStatus(ctx context.Context, c client.Client, pipeline *pipelinev1alpha1.Pipeline, mutate func(*pipelinev1alpha1.PipelineStatus)) error {
+	key := client.ObjectKeyFromObject(pipeline)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, key, pipeline); err != nil {
+			return err
+		}
+
+		mutate(&pipeline.Status)
+
+		return c.Status().Update(ctx, pipeline)
+	})
+}
+
+func trimString(str string, limit int) string {
+	if len(str) <= limit {
+		return str
+	}
+
+	return str[0:limit] + "..."
+}
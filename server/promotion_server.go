@@ -13,10 +13,13 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/go-logr/stdr"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
 	pipelinev1alpha1 "github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/metrics"
 	"github.com/weaveworks/pipeline-controller/pkg/ratelimiter"
 	"github.com/weaveworks/pipeline-controller/server/strategy"
 )
@@ -41,6 +44,7 @@ type PromotionServer struct {
 	stratReg             strategy.StrategyRegistry
 	rateLimit            rateLimit
 	retry                RetryOpts
+	recordApprovalOnly   bool
 }
 
 type rateLimit struct {
@@ -123,10 +127,15 @@ func setDefaults(s *PromotionServer) {
 	}
 
 	if s.approvalHandler == nil {
+		var opts []ApprovalHandlerOpt
+		if s.recordApprovalOnly {
+			opts = append(opts, RecordApprovalOnly())
+		}
 		s.approvalHandler = NewDefaultApprovalHandler(
 			s.log.WithName("handler"),
 			s.stratReg,
 			s.c,
+			opts...,
 		)
 	}
 	if s.approvalEndpointName == "" {
@@ -156,6 +165,7 @@ func (s PromotionServer) rateLimitMiddleware(limiter *ratelimiter.Limiter, h htt
 		ip := getRealIP(r)
 		if limit, err := limiter.Hit(ip); err != nil {
 			log.Error(err, "rate limit hit", "ip", ip)
+			metrics.RecordRateLimited()
 			w.Header().Add("Retry-After", limit.Created.Add(limiter.Duration).Format(time.RFC1123))
 			w.WriteHeader(http.StatusTooManyRequests)
 			return
@@ -175,16 +185,27 @@ func (s PromotionServer) Start(ctx context.Context) error {
 	)
 
 	mux := http.NewServeMux()
+	// otelhttp continues any trace the caller propagated in the request headers.
 	mux.Handle(promPathPrefix,
-		s.rateLimitMiddleware(
-			limiter,
-			http.StripPrefix(s.promEndpointName, s.promHandler),
+		otelhttp.NewHandler(
+			metrics.InstrumentWebhook("promotion",
+				s.rateLimitMiddleware(
+					limiter,
+					http.StripPrefix(s.promEndpointName, s.promHandler),
+				),
+			),
+			"promotion",
 		),
 	)
 	mux.Handle(approvalPathPrefix,
-		s.rateLimitMiddleware(
-			limiter,
-			http.StripPrefix(s.approvalEndpointName, s.approvalHandler),
+		otelhttp.NewHandler(
+			metrics.InstrumentWebhook("approval",
+				s.rateLimitMiddleware(
+					limiter,
+					http.StripPrefix(s.approvalEndpointName, s.approvalHandler),
+				),
+			),
+			"approval",
 		),
 	)
 	mux.Handle("/healthz", healthz.CheckHandler{Checker: healthz.Ping})
@@ -212,10 +233,15 @@ func (s PromotionServer) Start(ctx context.Context) error {
 	return srv.Shutdown(ctx)
 }
 
-// namespaceInTargets returns true if the given namespace name is declared in at least one of the given targets.
-func namespaceInTargets(targets []pipelinev1alpha1.Target, namespace string) bool {
+// appInTargets returns true if the given object reference is the app of at least one of the given targets, taking into
+// account the target's overrides of the pipeline's appRef.
+func appInTargets(pipelineAppRef pipelinev1alpha1.LocalAppReference, targets []pipelinev1alpha1.Target, obj corev1.ObjectReference) bool {
 	for _, t := range targets {
-		if t.Namespace == namespace {
+		if t.Namespace != obj.Namespace {
+			continue
+		}
+		appRef := t.ResolveAppRef(pipelineAppRef)
+		if appRef.APIVersion == obj.APIVersion && appRef.Kind == obj.Kind && appRef.Name == obj.Name {
 			return true
 		}
 	}
@@ -0,0 +1,115 @@
+package pullrequest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
+	"github.com/weaveworks/pipeline-controller/internal/git"
+	"github.com/weaveworks/pipeline-controller/server/strategy/pullrequest"
+)
+
+// recordingProvider is a git.Provider that lists the pull requests given, and records which are closed and which branches
+// are deleted.
+type recordingProvider struct {
+	git.Provider
+
+	prs             []*git.PullRequest
+	closed          []int
+	deletedBranches []string
+}
+
+func (p *recordingProvider) ListPullRequests(context.Context, string) ([]*git.PullRequest, error) {
+	return p.prs, nil
+}
+
+func (p *recordingProvider) ClosePullRequest(_ context.Context, _ string, number int) error {
+	p.closed = append(p.closed, number)
+	return nil
+}
+
+func (p *recordingProvider) DeleteBranch(_ context.Context, _ string, branch string) error {
+	p.deletedBranches = append(p.deletedBranches, branch)
+	return nil
+}
+
+func TestCleanup(t *testing.T) {
+	pipeline := v1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo"},
+		Spec: v1alpha1.PipelineSpec{
+			Environments: []v1alpha1.Environment{
+				{Name: "dev"},
+				{Name: "prod"},
+				{
+					Name: "staging",
+					Promotion: &v1alpha1.Promotion{
+						Strategy: v1alpha1.Strategy{Notification: &v1alpha1.NotificationPromotion{}},
+					},
+				},
+			},
+			Promotion: &v1alpha1.Promotion{
+				Strategy: v1alpha1.Strategy{
+					PullRequest: &v1alpha1.PullRequestPromotion{
+						Type:      v1alpha1.Github,
+						URL:       "https://github.com/example/podinfo",
+						SecretRef: meta.LocalObjectReference{Name: "repo-credentials"},
+					},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "repo-credentials"},
+		Data:       map[string][]byte{"token": []byte("token")},
+	}
+
+	tests := []struct {
+		name            string
+		objects         []client.Object
+		prs             []*git.PullRequest
+		closed          []int
+		deletedBranches []string
+	}{
+		{
+			name:    "closes open PRs and deletes the branches of environments using the strategy",
+			objects: []client.Object{secret},
+			prs: []*git.PullRequest{
+				{Number: 1, Source: "promotion-foo-bar-dev"},
+				{Number: 2, Source: "promotion-foo-bar-prod", Merged: true},
+				{Number: 3, Source: "promotion-foo-other-dev"},
+				{Number: 4, Source: "promotion-foo-bar-staging"},
+			},
+			closed:          []int{1},
+			deletedBranches: []string{"promotion-foo-bar-dev", "promotion-foo-bar-prod"},
+		},
+		{
+			name: "leaves everything in place without credentials",
+			prs: []*git.PullRequest{
+				{Number: 1, Source: "promotion-foo-bar-dev"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &recordingProvider{prs: tt.prs}
+			fc := fake.NewClientBuilder().WithObjects(tt.objects...).Build()
+
+			strat, err := pullrequest.New(fc, logr.Discard(), pullrequest.GitClientFactory(mockGitProviderFactory(provider)))
+			require.NoError(t, err)
+
+			require.NoError(t, strat.Cleanup(context.Background(), pipeline))
+			assert.Equal(t, tt.closed, provider.closed)
+			assert.Equal(t, tt.deletedBranches, provider.deletedBranches)
+		})
+	}
+}
@@ -122,6 +122,7 @@ func gitProviderIsValid(gitProviderType v1alpha1.GitProviderType) (bool, error)
 	case v1alpha1.BitBucketServer:
 	case v1alpha1.Github:
 	case v1alpha1.Gitlab:
+	case v1alpha1.AzureDevOps:
 		return true, nil
 	default:
 		return false, fmt.Errorf("the Git provider %q is not supported", gitProviderType)
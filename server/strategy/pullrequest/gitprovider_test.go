@@ -41,6 +41,12 @@ func Test_gitProviderIsEmpty(t *testing.T) {
 			true,
 			"",
 		},
+		{
+			"azure-devops is valid",
+			"azure-devops",
+			true,
+			"",
+		},
 	}
 
 	for _, tt := range tests {
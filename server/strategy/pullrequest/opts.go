@@ -1,5 +1,9 @@
 package pullrequest
 
+import (
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
+)
+
 type Opt func(g *PullRequest) error
 
 func GitClientFactory(cf GitProviderClientFactory) Opt {
@@ -8,3 +12,12 @@ func GitClientFactory(cf GitProviderClientFactory) Opt {
 		return nil
 	}
 }
+
+// Impersonator makes the strategy read the Secrets for a promotion as the service account of the pipeline, rather than
+// with its own client.
+func Impersonator(imp *impersonation.Impersonator) Opt {
+	return func(g *PullRequest) error {
+		g.impersonator = imp
+		return nil
+	}
+}
@@ -2,6 +2,7 @@ package pullrequest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -9,11 +10,16 @@ import (
 	"github.com/fluxcd/pkg/apis/meta"
 	fgit "github.com/fluxcd/pkg/git"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	pipelinev1alpha1 "github.com/weaveworks/pipeline-controller/api/v1alpha1"
 	"github.com/weaveworks/pipeline-controller/internal/git"
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
+	"github.com/weaveworks/pipeline-controller/internal/tracing"
 	"github.com/weaveworks/pipeline-controller/server/strategy"
 )
 
@@ -21,10 +27,12 @@ type PullRequest struct {
 	c                client.Client
 	log              logr.Logger
 	gitClientFactory GitProviderClientFactory
+	impersonator     *impersonation.Impersonator
 }
 
 var (
 	_ strategy.Strategy = PullRequest{}
+	_ strategy.Cleaner  = PullRequest{}
 
 	ErrSpecIsNil = fmt.Errorf("PullRequest spec in Pipeline is nil")
 )
@@ -56,6 +64,13 @@ func (g PullRequest) Handles(p pipelinev1alpha1.Promotion) bool {
 }
 
 func (g PullRequest) Promote(ctx context.Context, promSpec pipelinev1alpha1.Promotion, promotion strategy.Promotion) (*strategy.PromotionResult, error) {
+	ctx, span := tracing.Start(ctx, "pullrequest.Promote", tracing.PromotionAttributes(
+		promotion.PipelineNamespace, promotion.PipelineName, promotion.Environment.Name, promotion.Version)...)
+	res, err := g.promote(ctx, promSpec, promotion)
+	return res, tracing.End(span, err)
+}
+
+func (g PullRequest) promote(ctx context.Context, promSpec pipelinev1alpha1.Promotion, promotion strategy.Promotion) (*strategy.PromotionResult, error) {
 	log := g.log.WithValues("promotion", promotion)
 
 	prSpec := promSpec.Strategy.PullRequest
@@ -82,27 +97,53 @@ func (g PullRequest) Promote(ctx context.Context, promSpec pipelinev1alpha1.Prom
 		}
 	}()
 
-	creds, err := g.fetchCredentials(ctx, g.c, promotion.PipelineNamespace, prSpec.SecretRef)
+	c, err := g.credentialsClient(promotion.PipelineNamespace, promotion.ServiceAccountName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch credentials: %w", err)
 	}
-
-	gitClient, err := g.cloneRepo(ctx, *prSpec, cloneDir, creds)
+	creds, err := g.fetchCredentials(ctx, c, promotion.PipelineNamespace, prSpec.SecretRef)
 	if err != nil {
+		return nil, fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+
+	cloneCtx, span := tracing.Start(ctx, "pullrequest.Clone", attribute.String("git.repository", prSpec.URL))
+	gitClient, err := g.cloneRepo(cloneCtx, *prSpec, cloneDir, creds)
+	if tracing.End(span, err) != nil {
 		return nil, fmt.Errorf("failed to clone repo: %w", err)
 	}
-	headBranch := fmt.Sprintf("promotion-%s-%s-%s", promotion.PipelineNamespace, promotion.PipelineName, promotion.Environment.Name)
+	headBranch := headBranchName(promotion.PipelineNamespace, promotion.PipelineName, promotion.Environment.Name)
 	if err := gitClient.SwitchBranch(ctx, headBranch); err != nil {
 		return nil, fmt.Errorf("failed to switch branch: %w", err)
 	}
 
-	if err := g.patchManifests(cloneDir, promotion); err != nil {
+	_, span = tracing.Start(ctx, "pullrequest.Patch")
+	if err := tracing.End(span, g.patchManifests(cloneDir, promotion)); err != nil {
 		return nil, fmt.Errorf("failed to patch manifest files: %w", err)
 	}
 
+	if err := g.commitAndPush(ctx, gitClient, headBranch); err != nil {
+		return nil, err
+	}
+
+	pr, err := g.createPullRequest(ctx, string(creds["token"]), headBranch, prSpec.BaseBranch, prSpec.Type, prSpec.URL, promotion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PR: %w", err)
+	}
+	log.Info("created PR", "pr", pr.Link)
+
+	return &strategy.PromotionResult{
+		Location: pr.Link,
+	}, nil
+}
+
+// commitAndPush commits any changes made to the clone and pushes the branch given.
+func (g PullRequest) commitAndPush(ctx context.Context, gitClient fgit.RepositoryClient, branch string) (err error) {
+	ctx, span := tracing.Start(ctx, "pullrequest.Push", attribute.String("git.branch", branch))
+	defer func() { tracing.End(span, err) }()
+
 	clean, err := gitClient.IsClean()
 	if err != nil {
-		return nil, fmt.Errorf("failed to determine worktree state: %w", err)
+		return fmt.Errorf("failed to determine worktree state: %w", err)
 	}
 	if !clean {
 		commit, err := gitClient.Commit(fgit.Commit{
@@ -113,28 +154,102 @@ func (g PullRequest) Promote(ctx context.Context, promSpec pipelinev1alpha1.Prom
 			},
 		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to commit manifests: %w", err)
+			return fmt.Errorf("failed to commit manifests: %w", err)
 		}
-		log.Info("committed patched manifests", "commit", commit)
+		g.log.Info("committed patched manifests", "branch", branch, "commit", commit)
 	}
 
 	if err := gitClient.Push(ctx); err != nil {
 		// I couldn't find a better way to check if it's an "up-to-date" error.
 		if err.Error() != "already up-to-date" {
-			return nil, fmt.Errorf("failed to push changes: %w", err)
+			return fmt.Errorf("failed to push changes: %w", err)
 		}
 	}
-	log.Info("pushed promotion branch")
+	g.log.Info("pushed promotion branch", "branch", branch)
 
-	pr, err := g.createPullRequest(ctx, string(creds["token"]), headBranch, prSpec.BaseBranch, prSpec.Type, prSpec.URL, promotion)
+	return nil
+}
+
+// Cleanup closes the open PRs and deletes the branches created to promote to each of the pipeline's environments that use
+// this strategy.
+func (g PullRequest) Cleanup(ctx context.Context, pipeline pipelinev1alpha1.Pipeline) error {
+	var errs []error
+	for _, env := range pipeline.Spec.Environments {
+		promSpec := pipeline.Spec.GetPromotion(env.Name)
+		if promSpec == nil || !g.Handles(*promSpec) {
+			continue
+		}
+		if err := g.cleanupEnvironment(ctx, pipeline, env.Name, *promSpec.Strategy.PullRequest); err != nil {
+			errs = append(errs, fmt.Errorf("failed to clean up after promotions to environment %s: %w", env.Name, err))
+		}
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+func (g PullRequest) cleanupEnvironment(ctx context.Context, pipeline pipelinev1alpha1.Pipeline, env string, prSpec pipelinev1alpha1.PullRequestPromotion) error {
+	log := g.log.WithValues("pipeline", client.ObjectKeyFromObject(&pipeline), "environment", env)
+
+	c, err := g.credentialsClient(pipeline.Namespace, pipeline.Spec.ServiceAccountName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create PR: %w", err)
+		// as with missing credentials, this shouldn't block the deletion.
+		if errors.Is(err, impersonation.ErrServiceAccountRequired) {
+			log.Info("no service account to read git credentials with, leaving promotion branch and PRs in place")
+			return nil
+		}
+		return fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+	creds, err := g.fetchCredentials(ctx, c, pipeline.Namespace, prSpec.SecretRef)
+	if err != nil {
+		// there's nothing that can be done without the credentials. They are usually missing because the namespace is
+		// being deleted along with the pipeline, so this doesn't fail, which would block the deletion.
+		if apierrors.IsNotFound(err) {
+			log.Info("git credentials not found, leaving promotion branch and PRs in place", "secret", prSpec.SecretRef.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to fetch credentials: %w", err)
 	}
-	log.Info("created PR", "pr", pr.Link)
 
-	return &strategy.PromotionResult{
-		Location: pr.Link,
-	}, nil
+	gitClient, err := g.newGitClient(string(creds["token"]), prSpec.Type, prSpec.URL)
+	if err != nil {
+		return err
+	}
+
+	head := headBranchName(pipeline.Namespace, pipeline.Name, env)
+
+	prList, err := gitClient.ListPullRequests(ctx, prSpec.URL)
+	if err != nil {
+		return fmt.Errorf("failed listing PRs: %w", err)
+	}
+	for _, pr := range prList {
+		if pr.Source != head || pr.Merged {
+			continue
+		}
+		if err := gitClient.ClosePullRequest(ctx, prSpec.URL, pr.Number); err != nil {
+			return fmt.Errorf("failed to close PR: %w", err)
+		}
+		log.Info("closed PR", "pr", pr.Link)
+	}
+
+	if err := gitClient.DeleteBranch(ctx, prSpec.URL, head); err != nil {
+		return fmt.Errorf("failed to delete promotion branch: %w", err)
+	}
+	log.Info("deleted promotion branch", "branch", head)
+
+	return nil
+}
+
+// headBranchName returns the name of the branch promotions to the environment given are pushed to.
+func headBranchName(pipelineNamespace, pipelineName, env string) string {
+	return fmt.Sprintf("promotion-%s-%s-%s", pipelineNamespace, pipelineName, env)
+}
+
+// credentialsClient returns the client to read a pipeline's Secrets with: one impersonating the pipeline's service
+// account, if the strategy has an impersonator, and its own client otherwise.
+func (g PullRequest) credentialsClient(namespace, serviceAccountName string) (client.Client, error) {
+	if g.impersonator == nil {
+		return g.c, nil
+	}
+	return g.impersonator.Client(namespace, serviceAccountName)
 }
 
 func (g PullRequest) fetchCredentials(ctx context.Context, c client.Client, ns string, secretRef meta.LocalObjectReference) (map[string][]byte, error) {
@@ -150,28 +265,9 @@ func (s PullRequest) createPullRequest(ctx context.Context, token string, head s
 		return nil, ErrTokenIsEmpty
 	}
 
-	var (
-		err error
-	)
-
-	provider := GitProviderConfig{
-		Token:            token,
-		TokenType:        "oauth2",
-		Type:             gitProviderType,
-		Domain:           "",
-		DestructiveCalls: false,
-	}
-
-	parsedURL, err := git.ParseURL(string(gitProviderType), gitURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed parsing git provider URL: %w", err)
-	}
-
-	provider.Domain = parsedURL.Domain
-
-	client, err := s.gitClientFactory(provider)
+	client, err := s.newGitClient(token, gitProviderType, gitURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed creating git provider client: %w", err)
+		return nil, err
 	}
 
 	newTitle := fmt.Sprintf(
@@ -231,3 +327,28 @@ func (s PullRequest) createPullRequest(ctx context.Context, token string, head s
 
 	return pr, nil
 }
+
+// newGitClient returns a client for the git provider hosting the repository at gitURL.
+func (s PullRequest) newGitClient(token string, gitProviderType pipelinev1alpha1.GitProviderType, gitURL string) (git.Provider, error) {
+	provider := GitProviderConfig{
+		Token:            token,
+		TokenType:        "oauth2",
+		Type:             gitProviderType,
+		Domain:           "",
+		DestructiveCalls: false,
+	}
+
+	parsedURL, err := git.ParseURL(string(gitProviderType), gitURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing git provider URL: %w", err)
+	}
+
+	provider.Domain = parsedURL.Domain
+
+	client, err := s.gitClientFactory(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating git provider client: %w", err)
+	}
+
+	return client, nil
+}
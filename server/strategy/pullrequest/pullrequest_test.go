@@ -29,11 +29,13 @@ import (
 	"go.uber.org/mock/gomock"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/weaveworks/pipeline-controller/api/v1alpha1"
 	"github.com/weaveworks/pipeline-controller/internal/git"
+	"github.com/weaveworks/pipeline-controller/internal/impersonation"
 	"github.com/weaveworks/pipeline-controller/internal/testingutils"
 	"github.com/weaveworks/pipeline-controller/server/strategy"
 )
@@ -252,6 +254,33 @@ func TestPromote_no_secret(t *testing.T) {
 	assert.Nil(t, res)
 }
 
+func TestPromote_no_service_account(t *testing.T) {
+	promSpec := v1alpha1.Promotion{
+		Strategy: v1alpha1.Strategy{
+			PullRequest: &v1alpha1.PullRequestPromotion{
+				Type:      "github",
+				SecretRef: meta.LocalObjectReference{Name: "repo-credentials"},
+			},
+		},
+	}
+	promotion := strategy.Promotion{PipelineNamespace: "default"}
+
+	res, err := newPromotionRequest(
+		t,
+		requestOptions{
+			promotionSpec: promSpec,
+			promotion:     promotion,
+			objects: []client.Object{
+				&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "repo-credentials", Namespace: "default"}},
+			},
+			requireServiceAccount: true,
+		},
+	)
+
+	assert.ErrorIs(t, err, impersonation.ErrServiceAccountRequired)
+	assert.Nil(t, res)
+}
+
 func TestPromote_no_repo_url(t *testing.T) {
 	promSpec := v1alpha1.Promotion{
 		Strategy: v1alpha1.Strategy{
@@ -756,6 +785,8 @@ type requestOptions struct {
 	objects       []client.Object
 	gitServerOpts *gitServerConfig
 	mockSetup     func(*gomock.Controller, v1alpha1.Promotion, strategy.Promotion) (git.Provider, error)
+	// requireServiceAccount, if true, makes the strategy impersonate the promotion's service account, and require one.
+	requireServiceAccount bool
 }
 
 func newPromotionRequest(t *testing.T, opts requestOptions) (*strategy.PromotionResult, error) {
@@ -788,7 +819,12 @@ func newPromotionRequest(t *testing.T, opts requestOptions) (*strategy.Promotion
 
 	mockCF := mockGitProviderFactory(gitClient)
 
-	strat, err := pullrequest.New(fc, logger.NewLogger(logger.Options{}), pullrequest.GitClientFactory(mockCF))
+	stratOpts := []pullrequest.Opt{pullrequest.GitClientFactory(mockCF)}
+	if opts.requireServiceAccount {
+		stratOpts = append(stratOpts, pullrequest.Impersonator(impersonation.New(fc, &rest.Config{}, fc.Scheme(), fc.RESTMapper(), true)))
+	}
+
+	strat, err := pullrequest.New(fc, logger.NewLogger(logger.Options{}), stratOpts...)
 	if err != nil {
 		return nil, err
 	}
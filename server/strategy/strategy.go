@@ -20,12 +20,23 @@ type Strategy interface {
 	Promote(context.Context, pipelinev1alpha1.Promotion, Promotion) (*PromotionResult, error)
 }
 
+// Cleaner is implemented by strategies that leave things behind outside the cluster, for example branches and pull requests
+// in a git repository, so that these can be removed when a Pipeline is deleted.
+type Cleaner interface {
+	// Cleanup removes whatever the strategy left behind for the environments of the pipeline that it handles the
+	// promotion of. Cleaning up after a pipeline that has nothing left behind is not an error.
+	Cleanup(context.Context, pipelinev1alpha1.Pipeline) error
+}
+
 // Promotion is the type encapsulating a single promotion request.
 type Promotion struct {
 	PipelineNamespace string                       `json:"pipelineNamespace"`
 	PipelineName      string                       `json:"pipelineName"`
 	Environment       pipelinev1alpha1.Environment `json:"environment"`
 	Version           string                       `json:"version"`
+	// ServiceAccountName is the service account of the Pipeline, which is impersonated to read the Secrets used for
+	// the promotion. See Pipeline's `.spec.serviceAccountName`.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
 }
 
 // PromotionResult is returned by a Strategy and contains data supposed to be passed on to the webhook caller.
@@ -46,10 +57,37 @@ func (r *StrategyRegistry) Register(s Strategy) {
 // the first one is chosen. If the promotion spec contains multiple promotion strategies, Get will return the first strategy that is able to handle
 // at least one of them.
 func (r StrategyRegistry) Get(p pipelinev1alpha1.Promotion) (Strategy, error) {
-	for _, s := range r {
+	if i := r.index(p); i >= 0 {
+		return r[i], nil
+	}
+	return nil, fmt.Errorf("no known promotion strategy requested")
+}
+
+// Cleaners returns the strategies that promote to at least one of the pipeline's environments and need to clean up after
+// it, i.e., implement Cleaner.
+func (r StrategyRegistry) Cleaners(p pipelinev1alpha1.Pipeline) []Cleaner {
+	var res []Cleaner
+	for i, s := range r {
+		c, ok := s.(Cleaner)
+		if !ok {
+			continue
+		}
+		for _, env := range p.Spec.Environments {
+			if promotion := p.Spec.GetPromotion(env.Name); promotion != nil && r.index(*promotion) == i {
+				res = append(res, c)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// index returns the index of the strategy Get would return for the promotion spec given, or -1 if there is none.
+func (r StrategyRegistry) index(p pipelinev1alpha1.Promotion) int {
+	for i, s := range r {
 		if s.Handles(p) {
-			return s, nil
+			return i
 		}
 	}
-	return nil, fmt.Errorf("no known promotion strategy requested")
+	return -1
 }